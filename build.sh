@@ -1,2 +1,2 @@
 #!/bin/sh
-go build -o dashcam
+go build -o dashcam ./cmd/dashcam
@@ -0,0 +1,1158 @@
+package main
+
+import (
+	"context"
+	"dashcam/internal/attributes"
+	"dashcam/internal/control"
+	"dashcam/internal/crypt"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/metadata"
+	"dashcam/internal/thumbnail"
+	"dashcam/pkg/catalog"
+	"dashcam/pkg/recorder"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usage lists the available subcommands
+const usage = `Usage: dashcam [command] [options]
+
+Without a command, dashcam starts recording.
+
+Commands:
+  list [-thumbs] [-min-activity n]
+                                 List recordings, oldest first
+  play [-scenes] <segment>       Play a recording (decrypting it if needed)
+  replay [-source name] [-length 1h] <time>
+                                 Play the archive from a wall-clock time, across segments
+  export [-out dir] [-min-activity n] [-scenes] [-from t] [-to t] [-format mp4|webm]
+         [-timestamp] [-hostname] [-watermark text] [-split-audio wav|opus]
+         [-drop-audio n,...|all] [-manifest=false]
+         <segment>... | -filter category=emergency [-since 30d]
+                                 Copy recordings out of the archive (decrypting them if needed)
+  clip [-last 30s] [-gif] [-out file]
+                                 Make a small WebM or GIF of the last seconds of recording
+  contact-sheet [-day YYYY-MM-DD] [-columns n] [-rows n] [-out file] [segment...]
+                                 Render a grid of timestamped frames of recordings into one image
+  search <text>...               Find when windows, on-screen text or speech matched the text
+  merge -day YYYY-MM-DD [-source name]
+                                 Join a day's recordings into one file, replacing them
+  timelapse [-day YYYY-MM-DD] [-length 90s]
+                                 Render a sped-up video of a day's recordings
+  emergency                      Protect the current and previous recording and upload them
+  incidents [-state open|new|reviewed|archived|deleted|all]
+                                 List protected recordings by review state
+  review [-state reviewed|archived|deleted|new] <segment>...
+                                 Move incidents to another review state
+  upload [segment...]            Upload protected (or the given) recordings to upload_remote
+  annotate [-offset when] <text>...
+                                 Label a moment of the current recording (when: now, -30s, 15:04:05)
+  status                         Print the recorder state as JSON (for status bars)
+  events                         Print recorder events as JSON lines while it runs
+  waybar [-once]                 Print the recorder state for a waybar custom module, updated live
+  wipe --confirm                 Securely delete all non-protected recordings and the journal
+  help                           Show this help
+`
+
+// runCommand dispatches a subcommand and returns the process exit code
+func runCommand(name string, args []string) int {
+	config, err := recorder.LoadConfig()
+	if err != nil {
+		log.Printf("Warning: Could not load config, using defaults: %v", err)
+		config = recorder.DefaultConfig()
+	}
+
+	switch name {
+	case "list":
+		err = cmdList(config, args)
+	case "play":
+		err = cmdPlay(config, args)
+	case "replay":
+		err = cmdReplay(config, args)
+	case "export":
+		err = cmdExport(config, args)
+	case "clip":
+		err = cmdClip(config, args)
+	case "contact-sheet":
+		err = cmdContactSheet(config, args)
+	case "search":
+		err = cmdSearch(config, args)
+	case "merge":
+		err = cmdMerge(config, args)
+	case "timelapse":
+		err = cmdTimelapse(config, args)
+	case "emergency":
+		err = control.Call(control.DefaultSocketPath(), "emergency", nil, nil)
+	case "incidents":
+		err = cmdIncidents(config, args)
+	case "review":
+		err = cmdReview(config, args)
+	case "upload":
+		err = cmdUpload(config, args)
+	case "annotate":
+		err = cmdAnnotate(args)
+	case "status":
+		err = cmdStatus(args)
+	case "events":
+		err = cmdEvents(args)
+	case "waybar":
+		err = cmdWaybar(config, args)
+	case "wipe":
+		err = cmdWipe(config, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n%s", name, usage)
+		return 2
+	}
+
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// cmdPlay plays a single segment with the configured player
+func cmdPlay(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	scenes := flags.Bool("scenes", false, "use detected scene changes as chapters (mpv)")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: dashcam play [-scenes] <segment>")
+	}
+
+	path, err := resolveSegment(config, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var playerArgs []string
+	if *scenes {
+		chaptersFile, err := sceneChaptersFile(path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(chaptersFile)
+		// mpv reads any file ffmpeg can demux as chapter source, including FFMETADATA
+		playerArgs = append(playerArgs, "--chapters-file="+chaptersFile)
+	}
+
+	var cmd *exec.Cmd
+	if crypt.IsEncrypted(path) {
+		// Stream the decrypted video to the player so no plain copy touches the disk
+		reader, err := recorder.OpenSegment(config, path)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		cmd = exec.Command(config.Player, append(playerArgs, "-")...)
+		cmd.Stdin = reader
+	} else {
+		cmd = exec.Command(config.Player, append(playerArgs, path)...)
+		cmd.Stdin = os.Stdin
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("player %s failed: %v", config.Player, err)
+	}
+	return nil
+}
+
+// cmdExport copies segments to a directory, decrypting them on the way
+func cmdExport(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	outDir := flags.String("out", ".", "directory to export to")
+	flags.StringVar(outDir, "out-dir", ".", "same as -out")
+	minActivity := flags.Float64("min-activity", 0, "skip recordings with a lower activity score (0-1)")
+	scenes := flags.Bool("scenes", false, "add detected scene changes as chapters")
+	from := flags.String("from", "", "start of the clip: offset into the segment (1m30s) or time of day (15:04:05)")
+	to := flags.String("to", "", "end of the clip: offset into the segment (2m) or time of day (15:06:00)")
+	format := flags.String("format", "", "convert to mp4 or webm for sharing (copying streams where possible)")
+	withManifest := flags.Bool("manifest", true, "write a manifest with SHA-256 hashes of the exported files")
+	timestamp := flags.Bool("timestamp", false, "burn the recording time into the video")
+	hostname := flags.Bool("hostname", false, "burn this machine's hostname into the video")
+	watermark := flags.String("watermark", "", "burn this text into the top right corner of the video")
+	filter := flags.String("filter", "", "export all recordings with this marker instead of the given ones: category=emergency, category=protected or marker=<value>")
+	since := flags.String("since", "", "with -filter, only recordings from the last duration (e.g. 30d, 12h)")
+	splitAudio := flags.String("split-audio", "", "also write every audio track to its own wav or opus file")
+	dropAudio := flags.String("drop-audio", "", "audio tracks to leave out of the video: numbers counting from 1 (e.g. 2 or 1,3), or all")
+	flags.Parse(args)
+	if (*filter == "") == (flags.NArg() == 0) {
+		return fmt.Errorf("usage: dashcam export [-out dir] [-min-activity n] [-scenes] [-from t] [-to t] [-format mp4|webm] [-timestamp] [-hostname] [-watermark text] [-split-audio wav|opus] [-drop-audio n,...|all] [-manifest=false] <segment>... | -filter category=emergency [-since 30d]")
+	}
+	if _, ok := ffmpeg.Formats[*format]; *format != "" && !ok {
+		return fmt.Errorf("unknown format '%s' (use mp4 or webm)", *format)
+	}
+	if _, ok := ffmpeg.AudioFormats[*splitAudio]; *splitAudio != "" && !ok {
+		return fmt.Errorf("unknown audio format '%s' (use wav or opus)", *splitAudio)
+	}
+
+	// Exports get the same protection as the recordings they come from
+	if err := os.MkdirAll(*outDir, config.DirPermissions()); err != nil {
+		return fmt.Errorf("failed to create export directory: %v", err)
+	}
+	xattrs := attributes.Supported(*outDir)
+	if !xattrs {
+		log.Printf("Warning: %s can't store extended attributes (e.g. FAT, NFS or SMB); markers go into sidecar files and the manifest instead", *outDir)
+		*withManifest = true
+	}
+
+	var paths []string
+	if *filter != "" {
+		var err error
+		if paths, err = filterSegments(config, *filter, *since); err != nil {
+			return err
+		}
+		log.Printf("%d recordings match %s", len(paths), *filter)
+	} else {
+		for _, arg := range flags.Args() {
+			path, err := resolveSegment(config, arg)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	manifest := newManifest(config, args)
+	for _, path := range paths {
+		exported := filepath.Join(*outDir, crypt.PlainName(filepath.Base(path)))
+		if *format != "" {
+			exported = strings.TrimSuffix(exported, filepath.Ext(exported)) + "." + *format
+		}
+		// Batches are re-run for periodic offloading; earlier exports stay as they are
+		if *filter != "" && recorder.FileExists(exported) {
+			log.Printf("Skipping %s: already exported", filepath.Base(path))
+			continue
+		}
+
+		meta, err := metadata.Load(crypt.PlainName(path))
+		if err == nil && (recorder.Segment{Path: path, Meta: meta}).Idle(*minActivity) {
+			log.Printf("Skipping %s: no activity", filepath.Base(path))
+			continue
+		}
+
+		start, end, err := clipRange(meta, *from, *to)
+		if err != nil {
+			return err
+		}
+		if end >= 0 && end <= start {
+			log.Printf("Skipping %s: outside of the requested range", filepath.Base(path))
+			continue
+		}
+
+		target := filepath.Join(*outDir, crypt.PlainName(filepath.Base(path)))
+		if err := exportSegment(config, path, target); err != nil {
+			return fmt.Errorf("failed to export %s: %v", path, err)
+		}
+		if start > 0 || end >= 0 {
+			err := recorder.RewriteSegment(target, func(src string, dst string) error {
+				return ffmpeg.Trim(src, dst, start, end)
+			})
+			if err != nil {
+				os.Remove(target)
+				return fmt.Errorf("failed to trim %s: %v", path, err)
+			}
+		}
+		var tracks []string
+		if *splitAudio != "" || *dropAudio != "" {
+			if tracks, err = exportAudio(target, *splitAudio, *dropAudio); err != nil {
+				os.Remove(target)
+				return fmt.Errorf("failed to export the audio of %s: %v", path, err)
+			}
+		}
+		overlay := ffmpeg.Overlay{Watermark: *watermark}
+		if *timestamp {
+			if meta.Start.IsZero() {
+				log.Printf("Warning: No recording time for %s, leaving out the timestamp", filepath.Base(path))
+			} else {
+				overlay.Clock = meta.TimeAt(start)
+			}
+		}
+		if *hostname {
+			overlay.Hostname, _ = os.Hostname()
+		}
+		if !overlay.Empty() {
+			err := recorder.RewriteSegment(target, func(src string, dst string) error {
+				return ffmpeg.BurnOverlay(src, dst, overlay)
+			})
+			if err != nil {
+				os.Remove(target)
+				return fmt.Errorf("failed to add overlay to %s: %v", path, err)
+			}
+		}
+		if *format != "" {
+			converted := strings.TrimSuffix(target, filepath.Ext(target)) + "." + *format
+			err := recorder.RewriteSegment(target, func(src string, dst string) error {
+				return ffmpeg.Convert(src, dst, *format)
+			})
+			if err == nil && converted != target {
+				err = os.Rename(target, converted)
+			}
+			if err != nil {
+				os.Remove(target)
+				return fmt.Errorf("failed to convert %s to %s: %v", path, *format, err)
+			}
+			target = converted
+		}
+		if *scenes {
+			if err := addSceneChapters(path, target, start); err != nil {
+				log.Printf("Warning: Could not add scene chapters to %s: %v", target, err)
+			}
+		}
+		// ffmpeg creates the files it rewrites with the default permissions
+		for _, file := range append([]string{target}, tracks...) {
+			if err := os.Chmod(file, config.FilePermissions()); err != nil {
+				log.Printf("Warning: Could not set permissions of %s: %v", file, err)
+			}
+		}
+		// Exports keep their marker, so protected recordings stay recognisable
+		if marker, err := attributes.GetMarker(path, recorder.MarkerName); err == nil && marker != "" {
+			if xattrs {
+				err = attributes.SetMarker(target, recorder.MarkerName, marker)
+			} else {
+				err = writeMarkerSidecar(target, meta, start, end, marker)
+			}
+			if err != nil {
+				log.Printf("Warning: Could not preserve the marker of %s: %v", filepath.Base(path), err)
+			}
+		}
+		if *withManifest {
+			for _, file := range append([]string{target}, tracks...) {
+				if err := manifest.addFile(*outDir, file, recorder.Segment{Path: path, Meta: meta}, start, end); err != nil {
+					return fmt.Errorf("failed to add %s to the manifest: %v", file, err)
+				}
+			}
+		}
+		log.Printf("Exported %s -> %s", filepath.Base(path), target)
+		for _, track := range tracks {
+			log.Printf("Exported audio of %s -> %s", filepath.Base(path), track)
+		}
+	}
+
+	if *withManifest && len(manifest.Files) > 0 {
+		path, sum, err := manifest.write(*outDir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Wrote manifest %s (SHA-256 %s)", path, sum)
+	}
+	return nil
+}
+
+// writeMarkerSidecar stores the marker of an exported clip of a recording, along
+// with the time it covers, in a metadata sidecar next to it
+func writeMarkerSidecar(target string, meta metadata.Segment, start float64, end float64, marker string) error {
+	sidecar := metadata.Segment{Marker: marker}
+	if !meta.Start.IsZero() {
+		sidecar.Start = meta.TimeAt(start)
+		sidecar.End = meta.End
+		if end >= 0 {
+			sidecar.End = meta.TimeAt(end)
+		}
+	}
+	return metadata.Save(target, sidecar)
+}
+
+// exportAudio writes every audio track of an exported file to its own file
+// (<name>.track1.wav, ...) when format is set, then removes the tracks listed in
+// drop from the exported file. It returns the files written.
+func exportAudio(target string, format string, drop string) ([]string, error) {
+	count, err := ffmpeg.AudioTracks(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []int
+	switch drop {
+	case "":
+	case "all":
+		for track := 0; track < count; track++ {
+			dropped = append(dropped, track)
+		}
+	default:
+		for _, value := range strings.Split(drop, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid audio track '%s' (tracks count from 1)", value)
+			}
+			if n > count {
+				log.Printf("Warning: %s has no audio track %d", filepath.Base(target), n)
+				continue
+			}
+			dropped = append(dropped, n-1)
+		}
+	}
+
+	var files []string
+	removeFiles := func() {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+	if format != "" {
+		base := strings.TrimSuffix(target, filepath.Ext(target))
+		for track := 0; track < count; track++ {
+			file := fmt.Sprintf("%s.track%d.%s", base, track+1, format)
+			if err := ffmpeg.ExtractTrack(target, file, track, format); err != nil {
+				removeFiles()
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+
+	if len(dropped) > 0 {
+		err := recorder.RewriteSegment(target, func(src string, dst string) error {
+			return ffmpeg.DropAudio(src, dst, dropped)
+		})
+		if err != nil {
+			removeFiles()
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// filterSegments returns the recordings whose marker matches filter (category=emergency,
+// category=standard, category=protected or marker=<value>), optionally only those
+// started within the given age
+func filterSegments(config recorder.Config, filter string, since string) ([]string, error) {
+	key, value, ok := strings.Cut(filter, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid filter '%s' (use category=emergency or marker=<value>)", filter)
+	}
+	var matches func(marker string) bool
+	switch {
+	case key == "marker":
+		matches = func(marker string) bool { return marker == value }
+	case key == "category" && value == "emergency":
+		matches = func(marker string) bool { return marker == recorder.MarkerEmergency }
+	case key == "category" && value == "standard":
+		matches = func(marker string) bool { return marker == recorder.MarkerStandard }
+	case key == "category" && value == "protected":
+		matches = func(marker string) bool { return marker != recorder.MarkerStandard }
+	default:
+		return nil, fmt.Errorf("unknown filter '%s' (use category=emergency, standard or protected, or marker=<value>)", filter)
+	}
+
+	var after time.Time
+	if since != "" {
+		age, err := parseAge(since)
+		if err != nil {
+			return nil, err
+		}
+		after = time.Now().Add(-age)
+	}
+
+	segments, err := recorder.ListSegments(config)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, segment := range segments {
+		if segment.Meta.Start.Before(after) {
+			continue
+		}
+		marker, err := attributes.GetMarker(segment.Path, recorder.MarkerName)
+		if err != nil || !matches(marker) {
+			continue
+		}
+		paths = append(paths, segment.Path)
+	}
+	return paths, nil
+}
+
+// parseAge parses a duration that may also be given in days (30d) or weeks (2w)
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age '%s'", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age '%s' (use e.g. 30d, 2w or 12h)", value)
+	}
+	return age, nil
+}
+
+// tempDir creates a directory for decrypted copies next to the recordings, where
+// they get the same protection and don't end up in a shared /tmp
+func tempDir(config recorder.Config, name string) (string, error) {
+	dir, err := os.MkdirTemp(config.RecordingsDir, "."+name+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	return dir, nil
+}
+
+// exportSegment writes the plain contents of a segment to target
+func exportSegment(config recorder.Config, path string, target string) error {
+	reader, err := recorder.OpenSegment(config, path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, config.FilePermissions())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	return out.Close()
+}
+
+// clipRange resolves the -from and -to export options to offsets into a segment.
+// An end of -1 means until the end of the segment.
+func clipRange(meta metadata.Segment, from string, to string) (float64, float64, error) {
+	start, end := 0.0, -1.0
+	if from != "" {
+		offset, err := clipOffset(meta, from)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = max(offset, 0)
+	}
+	if to != "" {
+		offset, err := clipOffset(meta, to)
+		if err != nil {
+			return 0, 0, err
+		}
+		end = max(offset, 0)
+	}
+	return start, end, nil
+}
+
+// clipOffset parses an offset into the segment (a duration) or a time of day on the segment's day
+func clipOffset(meta metadata.Segment, value string) (float64, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Seconds(), nil
+	}
+	if meta.Start.IsZero() {
+		return 0, fmt.Errorf("cannot use time of day '%s' without segment metadata", value)
+	}
+	at, err := parseWhen(value, meta.Start)
+	if err != nil {
+		return 0, err
+	}
+	return meta.OffsetAt(at), nil
+}
+
+// cmdClip renders the last seconds of recording, including the segment being recorded,
+// as a small WebM or GIF
+func cmdClip(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("clip", flag.ExitOnError)
+	last := flags.Duration("last", 30*time.Second, "length of the clip")
+	gif := flags.Bool("gif", false, "make a GIF instead of a WebM")
+	out := flags.String("out", "", "output file (default: dashcam-clip-<time>.webm or .gif)")
+	width := flags.Int("width", 640, "maximum width in pixels")
+	flags.Parse(args)
+	if *last <= 0 {
+		return fmt.Errorf("invalid length %s", *last)
+	}
+
+	ext := ".webm"
+	if *gif {
+		ext = ".gif"
+	}
+	if *out == "" {
+		*out = "dashcam-clip-" + time.Now().Format("2006-01-02_15-04-05") + ext
+	}
+
+	// Newest first: the segment being recorded (if any), then finished ones
+	type source struct {
+		path     string
+		duration float64
+	}
+	var sources []source
+	var status recorder.Status
+	if control.Call(control.DefaultSocketPath(), "status", nil, &status) == nil && status.Segment != "" {
+		sources = append(sources, source{status.Segment, time.Since(status.SegmentStarted).Seconds()})
+	}
+	segments, err := recorder.ListSegments(config)
+	if err != nil {
+		return err
+	}
+	for i := len(segments) - 1; i >= 0 && len(sources) < 3; i-- {
+		// Additional sources such as cameras record something else
+		if segments[i].Meta.Source != "" {
+			continue
+		}
+		sources = append(sources, source{segments[i].Path, recorder.SegmentDuration(config, segments[i].Meta)})
+	}
+
+	tmpDir, err := tempDir(config, "clip")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var inputs []ffmpeg.ClipInput
+	remaining := last.Seconds()
+	for i := 0; i < len(sources) && remaining > 0; i++ {
+		path := sources[i].path
+		if crypt.IsEncrypted(path) {
+			path = filepath.Join(tmpDir, crypt.PlainName(filepath.Base(path)))
+			if err := exportSegment(config, sources[i].path, path); err != nil {
+				return fmt.Errorf("failed to decrypt %s: %v", filepath.Base(sources[i].path), err)
+			}
+		}
+
+		take := min(remaining, sources[i].duration)
+		inputs = append([]ffmpeg.ClipInput{{Path: path, Start: sources[i].duration - take, Duration: take}}, inputs...)
+		remaining -= take
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no recordings to clip")
+	}
+
+	if err := ffmpeg.Clip(inputs, *out, *gif, *width); err != nil {
+		os.Remove(*out)
+		return err
+	}
+	fmt.Println(*out)
+	return nil
+}
+
+// cmdContactSheet renders frames spread evenly over the given segments, or over a
+// day's recordings, into a grid labelled with the time of each frame
+func cmdContactSheet(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("contact-sheet", flag.ExitOnError)
+	dayFlag := flags.String("day", "", "use all recordings of this day (YYYY-MM-DD) instead of segments")
+	columns := flags.Int("columns", 4, "frames per row")
+	rows := flags.Int("rows", 6, "rows of frames")
+	width := flags.Int("width", 400, "width of each frame in pixels")
+	out := flags.String("out", "", "output image (default: dashcam-sheet-<first segment>.jpg)")
+	flags.Parse(args)
+	if (*dayFlag == "") == (flags.NArg() == 0) || *columns <= 0 || *rows <= 0 {
+		return fmt.Errorf("usage: dashcam contact-sheet [-day YYYY-MM-DD] [-columns n] [-rows n] [-out file] [segment...]")
+	}
+
+	var segments []recorder.Segment
+	if *dayFlag != "" {
+		day, err := recorder.ParseDay(*dayFlag)
+		if err != nil {
+			return err
+		}
+		all, err := recorder.ListSegments(config)
+		if err != nil {
+			return err
+		}
+		for _, segment := range all {
+			if segment.Meta.Start.Format("2006-01-02") == day.Format("2006-01-02") && segment.Meta.Source == "" {
+				segments = append(segments, segment)
+			}
+		}
+	} else {
+		for _, arg := range flags.Args() {
+			path, err := resolveSegment(config, arg)
+			if err != nil {
+				return err
+			}
+			meta, err := metadata.Load(crypt.PlainName(path))
+			if err != nil {
+				return err
+			}
+			segments = append(segments, recorder.Segment{Path: path, Meta: meta})
+		}
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("no recordings found")
+	}
+	if *out == "" {
+		*out = "dashcam-sheet-" + strings.TrimSuffix(filepath.Base(crypt.PlainName(segments[0].Path)), config.Extension) + ".jpg"
+	}
+
+	total := 0.0
+	for _, segment := range segments {
+		total += recorder.SegmentDuration(config, segment.Meta)
+	}
+
+	tmpDir, err := tempDir(config, "sheet")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Frames sit in the middle of equal slices of the total recording time
+	count := *columns * *rows
+	var frames []string
+	segmentIndex, segmentStart := 0, 0.0
+	decrypted := make(map[string]string)
+	for k := 0; k < count; k++ {
+		at := (float64(k) + 0.5) * total / float64(count)
+		for segmentIndex < len(segments)-1 && at >= segmentStart+recorder.SegmentDuration(config, segments[segmentIndex].Meta) {
+			segmentStart += recorder.SegmentDuration(config, segments[segmentIndex].Meta)
+			segmentIndex++
+		}
+		segment := segments[segmentIndex]
+		offset := at - segmentStart
+
+		path := segment.Path
+		if crypt.IsEncrypted(path) {
+			if decrypted[path] == "" {
+				plain := filepath.Join(tmpDir, crypt.PlainName(filepath.Base(path)))
+				if err := exportSegment(config, path, plain); err != nil {
+					return fmt.Errorf("failed to decrypt %s: %v", filepath.Base(path), err)
+				}
+				decrypted[path] = plain
+			}
+			path = decrypted[path]
+		}
+
+		frame := filepath.Join(tmpDir, fmt.Sprintf("frame-%04d.jpg", k))
+		label := segment.Meta.TimeAt(offset).Format("2006-01-02 15:04:05")
+		if err := ffmpeg.LabeledFrame(path, frame, offset, *width, label); err != nil {
+			log.Printf("Warning: Could not extract frame at %s: %v", label, err)
+			continue
+		}
+		frames = append(frames, frame)
+	}
+
+	if err := ffmpeg.Tile(frames, *out, *columns, *rows); err != nil {
+		return err
+	}
+	fmt.Println(*out)
+	return nil
+}
+
+// sceneChapters turns the detected scene changes of a segment into chapters titled with the time of day
+func sceneChapters(path string) (ffmpeg.Embed, error) {
+	meta, err := metadata.Load(crypt.PlainName(path))
+	if err != nil {
+		return ffmpeg.Embed{}, err
+	}
+	if len(meta.Scenes) == 0 {
+		return ffmpeg.Embed{}, fmt.Errorf("no scene changes recorded for %s (enable scene_detection)", filepath.Base(path))
+	}
+
+	embed := ffmpeg.Embed{Duration: meta.End.Sub(meta.Start).Seconds()}
+	for _, offset := range append([]float64{0}, meta.Scenes...) {
+		at := meta.TimeAt(offset)
+		embed.Chapters = append(embed.Chapters, ffmpeg.Chapter{Start: offset, Title: at.Format("15:04:05")})
+	}
+	return embed, nil
+}
+
+// sceneChaptersFile writes the scene chapters of a segment to a temporary FFMETADATA file
+func sceneChaptersFile(path string) (string, error) {
+	embed, err := sceneChapters(path)
+	if err != nil {
+		return "", err
+	}
+	return ffmpeg.WriteChapters(embed.Chapters, embed.Duration)
+}
+
+// addSceneChapters remuxes an exported copy of a segment with its scene chapters.
+// The copy starts at offset start into the segment.
+func addSceneChapters(path string, target string, start float64) error {
+	embed, err := sceneChapters(path)
+	if err != nil {
+		return err
+	}
+
+	var chapters []ffmpeg.Chapter
+	for i, chapter := range embed.Chapters {
+		// The scene running at the start of the clip becomes its first chapter
+		if next := i + 1; next < len(embed.Chapters) && embed.Chapters[next].Start <= start {
+			continue
+		}
+		chapter.Start = max(chapter.Start-start, 0)
+		chapters = append(chapters, chapter)
+	}
+	embed.Chapters = chapters
+	embed.Duration -= start
+
+	tmp := strings.TrimSuffix(target, filepath.Ext(target)) + ".chapters" + filepath.Ext(target)
+	if err := ffmpeg.Remux(target, tmp, embed); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// resolveSegment finds a segment given as a path or as a name in the recordings directory
+func resolveSegment(config recorder.Config, name string) (string, error) {
+	candidates := []string{name, name + crypt.Extension}
+	if !filepath.IsAbs(name) {
+		candidates = append(candidates,
+			filepath.Join(config.RecordingsDir, name),
+			filepath.Join(config.RecordingsDir, name+crypt.Extension))
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("recording not found: %s", name)
+}
+
+// cmdWipe securely deletes the archive after explicit confirmation
+func cmdWipe(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("wipe", flag.ExitOnError)
+	confirm := flags.Bool("confirm", false, "confirm that all non-protected recordings should be destroyed")
+	flags.Parse(args)
+	if !*confirm {
+		return fmt.Errorf("refusing to wipe %s without --confirm", config.RecordingsDir)
+	}
+
+	wiped, protected, err := recorder.WipeRecordings(config)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wiped %d recordings, kept %d protected", wiped, protected)
+	return nil
+}
+
+// cmdMerge merges a day's recordings, through the running recorder if there is one
+func cmdMerge(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	dayFlag := flags.String("day", "yesterday", "day to merge (YYYY-MM-DD)")
+	sourceFlag := flags.String("source", "", "additional source whose recordings to merge (default: the main one)")
+	flags.Parse(args)
+
+	day, err := recorder.ParseDay(*dayFlag)
+	if err != nil {
+		return err
+	}
+
+	// The recorder serializes merging with its own retention cleanup. Merging a
+	// day takes a while, so there's no deadline for the answer.
+	var result recorder.MergeResult
+	socket := control.DefaultSocketPath()
+	if control.Call(socket, "status", nil, &recorder.Status{}) == nil {
+		if err := control.CallTimeout(socket, "merge", recorder.MergeRequest{Day: day.Format("2006-01-02"), Source: *sourceFlag}, &result, 0); err != nil {
+			return err
+		}
+	} else {
+		cat := catalog.Open(filepath.Join(config.RecordingsDir, recorder.CatalogFilename))
+		if result.File, result.Parts, err = recorder.MergeDay(config, cat, day, *sourceFlag); err != nil {
+			return err
+		}
+	}
+
+	if result.File == "" {
+		fmt.Printf("Nothing to merge for %s (%d recordings)\n", day.Format("2006-01-02"), result.Parts)
+		return nil
+	}
+	fmt.Printf("Merged %d recordings into %s\n", result.Parts, result.File)
+	return nil
+}
+
+// cmdTimelapse renders the timelapse of a day, replacing an existing one
+func cmdTimelapse(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("timelapse", flag.ExitOnError)
+	dayFlag := flags.String("day", "yesterday", "day to render (YYYY-MM-DD)")
+	length := flags.Duration("length", time.Duration(config.TimelapseLength)*time.Second, "length of the timelapse")
+	flags.Parse(args)
+
+	day, err := recorder.ParseDay(*dayFlag)
+	if err != nil {
+		return err
+	}
+	if *length <= 0 {
+		return fmt.Errorf("invalid length %s", *length)
+	}
+
+	file, err := recorder.MakeTimelapse(config, day, *length)
+	if err != nil {
+		return err
+	}
+	fmt.Println(file)
+	return nil
+}
+
+// cmdUpload uploads the given recordings, or all that are due, to the configured remote
+func cmdUpload(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	flags.Parse(args)
+	if config.UploadRemote == "" {
+		return fmt.Errorf("no upload_remote configured")
+	}
+
+	files := make([]string, 0, flags.NArg())
+	for _, arg := range flags.Args() {
+		path, err := resolveSegment(config, arg)
+		if err != nil {
+			return err
+		}
+		if config.Encrypt && !crypt.IsEncrypted(path) {
+			return fmt.Errorf("%s is not encrypted yet, refusing to upload it", filepath.Base(path))
+		}
+		files = append(files, path)
+	}
+	if flags.NArg() == 0 {
+		var err error
+		if files, err = recorder.UploadCandidates(config); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		if err := recorder.UploadFile(context.Background(), config, file); err != nil {
+			log.Printf("Error: %v", err)
+			failed++
+			continue
+		}
+		fmt.Printf("Uploaded %s\n", filepath.Base(file))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", failed, len(files))
+	}
+	return nil
+}
+
+// cmdAnnotate sends a label for the current recording to the running recorder
+func cmdAnnotate(args []string) error {
+	flags := flag.NewFlagSet("annotate", flag.ExitOnError)
+	offset := flags.String("offset", "now", "when it happened: now, a duration ago (-30s) or a time of day (15:04:05)")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: dashcam annotate [-offset when] <text>...")
+	}
+
+	at, err := parseWhen(*offset, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var result recorder.AnnotateResult
+	request := recorder.AnnotateRequest{Time: at, Text: strings.Join(flags.Args(), " ")}
+	if err := control.Call(control.DefaultSocketPath(), "annotate", request, &result); err != nil {
+		return err
+	}
+	fmt.Printf("%s +%ds\n", result.Segment, int(result.Offset))
+	return nil
+}
+
+// parseWhen parses "now", a duration before now ("-30s" or "30s"), a time of day today
+// ("15:04" or "15:04:05"), a local date and time ("2006-01-02 15:04:05") or an RFC 3339
+// timestamp
+func parseWhen(value string, now time.Time) (time.Time, error) {
+	if value == "" || value == "now" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(value, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location()), nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s' (use now, -30s, 15:04:05, 2006-01-02 15:04:05 or RFC 3339)", value)
+}
+
+// cmdStatus prints the state of the running recorder as JSON
+func cmdStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	flags.Parse(args)
+
+	// Not running is a valid state for status bars, not an error
+	status := recorder.Status{State: "stopped"}
+	if err := control.Call(control.DefaultSocketPath(), "status", nil, &status); err != nil {
+		status = recorder.Status{State: "stopped"}
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// cmdEvents prints the events of the running recorder as JSON lines until it stops
+func cmdEvents(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	flags.Parse(args)
+
+	return control.Stream(control.DefaultSocketPath(), "events", nil, func(data json.RawMessage) error {
+		_, err := fmt.Println(string(data))
+		return err
+	})
+}
+
+// cmdSearch lists the moments a window matching all search terms got focus
+func cmdSearch(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: dashcam search <text>...")
+	}
+
+	var terms []string
+	for _, term := range flags.Args() {
+		terms = append(terms, strings.ToLower(term))
+	}
+
+	segments, err := recorder.ListSegments(config)
+	if err != nil {
+		return err
+	}
+
+	var hits []catalog.Entry
+	var secret []byte
+	for _, segment := range segments {
+		// Encrypted recordings keep window titles and annotations sealed in their
+		// metadata; their annotations aren't in the catalog either
+		if len(segment.Meta.Sealed) > 0 {
+			if secret == nil {
+				if secret, err = crypt.LoadSecret(config.EncryptionKey); err != nil {
+					return err
+				}
+			}
+			if segment.Meta, err = segment.Meta.Unseal(secret); err != nil {
+				log.Printf("Warning: %s: %v", filepath.Base(segment.Path), err)
+				continue
+			}
+			for _, annotation := range segment.Meta.Annotations {
+				if !containsAll(strings.ToLower(annotation.Text), terms) {
+					continue
+				}
+				hits = append(hits, catalog.Entry{
+					Segment: filepath.Base(segment.Path),
+					Time:    segment.Meta.TimeAt(annotation.Offset),
+					Offset:  annotation.Offset,
+					Kind:    "note",
+					Text:    annotation.Text,
+				})
+			}
+		}
+		for _, sample := range segment.Meta.Windows {
+			text := strings.ToLower(sample.AppID + " " + sample.Title)
+			if !containsAll(text, terms) {
+				continue
+			}
+			hits = append(hits, catalog.Entry{
+				Segment: filepath.Base(segment.Path),
+				Time:    segment.Meta.TimeAt(sample.Offset),
+				Offset:  sample.Offset,
+				Kind:    "window",
+				Text:    sample.AppID + "  " + sample.Title,
+			})
+		}
+	}
+
+	// Text found on screen by the OCR indexer
+	entries, err := catalog.Open(filepath.Join(config.RecordingsDir, recorder.CatalogFilename)).Search(terms)
+	if err != nil {
+		return err
+	}
+	hits = append(hits, entries...)
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Time.Before(hits[j].Time)
+	})
+	for _, hit := range hits {
+		fmt.Printf("%s  %-6s %s  (%s +%ds)\n", hit.Time.Format("2006-01-02 15:04:05"),
+			hit.Kind, snippet(hit.Text, terms[0], 100), hit.Segment, int(hit.Offset))
+	}
+	return nil
+}
+
+// snippet returns up to width characters of text around the first occurrence of term
+func snippet(text string, term string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+
+	position := len([]rune(text[:max(strings.Index(strings.ToLower(text), term), 0)]))
+	start := max(min(position-width/4, len(runes)-width), 0)
+	result := string(runes[start : start+width])
+	if start > 0 {
+		result = "..." + result
+	}
+	if start+width < len(runes) {
+		result += "..."
+	}
+	return result
+}
+
+// containsAll reports whether text contains every term
+func containsAll(text string, terms []string) bool {
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// cmdList prints all recordings with their start time, length and size
+func cmdList(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	thumbs := flags.Bool("thumbs", false, "show the cached thumbnail of each recording")
+	minActivity := flags.Float64("min-activity", 0, "hide recordings with a lower activity score (0-1)")
+	flags.Parse(args)
+
+	segments, err := recorder.ListSegments(config)
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if segment.Idle(*minActivity) {
+			continue
+		}
+
+		size := int64(0)
+		if info, err := os.Stat(segment.Path); err == nil {
+			size = info.Size()
+		}
+		length := "?"
+		if !segment.Meta.End.IsZero() {
+			length = segment.Meta.End.Sub(segment.Meta.Start).Round(time.Second).String()
+		}
+
+		activity := "   -"
+		if segment.Meta.Activity != nil {
+			activity = fmt.Sprintf("%3.0f%%", *segment.Meta.Activity*100)
+		}
+
+		line := fmt.Sprintf("%s  %8s  %9s  %s  %s", segment.Meta.Start.Format("2006-01-02 15:04:05"),
+			length, recorder.FormatSize(size), activity, filepath.Base(segment.Path))
+		if *thumbs {
+			if path := thumbnail.Path(crypt.PlainName(segment.Path)); recorder.FileExists(path) {
+				line += "  " + path
+			}
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
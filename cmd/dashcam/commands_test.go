@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWhen(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	now := time.Date(2026, 10, 17, 14, 30, 0, 0, berlin)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", now},
+		{"now", now},
+		{"30s", now.Add(-30 * time.Second)},
+		{"-1h30m", now.Add(-90 * time.Minute)},
+		{"09:15", time.Date(2026, 10, 17, 9, 15, 0, 0, berlin)},
+		{"09:15:30", time.Date(2026, 10, 17, 9, 15, 30, 0, berlin)},
+		{"2026-10-16 23:59", time.Date(2026, 10, 16, 23, 59, 0, 0, berlin)},
+		{"2026-10-16 23:59:59", time.Date(2026, 10, 16, 23, 59, 59, 0, berlin)},
+		{"2026-10-16T21:00:00Z", time.Date(2026, 10, 16, 21, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := parseWhen(test.value, now)
+		if err != nil {
+			t.Errorf("parseWhen(%q): %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parseWhen(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "25:00", "2026-10-16", "1d"} {
+		if got, err := parseWhen(value, now); err == nil {
+			t.Errorf("parseWhen(%q) = %s, want an error", value, got)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"0d", 0},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+	}
+	for _, test := range tests {
+		got, err := parseAge(test.value)
+		if err != nil {
+			t.Errorf("parseAge(%q): %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseAge(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"", "d", "-3d", "1.5d", "-1h", "month"} {
+		if got, err := parseAge(value); err == nil {
+			t.Errorf("parseAge(%q) = %s, want an error", value, got)
+		}
+	}
+}
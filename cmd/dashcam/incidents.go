@@ -0,0 +1,90 @@
+package main
+
+import (
+	"dashcam/internal/control"
+	"dashcam/pkg/catalog"
+	"dashcam/pkg/recorder"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cmdIncidents lists protected recordings with their review state, by default
+// those still waiting for a decision
+func cmdIncidents(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("incidents", flag.ExitOnError)
+	state := flags.String("state", "open", "show incidents in this state: open (new or reviewed), "+strings.Join(recorder.ReviewStates, ", ")+" or all")
+	flags.Parse(args)
+	if *state != "open" && *state != "all" && !slices.Contains(recorder.ReviewStates, *state) {
+		return fmt.Errorf("unknown state '%s' (use open, %s or all)", *state, strings.Join(recorder.ReviewStates, ", "))
+	}
+
+	incidents, err := recorder.ListIncidents(config)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, incident := range incidents {
+		counts[incident.Review]++
+		switch {
+		case *state == "all":
+		case *state == "open" && incident.Open():
+		case *state == incident.Review:
+		default:
+			continue
+		}
+
+		length := "?"
+		if !incident.Meta.End.IsZero() {
+			length = incident.Meta.End.Sub(incident.Meta.Start).Round(time.Second).String()
+		}
+		fmt.Printf("%s  %8s  %-8s  %-20s  %s\n", incident.Meta.Start.Format("2006-01-02 15:04:05"),
+			length, incident.Review, incident.Marker, filepath.Base(incident.Path))
+	}
+
+	var summary []string
+	for _, review := range recorder.ReviewStates {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[review], review))
+	}
+	fmt.Printf("%d incidents: %s\n", len(incidents), strings.Join(summary, ", "))
+	return nil
+}
+
+// cmdReview moves incidents to another review state
+func cmdReview(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+	state := flags.String("state", recorder.ReviewReviewed, "the new state: "+strings.Join(recorder.ReviewStates, ", ")+", or "+recorder.ReviewDeleted+" to shred the recording")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: dashcam review [-state reviewed|archived|deleted|new] <segment>...")
+	}
+
+	// The recorder serializes deleting with its own retention cleanup and merging,
+	// so a review may wait for a merge to finish
+	socket := control.DefaultSocketPath()
+	running := control.Call(socket, "status", nil, &recorder.Status{}) == nil
+	cat := catalog.Open(filepath.Join(config.RecordingsDir, recorder.CatalogFilename))
+	for _, name := range flags.Args() {
+		path, err := resolveSegment(config, name)
+		if err != nil {
+			return err
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return err
+		}
+		if running {
+			err = control.CallTimeout(socket, "review", recorder.ReviewRequest{Path: path, State: *state}, nil, 0)
+		} else {
+			err = recorder.SetReview(config, cat, path, *state)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", filepath.Base(path), *state)
+	}
+	return nil
+}
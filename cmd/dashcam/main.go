@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"dashcam/internal/hotkey"
+	"dashcam/internal/session"
+	"dashcam/pkg/recorder"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// setupHotkeys registers the configured hotkeys with Hyprland.
+// Returns nil if no hotkeys are configured or Hyprland isn't available.
+func setupHotkeys(config recorder.Config, sr *recorder.ScreenRecorder) *hotkey.HotkeyManager {
+	bindings := map[string]hotkey.HotkeyCallback{}
+	if config.WipeHotkey != "" {
+		bindings[config.WipeHotkey] = func(string) { sr.RequestWipe() }
+	}
+	if config.MuteHotkey != "" {
+		bindings[config.MuteHotkey] = func(string) { sr.ToggleMute("hotkey") }
+	}
+	if config.EmergencyHotkey != "" {
+		bindings[config.EmergencyHotkey] = func(string) { sr.MarkEmergency("hotkey") }
+	}
+	if len(bindings) == 0 {
+		return nil
+	}
+	if sr.Headless() {
+		log.Printf("Warning: Running headless, hotkeys are disabled")
+		return nil
+	}
+
+	var manager *hotkey.HotkeyManager
+	var err error
+	switch desktop := session.Detect(); desktop {
+	case session.Hyprland:
+		manager, err = hotkey.NewHyprlandHotkeyManager()
+	case session.Sway:
+		manager, err = hotkey.NewSwayHotkeyManager()
+	default:
+		err = fmt.Errorf("%s has no supported hotkey backend (Hyprland or sway); bind `dashcam emergency` to a key in its settings instead", desktop)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not set up hotkeys: %v", err)
+		return nil
+	}
+
+	for key, callback := range bindings {
+		if _, err := manager.RegisterHotkey(key, callback); err != nil {
+			log.Printf("Warning: Could not register hotkey %s: %v", key, err)
+		}
+	}
+	manager.StartListening()
+	return manager
+}
+
+// shutdownContext returns the root context of the recorder, cancelled on the
+// first SIGINT, SIGTERM or SIGHUP. SIGHUP is sent when the terminal or session
+// we were started from goes away.
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig := <-signals
+		log.Println("Received shutdown signal. Stopping recorder...")
+		cancel(fmt.Errorf("signal: %v", sig))
+	}()
+	return ctx
+}
+
+func main() {
+	// Subcommands (play, export, ...) run and exit; no arguments starts recording
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	log.Printf("Loading configuration from %s...\n", recorder.ConfigFilename)
+
+	// Load configuration
+	config, err := recorder.LoadConfig()
+	if err != nil {
+		log.Printf("Warning: Could not load config, using defaults: %v", err)
+		config = recorder.DefaultConfig()
+	}
+
+	// Display current configuration
+	log.Printf("Configuration loaded:")
+	log.Printf("  Recordings directory: %s", config.RecordingsDir)
+	log.Printf("  Max files to keep: %d", config.MaxFiles)
+	log.Printf("  Recording length: %d seconds", config.RecordingLength)
+	log.Printf("  Codec: %s", config.Codec)
+	switch backend := config.CaptureBackendName(); {
+	case backend == "v4l2":
+		log.Printf("  Capture backend: v4l2 (%s)", config.V4L2Device)
+	case backend == "libcamera":
+		log.Printf("  Capture backend: libcamera (camera %d)", config.LibcameraCamera)
+	case config.CaptureDisplay != "":
+		log.Printf("  Capture backend: %s (display %s)", backend, config.CaptureDisplay)
+	case config.CaptureBackend == "auto":
+		log.Printf("  Capture backend: %s (detected %s)", backend, session.Detect())
+	default:
+		log.Printf("  Capture backend: %s", backend)
+	}
+	for _, s := range config.Sources {
+		log.Printf("  Additional source: %s", s.Name)
+	}
+	if config.PrerollSeconds > 0 {
+		log.Printf("  Pre-roll: last %d seconds in memory, saved on emergencies", config.PrerollSeconds)
+	}
+	log.Printf("  Audio recording enabled: %v", config.RecordAudio)
+	log.Printf("  Encryption enabled: %v", config.Encrypt)
+	log.Printf("  Permissions: files %s, directory %s", config.FileMode, config.DirMode)
+	if config.CalendarPath != "" {
+		log.Printf("  Calendar: %s (pause on '%s')", config.CalendarPath, config.CalendarTag)
+	}
+	if len(config.MaskRegions) > 0 {
+		log.Printf("  Masked regions: %d", len(config.MaskRegions))
+	}
+	if len(config.PauseOnApps) > 0 {
+		log.Printf("  Pause on apps: %s", strings.Join(config.PauseOnApps, ", "))
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Create and start screen recorder
+	sr, err := recorder.New(config)
+	if err != nil {
+		log.Fatalf("Cannot start recorder: %v", err)
+	}
+
+	// Hyprland hotkeys (panic wipe, mute toggle)
+	if manager := setupHotkeys(config, sr); manager != nil {
+		defer manager.Close()
+	}
+	if icon := setupTray(config, sr); icon != nil {
+		defer icon.Close()
+	}
+
+	ctx := shutdownContext()
+	log.Println("Press Ctrl+C to stop recording...")
+	if err := sr.Start(ctx); err != nil {
+		log.Fatalf("Screen recorder failed: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"dashcam/internal/attributes"
+	"dashcam/pkg/recorder"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// Manifest describes an export for handing footage to a third party: what was
+// exported, from which recordings, with which recorder and settings
+type Manifest struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	ExportedBy string          `json:"exported_by,omitempty"`
+	Hostname   string          `json:"hostname,omitempty"`
+	Version    string          `json:"version"`
+	Command    []string        `json:"command"`
+	Files      []ManifestEntry `json:"files"`
+	Config     recorder.Config `json:"config"`
+}
+
+// ManifestEntry is a single exported file and the recording it was made from
+type ManifestEntry struct {
+	File           string    `json:"file"` // relative to the manifest
+	Size           int64     `json:"size"`
+	SHA256         string    `json:"sha256"`
+	Source         string    `json:"source"`
+	SourceSize     int64     `json:"source_size"`
+	SourceSHA256   string    `json:"source_sha256"`             // of the stored (possibly encrypted) recording
+	RecordedSHA256 string    `json:"recorded_sha256,omitempty"` // of the stored recording when it was finished
+	Marker         string    `json:"marker,omitempty"`
+	Start          time.Time `json:"start,omitzero"`
+	End            time.Time `json:"end,omitzero"`
+	ClipStart      float64   `json:"clip_start,omitempty"`
+	ClipEnd        float64   `json:"clip_end,omitempty"`
+}
+
+// manifestName returns the file name of the manifest of an export made at the given time
+func manifestName(at time.Time) string {
+	return "dashcam-manifest-" + at.Format("2006-01-02_15-04-05") + ".json"
+}
+
+// newManifest starts a manifest for an export made now
+func newManifest(config recorder.Config, args []string) Manifest {
+	manifest := Manifest{
+		ExportedAt: time.Now(),
+		Version:    recorder.Version,
+		Command:    append([]string{"dashcam", "export"}, args...),
+		Config:     config,
+	}
+	if current, err := user.Current(); err == nil {
+		manifest.ExportedBy = current.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		manifest.Hostname = hostname
+	}
+	return manifest
+}
+
+// addFile hashes an exported file and the recording it was made from and adds them to the manifest
+func (m *Manifest) addFile(dir string, target string, source recorder.Segment, clipStart float64, clipEnd float64) error {
+	sum, size, err := hashFile(target)
+	if err != nil {
+		return err
+	}
+	sourceSum, sourceSize, err := hashFile(source.Path)
+	if err != nil {
+		return err
+	}
+	if source.Meta.SHA256 != "" && source.Meta.SHA256 != sourceSum {
+		log.Printf("Warning: %s changed since it was recorded (SHA-256 %s, recorded %s)", filepath.Base(source.Path), sourceSum, source.Meta.SHA256)
+	}
+	name, err := filepath.Rel(dir, target)
+	if err != nil {
+		name = target
+	}
+
+	entry := ManifestEntry{
+		File:           name,
+		Size:           size,
+		SHA256:         sum,
+		Source:         filepath.Base(source.Path),
+		SourceSize:     sourceSize,
+		SourceSHA256:   sourceSum,
+		RecordedSHA256: source.Meta.SHA256,
+		Start:          source.Meta.Start,
+		End:            source.Meta.End,
+		ClipStart:      clipStart,
+	}
+	if clipEnd >= 0 {
+		entry.ClipEnd = clipEnd
+	}
+	if value, err := attributes.GetMarker(source.Path, recorder.MarkerName); err == nil {
+		entry.Marker = value
+	}
+	m.Files = append(m.Files, entry)
+	return nil
+}
+
+// write stores the manifest in dir and returns its path and SHA-256 hash
+func (m *Manifest) write(dir string) (string, string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	path := filepath.Join(dir, manifestName(m.ExportedAt))
+	if err := os.WriteFile(path, append(data, '\n'), m.Config.FilePermissions()); err != nil {
+		return "", "", fmt.Errorf("failed to write manifest: %v", err)
+	}
+	sum := sha256.Sum256(append(data, '\n'))
+	return path, hex.EncodeToString(sum[:]), nil
+}
+
+// hashFile returns the hex SHA-256 hash and size of a file
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to hash %s: %v", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
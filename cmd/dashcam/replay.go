@@ -0,0 +1,255 @@
+package main
+
+import (
+	"dashcam/internal/crypt"
+	"dashcam/pkg/recorder"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cmdReplay plays the archive as one timeline from a wall-clock time: the
+// segment recorded at that moment is started at the matching offset and the
+// following ones are chained behind it in a playlist
+func cmdReplay(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	source := flags.String("source", "", "replay this additional source instead of the main one")
+	length := flags.Duration("length", 0, "only queue this much of the timeline (e.g. 1h); 0 plays to the end of the archive")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: dashcam replay [-source name] [-length 1h] <time>")
+	}
+
+	at, err := parseWhen(flags.Arg(0), time.Now())
+	if err != nil {
+		return err
+	}
+
+	all, err := recorder.ListSegments(config)
+	if err != nil {
+		return fmt.Errorf("failed to list recordings: %v", err)
+	}
+	var segments []recorder.Segment
+	for _, segment := range all {
+		if segment.Meta.Source == *source {
+			segments = append(segments, segment)
+		}
+	}
+
+	first, offset, err := replayStart(segments, at)
+	if err != nil {
+		return err
+	}
+	segments = segments[first:]
+	if *length > 0 {
+		until := segments[0].Meta.TimeAt(offset).Add(*length)
+		for i, segment := range segments {
+			if !segment.Meta.Start.Before(until) {
+				segments = segments[:i]
+				break
+			}
+		}
+	}
+
+	// Decrypted copies stay next to the recordings, where they get the same protection
+	dir, err := os.MkdirTemp(config.RecordingsDir, ".replay-*")
+	if err != nil {
+		return fmt.Errorf("failed to create replay directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue := &replayQueue{config: config, dir: dir, segments: segments, ready: make(map[int]string)}
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	for i, segment := range segments {
+		path, err := queue.path(i)
+		if err != nil {
+			return err
+		}
+		duration := -1
+		if !segment.Meta.End.IsZero() {
+			duration = int(segment.Meta.End.Sub(segment.Meta.Start).Seconds())
+		}
+		fmt.Fprintf(&playlist, "#EXTINF:%d,%s\n%s\n", duration, segment.Meta.Start.Local().Format("2006-01-02 15:04:05"), path)
+	}
+	playlistFile := filepath.Join(dir, "replay.m3u")
+	if err := os.WriteFile(playlistFile, []byte(playlist.String()), 0600); err != nil {
+		return err
+	}
+	if err := queue.prepare(0); err != nil {
+		return err
+	}
+
+	log.Printf("Replaying from %s: %s +%s, %d recordings queued",
+		segments[0].Meta.TimeAt(offset).Local().Format("2006-01-02 15:04:05"), filepath.Base(segments[0].Path),
+		time.Duration(offset*float64(time.Second)).Round(time.Second), len(segments))
+
+	// The start position only applies to the first recording (mpv)
+	playerArgs := []string{"--start=" + strconv.FormatFloat(offset, 'f', 3, 64), "--reset-on-next-file=start"}
+	socket := filepath.Join(dir, "player.sock")
+	if queue.encrypted() {
+		playerArgs = append(playerArgs, "--input-ipc-server="+socket)
+	}
+	cmd := exec.Command(config.Player, append(playerArgs, playlistFile)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("player %s failed: %v", config.Player, err)
+	}
+
+	// Encrypted recordings are decrypted as the player gets to them
+	followed := make(chan struct{})
+	go func() {
+		defer close(followed)
+		if queue.encrypted() {
+			queue.follow(socket)
+		}
+	}()
+	err = cmd.Wait()
+	<-followed
+	if err != nil {
+		return fmt.Errorf("player %s failed: %v", config.Player, err)
+	}
+	return nil
+}
+
+// replayAhead is how many recordings after the one playing are kept decrypted
+const replayAhead = 2
+
+// replayQueue decrypts the encrypted recordings of a replay shortly before the
+// player gets to them and removes them once it has moved on
+type replayQueue struct {
+	config   recorder.Config
+	dir      string
+	segments []recorder.Segment
+	ready    map[int]string // Decrypted copies by playlist position
+}
+
+// encrypted reports whether any recording of the replay is encrypted
+func (q *replayQueue) encrypted() bool {
+	for _, segment := range q.segments {
+		if crypt.IsEncrypted(segment.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns where the player finds the recording at a playlist position:
+// the recording itself, or where its decrypted copy will be
+func (q *replayQueue) path(i int) (string, error) {
+	path := q.segments[i].Path
+	if crypt.IsEncrypted(path) {
+		return filepath.Join(q.dir, fmt.Sprintf("%04d-%s", i, crypt.PlainName(filepath.Base(path)))), nil
+	}
+	return filepath.Abs(path)
+}
+
+// prepare decrypts the recordings from a playlist position on, up to replayAhead
+// after it, and removes the copies of those the player is done with. The one
+// before stays, so skipping back once doesn't hit a missing file.
+func (q *replayQueue) prepare(position int) error {
+	for i, plain := range q.ready {
+		if i < position-1 || i > position+replayAhead {
+			os.Remove(plain)
+			delete(q.ready, i)
+		}
+	}
+	for i := max(position, 0); i < len(q.segments) && i <= position+replayAhead; i++ {
+		if _, ok := q.ready[i]; ok || !crypt.IsEncrypted(q.segments[i].Path) {
+			continue
+		}
+		plain, err := q.path(i)
+		if err != nil {
+			return err
+		}
+		// The player mustn't open a half decrypted file
+		if err := exportSegment(q.config, q.segments[i].Path, plain+".part"); err != nil {
+			os.Remove(plain + ".part")
+			return fmt.Errorf("failed to decrypt %s: %v", filepath.Base(q.segments[i].Path), err)
+		}
+		if err := os.Rename(plain+".part", plain); err != nil {
+			return err
+		}
+		q.ready[i] = plain
+	}
+	return nil
+}
+
+// follow watches the playlist position through mpv's IPC socket and prepares
+// the recordings around it, until the player exits
+func (q *replayQueue) follow(socket string) {
+	var conn net.Conn
+	var err error
+	// The player creates the socket once it's up
+	for range 50 {
+		if conn, err = net.Dial("unix", socket); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		log.Printf("Warning: Could not follow the player (%v), only the first %d recordings are decrypted", err, replayAhead+1)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(`{"command": ["observe_property", 1, "playlist-pos"]}` + "\n")); err != nil {
+		log.Printf("Warning: Could not follow the player: %v", err)
+		return
+	}
+	decoder := json.NewDecoder(conn)
+	for {
+		var message struct {
+			Event string          `json:"event"`
+			Name  string          `json:"name"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			// The player exited
+			return
+		}
+		var position int
+		if message.Event != "property-change" || message.Name != "playlist-pos" || json.Unmarshal(message.Data, &position) != nil {
+			continue
+		}
+		if err := q.prepare(position); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// replayStart finds the segment recorded at a moment and the offset of the
+// moment into it. A moment in a gap (paused, or not running) starts at the
+// beginning of the next segment.
+func replayStart(segments []recorder.Segment, at time.Time) (int, float64, error) {
+	for i, segment := range segments {
+		if at.Before(segment.Meta.Start) {
+			if segment.Meta.Start.Sub(at) < time.Second {
+				return i, 0, nil
+			}
+			log.Printf("Nothing was recorded at %s, starting at %s",
+				at.Format("2006-01-02 15:04:05"), segment.Meta.Start.Local().Format("2006-01-02 15:04:05"))
+			return i, 0, nil
+		}
+		// Segments without an end (still recording, or recorded before metadata
+		// existed) last until the next one starts
+		end := segment.Meta.End
+		if i+1 < len(segments) && (end.IsZero() || segments[i+1].Meta.Start.Before(end)) {
+			end = segments[i+1].Meta.Start
+		}
+		if end.IsZero() || at.Before(end) {
+			return i, segment.Meta.OffsetAt(at), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("nothing was recorded at or after %s", at.Format("2006-01-02 15:04:05"))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"dashcam/internal/metadata"
+	"dashcam/pkg/recorder"
+	"testing"
+	"time"
+)
+
+func TestReplayStart(t *testing.T) {
+	base := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	minute := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	segments := []recorder.Segment{
+		{Meta: metadata.Segment{Start: minute(0), End: minute(5)}},
+		// Paused from 5 to 10
+		{Meta: metadata.Segment{Start: minute(10), End: minute(15)}},
+		// Recorded before metadata had an end
+		{Meta: metadata.Segment{Start: minute(15)}},
+		// Still recording
+		{Meta: metadata.Segment{Start: minute(20)}},
+	}
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		index  int
+		offset float64
+	}{
+		{"start of the archive", minute(0), 0, 0},
+		{"inside the first segment", minute(2).Add(30 * time.Second), 0, 150},
+		{"gap starts the next segment", minute(7), 1, 0},
+		{"before the archive", minute(-60), 0, 0},
+		{"segment without end", minute(17), 2, 120},
+		{"segment being recorded", minute(90), 3, 70 * 60},
+	}
+	for _, test := range tests {
+		index, offset, err := replayStart(segments, test.at)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if index != test.index || offset != test.offset {
+			t.Errorf("%s: segment %d at %gs, want segment %d at %gs", test.name, index, offset, test.index, test.offset)
+		}
+	}
+
+	if _, _, err := replayStart(segments[:2], minute(16)); err == nil {
+		t.Errorf("a time after the last recording was found")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/tray"
+	"dashcam/pkg/recorder"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// trayPauseReason is the pause reason of the tray menu's pause item
+const trayPauseReason = "tray"
+
+// recentIncidents is how many emergency recordings the tray menu offers to play
+const recentIncidents = 5
+
+// trayMenu keeps the tray icon and its menu in line with the recorder. It's
+// only updated from the recorder's event subscriber.
+type trayMenu struct {
+	config    recorder.Config
+	sr        *recorder.ScreenRecorder
+	icon      *tray.Tray
+	incidents []recorder.Segment // Most recent emergency recordings, newest first
+}
+
+// setupTray shows the recorder's state and controls in the system tray.
+// Returns nil if the tray icon is off or no session bus is available.
+func setupTray(config recorder.Config, sr *recorder.ScreenRecorder) *tray.Tray {
+	if !config.TrayIcon {
+		return nil
+	}
+	if sr.Headless() {
+		log.Printf("Warning: Running headless, the tray icon is disabled")
+		return nil
+	}
+
+	icon, err := tray.New("dashcam", "dashcam", "media-record")
+	if err != nil {
+		log.Printf("Warning: Could not show tray icon: %v", err)
+		return nil
+	}
+
+	menu := &trayMenu{config: config, sr: sr, icon: icon}
+	menu.loadIncidents()
+	menu.update()
+	sr.Subscribe(func(event recorder.Event) {
+		switch event.Kind {
+		case recorder.EventEmergency:
+			menu.loadIncidents()
+		case recorder.EventSegmentEnd:
+			// Segments marked during an emergency get their marker when they're finished
+			if event.Marker != recorder.MarkerEmergency {
+				return
+			}
+			menu.loadIncidents()
+		case recorder.EventStart, recorder.EventStop, recorder.EventPause, recorder.EventResume, recorder.EventMute, recorder.EventUnmute:
+		default:
+			return
+		}
+		menu.update()
+	})
+	return icon
+}
+
+// update shows the current state in the icon, its tool tip and the menu
+func (m *trayMenu) update() {
+	status := m.sr.Status()
+	icon, text := "media-record", "Recording"
+	switch status.State {
+	case "paused":
+		icon, text = "media-playback-pause", "Paused: "+strings.Join(status.PauseReasons, ", ")
+	case "stopped":
+		icon, text = "media-playback-stop", "Stopped"
+	}
+	if status.Muted {
+		text += " (audio muted)"
+	}
+	m.icon.SetIcon(icon, "dashcam", text, false)
+
+	pause := tray.Item{Label: "Pause recording", Action: func() { m.sr.Pause(trayPauseReason) }}
+	if slices.Contains(status.PauseReasons, trayPauseReason) {
+		pause = tray.Item{Label: "Resume recording", Action: func() { m.sr.Resume(trayPauseReason) }}
+	}
+
+	var incidents []tray.Item
+	for _, segment := range m.incidents {
+		label := segment.Meta.Start.Format("2006-01-02 15:04:05")
+		if segment.Meta.Source != "" {
+			label += " (" + segment.Meta.Source + ")"
+		}
+		path := segment.Path
+		incidents = append(incidents, tray.Item{Label: label, Action: func() { m.play(path) }})
+	}
+	if len(incidents) == 0 {
+		incidents = []tray.Item{{Label: "None", Disabled: true}}
+	}
+
+	m.icon.SetMenu([]tray.Item{
+		{Label: text, Disabled: true},
+		{Separator: true},
+		pause,
+		{Label: "Mark emergency", Action: func() { m.sr.MarkEmergency("tray") }},
+		{Separator: true},
+		{Label: "Open recordings folder", Action: m.openFolder},
+		{Label: "Recent incidents", Children: incidents},
+	})
+}
+
+// loadIncidents looks up the most recent emergency recordings
+func (m *trayMenu) loadIncidents() {
+	segments, err := recorder.ListSegments(m.config)
+	if err != nil {
+		// Nothing was recorded yet
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: Could not list recordings for the tray menu: %v", err)
+		}
+		return
+	}
+
+	m.incidents = nil
+	for i := len(segments) - 1; i >= 0 && len(m.incidents) < recentIncidents; i-- {
+		marker, err := attributes.GetMarker(segments[i].Path, recorder.MarkerName)
+		if err == nil && marker == recorder.MarkerEmergency {
+			m.incidents = append(m.incidents, segments[i])
+		}
+	}
+}
+
+// play plays a recording with `dashcam play`, which decrypts it if needed
+func (m *trayMenu) play(path string) {
+	self, err := os.Executable()
+	if err != nil {
+		log.Printf("Warning: Could not play %s: %v", path, err)
+		return
+	}
+	if err := exec.Command(self, "play", path).Run(); err != nil {
+		log.Printf("Warning: Could not play %s: %v", path, err)
+	}
+}
+
+// openFolder opens the recordings directory in the file manager
+func (m *trayMenu) openFolder() {
+	if err := exec.Command("xdg-open", m.config.RecordingsDir).Run(); err != nil {
+		log.Printf("Warning: Could not open %s: %v", m.config.RecordingsDir, err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/control"
+	"dashcam/pkg/recorder"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// waybarRetry is how long `dashcam waybar` waits before looking for a recorder
+// that isn't running again
+const waybarRetry = 5 * time.Second
+
+// waybarArchiveRefresh is how long the archive summary is reused while no event
+// changed the archive, to pick up changes made by other commands
+const waybarArchiveRefresh = time.Minute
+
+// archiveEvents are the events after which the archive summary is out of date
+var archiveEvents = map[string]bool{
+	recorder.EventSegmentEnd: true,
+	recorder.EventCleanup:    true,
+	recorder.EventMerge:      true,
+	recorder.EventEmergency:  true,
+}
+
+// waybarOutput is a line for a waybar custom module with "return-type": "json"
+type waybarOutput struct {
+	Text    string   `json:"text"`
+	Alt     string   `json:"alt"` // recording, paused, error or stopped, for format-icons
+	Tooltip string   `json:"tooltip"`
+	Class   []string `json:"class"`
+}
+
+// waybarPrinter prints the module's lines, skipping repeats
+type waybarPrinter struct {
+	last string
+}
+
+func (p *waybarPrinter) print(output waybarOutput) error {
+	data, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+	if string(data) == p.last {
+		return nil
+	}
+	p.last = string(data)
+	_, err = fmt.Println(p.last)
+	return err
+}
+
+// cmdWaybar prints the recorder state for a waybar custom module, as a JSON line
+// now and whenever it changes, following the recorder's events on the control
+// socket. With -once it prints a single line, for a module with an interval.
+func cmdWaybar(config recorder.Config, args []string) error {
+	flags := flag.NewFlagSet("waybar", flag.ExitOnError)
+	once := flags.Bool("once", false, "print the state once and exit")
+	flags.Parse(args)
+
+	socket := control.DefaultSocketPath()
+	var printer waybarPrinter
+	archive := &waybarArchive{config: config}
+	if *once {
+		return printer.print(waybarState(socket, "", archive.get(true)))
+	}
+
+	for {
+		// The error of a failed segment is shown until recording works again
+		lastError := ""
+		if err := printer.print(waybarState(socket, lastError, archive.get(false))); err != nil {
+			return err
+		}
+		var printErr error
+		control.Stream(socket, "events", nil, func(data json.RawMessage) error {
+			var event recorder.Event
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil
+			}
+			switch event.Kind {
+			case recorder.EventError:
+				lastError = event.Detail
+			case recorder.EventSegmentStart:
+				lastError = ""
+			}
+			printErr = printer.print(waybarState(socket, lastError, archive.get(archiveEvents[event.Kind])))
+			return printErr
+		})
+		// Waybar went away
+		if printErr != nil {
+			return printErr
+		}
+
+		// The recorder stopped or isn't running
+		if err := printer.print(waybarState(socket, "", archive.get(false))); err != nil {
+			return err
+		}
+		time.Sleep(waybarRetry)
+	}
+}
+
+// waybarState describes the state of the recorder at socket for waybar; lastError
+// is the latest recording error, if it's still unresolved, and archive the
+// summary of the recordings
+func waybarState(socket string, lastError string, archive []string) waybarOutput {
+	// Not running is a valid state for status bars, not an error
+	status := recorder.Status{State: "stopped"}
+	if err := control.Call(socket, "status", nil, &status); err != nil {
+		status = recorder.Status{State: "stopped"}
+	}
+
+	output := waybarOutput{Alt: status.State}
+	var tooltip []string
+	switch status.State {
+	case "recording":
+		output.Text = "REC"
+		tooltip = append(tooltip, "Recording since "+status.StartedAt.Local().Format("15:04"))
+	case "paused":
+		output.Text = "PAUSED"
+		tooltip = append(tooltip, "Paused: "+strings.Join(status.PauseReasons, ", "))
+	default:
+		output.Text = "OFF"
+		tooltip = append(tooltip, "dashcam is not running")
+	}
+	if lastError != "" && status.State != "stopped" {
+		output.Text = "ERROR"
+		output.Alt = "error"
+		tooltip = append(tooltip, "Recording failed: "+lastError)
+	}
+	output.Class = []string{output.Alt}
+	if status.Muted {
+		output.Class = append(output.Class, "muted")
+		tooltip = append(tooltip, "Audio muted")
+	}
+
+	if status.Segment != "" {
+		tooltip = append(tooltip, fmt.Sprintf("Current segment: %s (since %s)",
+			filepath.Base(status.Segment), status.SegmentStarted.Local().Format("15:04:05")))
+	}
+	tooltip = append(tooltip, archive...)
+	if status.Jobs > 0 {
+		tooltip = append(tooltip, fmt.Sprintf("%d post-processing jobs pending", status.Jobs))
+	}
+	output.Tooltip = strings.Join(tooltip, "\n")
+	return output
+}
+
+// waybarArchive keeps the archive summary between events that don't change the
+// archive, as a scan reads the marker of every recording
+type waybarArchive struct {
+	config  recorder.Config
+	summary []string
+	scanned time.Time
+}
+
+// get returns the archive summary, scanning the archive again if refresh is set
+// or the last scan is older than waybarArchiveRefresh
+func (a *waybarArchive) get(refresh bool) []string {
+	if refresh || a.summary == nil || time.Since(a.scanned) >= waybarArchiveRefresh {
+		a.summary = archiveSummary(a.config)
+		a.scanned = time.Now()
+	}
+	return a.summary
+}
+
+// archiveSummary describes the last finished segment and the disk usage of the
+// recordings
+func archiveSummary(config recorder.Config) []string {
+	files, err := attributes.ScanMarkedFiles(config.RecordingsDir, recorder.MarkerName)
+	if err != nil {
+		return []string{"No recordings"}
+	}
+
+	var size int64
+	var last attributes.MarkedFile
+	protected := 0
+	for _, file := range files {
+		size += file.Size
+		if file.ModTime.After(last.ModTime) {
+			last = file
+		}
+		if file.Marker != recorder.MarkerStandard {
+			protected++
+		}
+	}
+
+	var summary []string
+	if last.Path != "" {
+		summary = append(summary, fmt.Sprintf("Last segment: %s (%s)", filepath.Base(last.Path), last.ModTime.Format("15:04:05")))
+	}
+	usage := fmt.Sprintf("Disk: %s in %d recordings (%d protected)", recorder.FormatSize(size), len(files), protected)
+	if free, err := recorder.FreeSpace(config.RecordingsDir); err == nil {
+		usage += fmt.Sprintf(", %s free", recorder.FormatSize(free))
+	}
+	return append(summary, usage)
+}
@@ -2,4 +2,7 @@ module dashcam
 
 go 1.24
 
-require golang.org/x/sys v0.33.0
+require (
+	github.com/godbus/dbus/v5 v5.2.2
+	golang.org/x/sys v0.33.0
+)
@@ -5,14 +5,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-
-	"golang.org/x/sys/unix" // For extended attributes
+	"time"
 )
 
 func SetMarker(filePath string, attrName string, attrValue string) error {
 	// Attribute names for user-defined attributes should typically start with "user."
 	fullAttrName := "user." + attrName
-	err := unix.Setxattr(filePath, fullAttrName, []byte(attrValue), 0)
+	err := setAttr(filePath, fullAttrName, []byte(attrValue))
 	if err != nil {
 		return fmt.Errorf("failed to set xattr '%s' on '%s': %w", fullAttrName, filePath, err)
 	}
@@ -22,61 +21,69 @@ func SetMarker(filePath string, attrName string, attrValue string) error {
 
 func GetMarker(filePath string, attrName string) (string, error) {
 	fullAttrName := "user." + attrName
-	data := make([]byte, 256) // Adjust buffer size as needed, or get size first
-	sz, err := unix.Getxattr(filePath, fullAttrName, data)
+	data, found, err := getAttr(filePath, fullAttrName)
 	if err != nil {
-		if err == unix.ENODATA {
-			return "", nil // Attribute not found
-		}
 		return "", fmt.Errorf("failed to get xattr '%s' from '%s': %w", fullAttrName, filePath, err)
 	}
-	return string(data[:sz]), nil
+	if !found {
+		return "", nil // Attribute not found
+	}
+	return string(data), nil
 }
 
 func RemoveMarker(filePath string, attrName string) error {
 	fullAttrName := "user." + attrName
-	err := unix.Removexattr(filePath, fullAttrName)
+	found, err := removeAttr(filePath, fullAttrName)
 	if err != nil {
-		if err == unix.ENODATA {
-			return nil // Attribute not found, nothing to remove
-		}
 		return fmt.Errorf("failed to remove xattr '%s' from '%s': %w", fullAttrName, filePath, err)
 	}
+	if !found {
+		return nil // Attribute not found, nothing to remove
+	}
 	log.Printf("Removed marker '%s' from file: %s", fullAttrName, filePath)
 	return nil
 }
 
 func HasMarker(filePath string, attrName string) (bool, error) {
 	fullAttrName := "user." + attrName
-	//data := make([]byte, 1)
-	//
-	//_, err := unix.Getxattr(filePath, fullAttrName, data)
-	//if err != nil {
-	//	if err == unix.ENODATA {
-	//		return false, nil
-	//	}
-	//	return false, fmt.Errorf("failed to get xattr '%s' from '%s': %w", fullAttrName, filePath, err)
-	//}
-
-	valueData := make([]byte, 256)
-	sz, err := unix.Getxattr(filePath, fullAttrName, valueData)
+	valueData, found, err := getAttr(filePath, fullAttrName)
 	if err != nil {
-		if err == unix.ENODATA {
-			return false, nil
-		}
 		return false, fmt.Errorf("failed to get xattr value for '%s' from '%s': %w", fullAttrName, filePath, err)
 	}
-	return sz > 0, nil
+	return found && len(valueData) > 0, nil
 }
 
 func GetFilesWithMarker(directory string, attrName string) ([]string, error) {
-	markedFiles := []string{}
+	marked, err := ScanMarkedFiles(directory, attrName)
+	if err != nil {
+		return nil, err
+	}
 
+	markedFiles := make([]string, 0, len(marked))
+	for _, file := range marked {
+		markedFiles = append(markedFiles, file.Path)
+	}
+	return markedFiles, nil
+}
+
+// MarkedFile is a file carrying a marker, with what was read about it in one pass
+type MarkedFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Marker  string // Value of the marker
+}
+
+// ScanMarkedFiles returns the regular files in directory that carry a non-empty
+// attrName marker. Every file is stat'ed and its marker read once, so callers
+// can sort and filter the result without touching the file system again.
+func ScanMarkedFiles(directory string, attrName string) ([]MarkedFile, error) {
 	entries, err := os.ReadDir(directory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory '%s': %w", directory, err)
 	}
 
+	marked := []MarkedFile{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -92,15 +99,29 @@ func GetFilesWithMarker(directory string, attrName string) ([]string, error) {
 			continue
 		}
 
-		hasAttr, err := HasMarker(filePath, attrName)
+		value, err := GetMarker(filePath, attrName)
 		if err != nil {
 			log.Printf("Warning: Could not check marker for file '%s': %v", filePath, err)
 			continue
 		}
 
-		if hasAttr {
-			markedFiles = append(markedFiles, filePath)
+		if value != "" {
+			marked = append(marked, MarkedFile{Path: filePath, Size: fileInfo.Size(), ModTime: fileInfo.ModTime(), Marker: value})
 		}
 	}
-	return markedFiles, nil
+	return marked, nil
+}
+
+// Supported reports whether files in directory can carry user extended attributes
+// (alternate data streams on Windows). File systems such as FAT, and many NFS and
+// SMB mounts, can't.
+func Supported(directory string) bool {
+	probe, err := os.CreateTemp(directory, ".xattr-probe-*")
+	if err != nil {
+		return false
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	return setAttr(probe.Name(), "user.dashcam_probe", []byte("1")) == nil
 }
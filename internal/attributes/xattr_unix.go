@@ -0,0 +1,34 @@
+//go:build !windows
+
+package attributes
+
+import (
+	"golang.org/x/sys/unix" // For extended attributes
+)
+
+// setAttr stores an extended attribute
+func setAttr(filePath, name string, value []byte) error {
+	return unix.Setxattr(filePath, name, value, 0)
+}
+
+// getAttr reads an extended attribute; found is false if the file doesn't have it
+func getAttr(filePath, name string) (value []byte, found bool, err error) {
+	data := make([]byte, 256) // Markers are short
+	sz, err := unix.Getxattr(filePath, name, data)
+	if err == unix.ENODATA {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data[:sz], true, nil
+}
+
+// removeAttr removes an extended attribute; found is false if the file didn't have it
+func removeAttr(filePath, name string) (found bool, err error) {
+	err = unix.Removexattr(filePath, name)
+	if err == unix.ENODATA {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package attributes
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Windows has no extended attributes; NTFS alternate data streams
+// (file.mkv:user.dashcam) take their place. Like xattrs they stay with the file
+// when it's renamed or moved on the volume, and are lost when it's copied to a
+// file system without them.
+
+// streamName returns the name of the alternate data stream holding an attribute
+func streamName(filePath, name string) string {
+	return filePath + ":" + name
+}
+
+// setAttr stores an attribute in an alternate data stream
+func setAttr(filePath, name string, value []byte) error {
+	// Writing the stream would create a missing file
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	// The stream gets the permissions of its file, i.e. the configured file_mode
+	return os.WriteFile(streamName(filePath, name), value, info.Mode().Perm())
+}
+
+// getAttr reads an attribute; found is false if the file doesn't have it
+func getAttr(filePath, name string) (value []byte, found bool, err error) {
+	data, err := os.ReadFile(streamName(filePath, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// removeAttr removes an attribute; found is false if the file didn't have it
+func removeAttr(filePath, name string) (found bool, err error) {
+	err = os.Remove(streamName(filePath, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,445 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event represents a calendar event; for a recurring one, Start and End are
+// those of its first occurrence
+type Event struct {
+	Summary    string
+	Start      time.Time
+	End        time.Time
+	Categories []string
+	// Unsupported tells why the event's recurrence can't be expanded; only its
+	// first occurrence is active then
+	Unsupported string
+
+	uid          string
+	recurrence   *rule
+	exceptions   []time.Time // Occurrences left out (EXDATE) or moved (RECURRENCE-ID)
+	recurrenceID time.Time   // Set on a moved occurrence of a recurring event
+}
+
+// HasTag reports whether the event is tagged with the given category.
+// The summary is checked as well, since not every client can set categories.
+func (e Event) HasTag(tag string) bool {
+	tag = strings.ToLower(tag)
+	for _, category := range e.Categories {
+		if strings.ToLower(category) == tag {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(e.Summary), tag)
+}
+
+// Active reports whether the event (or one of its occurrences) is running at the given time
+func (e Event) Active(t time.Time) bool {
+	if e.recurrence == nil {
+		return !t.Before(e.Start) && t.Before(e.End)
+	}
+
+	length := e.End.Sub(e.Start)
+	active := false
+	e.recurrence.each(e.Start, func(start time.Time) bool {
+		if start.After(t) {
+			return false
+		}
+		if t.Before(start.Add(length)) && !slices.ContainsFunc(e.exceptions, start.Equal) {
+			active = true
+			return false
+		}
+		return true
+	})
+	return active
+}
+
+// Load reads events from an .ics file or from a directory of .ics files
+// (the vdir layout used by khal and vdirsyncer)
+func Load(path string) ([]Event, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat calendar '%s': %w", path, err)
+	}
+
+	if !info.IsDir() {
+		return loadFile(path)
+	}
+
+	var events []Event
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".ics") {
+			return nil
+		}
+		fileEvents, err := loadFile(p)
+		if err != nil {
+			return err
+		}
+		events = append(events, fileEvents...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ActiveTagged returns the first event with the given tag running at time t
+func ActiveTagged(events []Event, tag string, t time.Time) (Event, bool) {
+	for _, event := range events {
+		if event.HasTag(tag) && event.Active(t) {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
+// loadFile parses the VEVENT entries of a single .ics file
+func loadFile(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open calendar '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	events, err := parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar '%s': %w", path, err)
+	}
+	return events, nil
+}
+
+// parse reads the VEVENT entries of a calendar
+func parse(r io.Reader) ([]Event, error) {
+	// Unfold continuation lines (RFC 5545 section 3.1)
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var duration time.Duration
+	var allDay bool
+	// Open components, innermost last: an event's alarms (VALARM) have a
+	// SUMMARY and DURATION of their own, which must not end up on the event
+	var components []string
+
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+
+		switch {
+		case name == "BEGIN":
+			components = append(components, strings.ToUpper(value))
+			if strings.EqualFold(value, "VEVENT") {
+				current = &Event{}
+				duration = 0
+				allDay = false
+			}
+		case name == "END":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
+			}
+			if !strings.EqualFold(value, "VEVENT") {
+				continue
+			}
+			if current != nil && !current.Start.IsZero() {
+				// Without an end, an event on a date lasts the day and one at a time has no length
+				switch {
+				case !current.End.IsZero():
+				case duration > 0:
+					current.End = current.Start.Add(duration)
+				case allDay:
+					current.End = current.Start.AddDate(0, 0, 1)
+				default:
+					current.End = current.Start
+				}
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil || len(components) == 0 || components[len(components)-1] != "VEVENT":
+			continue
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "CATEGORIES":
+			for _, category := range splitList(value) {
+				current.Categories = append(current.Categories, strings.TrimSpace(unescape(category)))
+			}
+		case name == "UID":
+			current.uid = value
+		case name == "DTSTART":
+			if t, err := parseTime(value, params); err == nil {
+				current.Start = t
+				allDay = params["VALUE"] == "DATE" || len(value) == 8
+			}
+		case name == "DTEND":
+			if t, err := parseTime(value, params); err == nil {
+				current.End = t
+			}
+		case name == "DURATION":
+			duration = parseDuration(value)
+		case name == "RRULE":
+			recurrence, err := parseRule(value)
+			if err != nil {
+				current.Unsupported = err.Error()
+			}
+			current.recurrence = recurrence
+		case name == "RDATE":
+			current.Unsupported = "RDATE is not supported"
+		case name == "EXDATE":
+			for _, date := range strings.Split(value, ",") {
+				if t, err := parseTime(date, params); err == nil {
+					current.exceptions = append(current.exceptions, t)
+				}
+			}
+		case name == "RECURRENCE-ID":
+			if t, err := parseTime(value, params); err == nil {
+				current.recurrenceID = t
+			}
+		}
+	}
+
+	// A moved occurrence is an event of its own that replaces the regular one
+	for _, moved := range events {
+		if moved.recurrenceID.IsZero() {
+			continue
+		}
+		for i := range events {
+			if events[i].uid == moved.uid && events[i].recurrence != nil {
+				events[i].exceptions = append(events[i].exceptions, moved.recurrenceID)
+			}
+		}
+	}
+	for i := range events {
+		if events[i].Unsupported != "" {
+			events[i].recurrence = nil
+		}
+	}
+	return events, nil
+}
+
+// rule is the subset of RFC 5545 recurrence rules that is expanded: a
+// frequency with interval, count and end, and weekdays for daily and weekly rules
+type rule struct {
+	freq     string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval int
+	count    int       // 0 for no limit
+	until    time.Time // Zero for no limit
+	byDay    []time.Weekday
+}
+
+// weekdays maps the day names used in recurrence rules
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRule parses an RRULE value, or tells why it can't be expanded
+func parseRule(value string) (*rule, error) {
+	r := &rule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key = strings.ToUpper(key); key {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+			if r.freq != "DAILY" && r.freq != "WEEKLY" && r.freq != "MONTHLY" && r.freq != "YEARLY" {
+				return nil, fmt.Errorf("FREQ=%s is not supported", value)
+			}
+		case "INTERVAL", "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s %q", key, value)
+			}
+			if key == "INTERVAL" {
+				r.interval = n
+			} else {
+				r.count = n
+			}
+		case "UNTIL":
+			until, err := parseTime(value, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			if len(value) == 8 {
+				// A date includes the whole day
+				until = until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			r.until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("BYDAY=%s is not supported", value)
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		case "WKST":
+			// Weeks start on Monday, the default
+		default:
+			return nil, fmt.Errorf("%s is not supported", key)
+		}
+	}
+
+	if r.freq == "" {
+		return nil, fmt.Errorf("FREQ is missing")
+	}
+	if len(r.byDay) > 0 && r.freq != "DAILY" && r.freq != "WEEKLY" {
+		return nil, fmt.Errorf("BYDAY is not supported with FREQ=%s", r.freq)
+	}
+	return r, nil
+}
+
+// each calls fn with the start of every occurrence, the first one being start,
+// in order until fn returns false or the rule ends
+func (r *rule) each(start time.Time, fn func(time.Time) bool) {
+	count := 0
+	// emit reports whether to go on after the occurrence at t
+	emit := func(t time.Time) bool {
+		if (!r.until.IsZero() && t.After(r.until)) || (r.count > 0 && count >= r.count) {
+			return false
+		}
+		count++
+		return fn(t)
+	}
+	matches := func(t time.Time) bool {
+		return len(r.byDay) == 0 || t.Equal(start) || slices.Contains(r.byDay, t.Weekday())
+	}
+
+	for i := 0; ; i++ {
+		switch r.freq {
+		case "DAILY":
+			if t := start.AddDate(0, 0, i*r.interval); matches(t) && !emit(t) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(start.AddDate(0, 0, 7*i*r.interval)) {
+					return
+				}
+				continue
+			}
+			// The days of every interval-th week, starting with the week of start
+			monday := start.AddDate(0, 0, 7*i*r.interval-(int(start.Weekday())+6)%7)
+			for day := 0; day < 7; day++ {
+				if t := monday.AddDate(0, 0, day); !t.Before(start) && matches(t) && !emit(t) {
+					return
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			months := i * r.interval
+			if r.freq == "YEARLY" {
+				months *= 12
+			}
+			t := start.AddDate(0, months, 0)
+			// Months (or years) without the day, like the 31st or February 29th, are skipped
+			if t.Day() == start.Day() && !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// splitProperty splits a content line into name, parameters and value
+func splitProperty(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return "", nil, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			params[strings.ToUpper(key)] = strings.Trim(value, "\"")
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseTime parses DATE and DATE-TIME values, honouring TZID
+func parseTime(value string, params map[string]string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		return time.ParseInLocation("20060102", value, time.Local)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+
+	location := time.Local
+	if tzid, ok := params["TZID"]; ok {
+		if loc, err := time.LoadLocation(tzid); err == nil {
+			location = loc
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, location)
+}
+
+// parseDuration parses the subset of RFC 5545 durations used in practice (e.g. PT1H30M, P1D)
+func parseDuration(value string) time.Duration {
+	var total time.Duration
+	var number int
+	for _, r := range strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P") {
+		switch {
+		case r >= '0' && r <= '9':
+			number = number*10 + int(r-'0')
+		case r == 'W':
+			total += time.Duration(number) * 7 * 24 * time.Hour
+			number = 0
+		case r == 'D':
+			total += time.Duration(number) * 24 * time.Hour
+			number = 0
+		case r == 'H':
+			total += time.Duration(number) * time.Hour
+			number = 0
+		case r == 'M':
+			total += time.Duration(number) * time.Minute
+			number = 0
+		case r == 'S':
+			total += time.Duration(number) * time.Second
+			number = 0
+		}
+	}
+	return total
+}
+
+// splitList splits a list value on the commas that aren't escaped
+func splitList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, value[start:])
+}
+
+// unescape resolves the text escapes defined by RFC 5545
+func unescape(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
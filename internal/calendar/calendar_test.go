@@ -0,0 +1,239 @@
+package calendar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// calendar wraps events into a calendar with CRLF line endings
+func calendar(events ...string) string {
+	text := "BEGIN:VCALENDAR\nVERSION:2.0\n" + strings.Join(events, "") + "END:VCALENDAR\n"
+	return strings.ReplaceAll(text, "\n", "\r\n")
+}
+
+// at parses a UTC time in iCalendar form
+func at(value string) time.Time {
+	t, err := time.Parse("20060102T150405Z", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParse(t *testing.T) {
+	// Dates are in local time, the checked times in UTC
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.UTC
+
+	tests := []struct {
+		name   string
+		ics    string
+		want   []string // Summaries of the events, in order
+		active []string // Times at which the first event is active
+		idle   []string // Times at which it isn't
+	}{
+		{
+			name:   "start and end",
+			ics:    calendar("BEGIN:VEVENT\nSUMMARY:Standup\nDTSTART:20261019T090000Z\nDTEND:20261019T091500Z\nEND:VEVENT\n"),
+			want:   []string{"Standup"},
+			active: []string{"20261019T090000Z", "20261019T091459Z"},
+			idle:   []string{"20261019T085959Z", "20261019T091500Z"},
+		},
+		{
+			name:   "duration",
+			ics:    calendar("BEGIN:VEVENT\nSUMMARY:Review\nDTSTART:20261019T100000Z\nDURATION:PT1H30M\nEND:VEVENT\n"),
+			want:   []string{"Review"},
+			active: []string{"20261019T112959Z"},
+			idle:   []string{"20261019T113000Z"},
+		},
+		{
+			name: "timed start without end has no length",
+			ics:  calendar("BEGIN:VEVENT\nSUMMARY:Reminder\nDTSTART:20261019T100000Z\nEND:VEVENT\n"),
+			want: []string{"Reminder"},
+			idle: []string{"20261019T100000Z", "20261019T120000Z"},
+		},
+		{
+			name: "alarm doesn't change the event",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Call\nDTSTART:20261019T100000Z\nDTEND:20261019T103000Z\n" +
+				"BEGIN:VALARM\nSUMMARY:Alarm\nDURATION:PT5M\nTRIGGER:-PT10M\nEND:VALARM\nEND:VEVENT\n"),
+			want:   []string{"Call"},
+			active: []string{"20261019T102959Z"},
+			idle:   []string{"20261019T103000Z"},
+		},
+		{
+			name:   "lower case component names",
+			ics:    calendar("begin:vevent\nsummary:Lower\ndtstart:20261019T100000Z\ndtend:20261019T110000Z\nend:vevent\n"),
+			want:   []string{"Lower"},
+			active: []string{"20261019T103000Z"},
+		},
+		{
+			name:   "folded lines",
+			ics:    calendar("BEGIN:VEVENT\nSUMMARY:Long\n  title\nDTSTART:20261019T100000Z\nDTEND:20261019T110000Z\nEND:VEVENT\n"),
+			want:   []string{"Long title"},
+			active: []string{"20261019T100000Z"},
+		},
+		{
+			name: "event without start",
+			ics:  calendar("BEGIN:VEVENT\nSUMMARY:Broken\nEND:VEVENT\n"),
+			want: nil,
+		},
+		{
+			name: "daily with count",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Daily\nDTSTART:20261019T090000Z\nDTEND:20261019T100000Z\n" +
+				"RRULE:FREQ=DAILY;COUNT=3\nEND:VEVENT\n"),
+			want:   []string{"Daily"},
+			active: []string{"20261019T093000Z", "20261021T093000Z"},
+			idle:   []string{"20261020T103000Z", "20261022T093000Z", "20261018T093000Z"},
+		},
+		{
+			name: "weekly on weekdays until a date",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Focus\nDTSTART:20261019T130000Z\nDTEND:20261019T150000Z\n" +
+				"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20261030\nEND:VEVENT\n"),
+			want:   []string{"Focus"},
+			active: []string{"20261021T140000Z", "20261023T140000Z", "20261026T130000Z", "20261030T145959Z"},
+			idle:   []string{"20261020T140000Z", "20261024T140000Z", "20261102T140000Z"},
+		},
+		{
+			name: "every other week",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Sprint\nDTSTART:20261019T090000Z\nDTEND:20261019T100000Z\n" +
+				"RRULE:FREQ=WEEKLY;INTERVAL=2\nEND:VEVENT\n"),
+			want:   []string{"Sprint"},
+			active: []string{"20261102T090000Z", "20270111T090000Z"},
+			idle:   []string{"20261026T090000Z"},
+		},
+		{
+			name: "monthly skips months without the day",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Report\nDTSTART:20261031T090000Z\nDTEND:20261031T100000Z\n" +
+				"RRULE:FREQ=MONTHLY\nEND:VEVENT\n"),
+			want:   []string{"Report"},
+			active: []string{"20261231T090000Z"},
+			idle:   []string{"20261130T090000Z", "20261201T090000Z"},
+		},
+		{
+			name: "yearly on a date",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Anniversary\nDTSTART;VALUE=DATE:20261019\n" +
+				"RRULE:FREQ=YEARLY\nEND:VEVENT\n"),
+			want:   []string{"Anniversary"},
+			active: []string{"20281019T120000Z"},
+			idle:   []string{"20281020T120000Z"},
+		},
+		{
+			name: "excluded and moved occurrences",
+			ics: calendar("BEGIN:VEVENT\nUID:1@test\nSUMMARY:Daily\nDTSTART:20261019T090000Z\nDTEND:20261019T100000Z\n" +
+				"RRULE:FREQ=DAILY\nEXDATE:20261020T090000Z,20261021T090000Z\nEND:VEVENT\n" +
+				"BEGIN:VEVENT\nUID:1@test\nRECURRENCE-ID:20261022T090000Z\nSUMMARY:Daily (moved)\n" +
+				"DTSTART:20261022T150000Z\nDTEND:20261022T160000Z\nEND:VEVENT\n"),
+			want:   []string{"Daily", "Daily (moved)"},
+			active: []string{"20261019T090000Z", "20261023T090000Z"},
+			idle:   []string{"20261020T090000Z", "20261021T090000Z", "20261022T090000Z"},
+		},
+		{
+			name: "unsupported rule keeps the first occurrence",
+			ics: calendar("BEGIN:VEVENT\nSUMMARY:Board\nDTSTART:20261019T090000Z\nDTEND:20261019T100000Z\n" +
+				"RRULE:FREQ=MONTHLY;BYDAY=1MO\nEND:VEVENT\n"),
+			want:   []string{"Board"},
+			active: []string{"20261019T090000Z"},
+			idle:   []string{"20261102T090000Z"},
+		},
+	}
+
+	for _, test := range tests {
+		events, err := parse(strings.NewReader(test.ics))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		var summaries []string
+		for _, event := range events {
+			summaries = append(summaries, event.Summary)
+		}
+		if !reflect.DeepEqual(summaries, test.want) {
+			t.Errorf("%s: events %q, want %q", test.name, summaries, test.want)
+			continue
+		}
+		for _, value := range test.active {
+			if !events[0].Active(at(value)) {
+				t.Errorf("%s: not active at %s", test.name, value)
+			}
+		}
+		for _, value := range test.idle {
+			if events[0].Active(at(value)) {
+				t.Errorf("%s: active at %s", test.name, value)
+			}
+		}
+	}
+}
+
+func TestAllDayAndTimeZones(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	events, err := parse(strings.NewReader(calendar(
+		"BEGIN:VEVENT\nSUMMARY:Holiday\nDTSTART;VALUE=DATE:20261019\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nSUMMARY:Berlin\nDTSTART;TZID=Europe/Berlin:20261019T090000\nDTEND;TZID=Europe/Berlin:20261019T100000\nEND:VEVENT\n",
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("%d events, want 2", len(events))
+	}
+
+	holiday := events[0]
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	if !holiday.Start.Equal(start) || !holiday.End.Equal(start.AddDate(0, 0, 1)) {
+		t.Errorf("all-day event runs from %s to %s, want the whole of %s", holiday.Start, holiday.End, start)
+	}
+
+	if want := time.Date(2026, 10, 19, 9, 0, 0, 0, berlin); !events[1].Start.Equal(want) {
+		t.Errorf("TZID start = %s, want %s", events[1].Start, want)
+	}
+}
+
+func TestCategories(t *testing.T) {
+	events, err := parse(strings.NewReader(calendar(
+		"BEGIN:VEVENT\nSUMMARY:Dentist\nDTSTART:20261019T090000Z\nDTEND:20261019T100000Z\n" +
+			"CATEGORIES:Private,Doctor\\, dentist,Health\\\\\nEND:VEVENT\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+	want := []string{"Private", "Doctor, dentist", `Health\`}
+	if !reflect.DeepEqual(events[0].Categories, want) {
+		t.Errorf("categories %q, want %q", events[0].Categories, want)
+	}
+	for _, tag := range []string{"private", "Doctor, Dentist", "dentist"} {
+		if !events[0].HasTag(tag) {
+			t.Errorf("event isn't tagged %q", tag)
+		}
+	}
+	if events[0].HasTag("doctor") {
+		t.Errorf("event is tagged with part of a category")
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule        string
+		unsupported bool
+	}{
+		{"FREQ=DAILY", false},
+		{"FREQ=WEEKLY;BYDAY=MO,TU;WKST=MO", false},
+		{"FREQ=DAILY;INTERVAL=0", true},
+		{"FREQ=HOURLY", true},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", true},
+		{"FREQ=WEEKLY;BYDAY=-1FR", true},
+		{"FREQ=YEARLY;BYDAY=MO", true},
+		{"INTERVAL=2", true},
+	}
+	for _, test := range tests {
+		if _, err := parseRule(test.rule); (err != nil) != test.unsupported {
+			t.Errorf("parseRule(%q) = %v, want unsupported: %v", test.rule, err, test.unsupported)
+		}
+	}
+}
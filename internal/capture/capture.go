@@ -0,0 +1,169 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures the recording of a segment
+type Options struct {
+	Codec  string // ffmpeg encoder, e.g. libx265; empty for the backend's default
+	Filter string // ffmpeg filter graph applied to the video, e.g. masks
+	Format string // Container to write, e.g. mpegts; empty to go by the file name
+	Audio  bool
+
+	// Adaptive encodes only frames in which the picture changed, so a static
+	// screen costs next to no bitrate and activity gets the full frame rate
+	Adaptive bool
+
+	// Flush writes the data out as it's encoded, in pieces of the container of
+	// about this length that play without the index written at the end; 0 leaves
+	// it to the muxer
+	Flush time.Duration
+}
+
+// adaptiveFilter drops frames that hardly differ from the last one kept
+const adaptiveFilter = "mpdecimate"
+
+// ffmpegFilter returns the video filter graph for ffmpeg based backends (and
+// wf-recorder, which runs ffmpeg's filters), with filter (a backend's own
+// filters, possibly empty) applied first
+func (o Options) ffmpegFilter(filter string) string {
+	var filters []string
+	for _, f := range []string{filter, o.Filter} {
+		if f != "" {
+			filters = append(filters, f)
+		}
+	}
+	if o.Adaptive {
+		filters = append(filters, adaptiveFilter)
+	}
+	return strings.Join(filters, ",")
+}
+
+// ffmpegOutput returns the ffmpeg output options for writing filename: a
+// variable frame rate for adaptive encoding and the muxer settings for flushing
+func (o Options) ffmpegOutput(filename string) []string {
+	var args []string
+	if o.Adaptive {
+		args = append(args, "-fps_mode", "vfr")
+	}
+	if o.Flush <= 0 {
+		return args
+	}
+	args = append(args, "-flush_packets", "1")
+	switch o.container(filename) {
+	case "matroska", "webm":
+		// Clusters play without the cues written at the end
+		args = append(args, "-cluster_time_limit", strconv.FormatInt(o.Flush.Milliseconds(), 10))
+	case "mp4", "mov":
+		// Fragments carry their own index, a plain file has it in the moov atom at the end
+		args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof",
+			"-frag_duration", strconv.FormatInt(o.Flush.Microseconds(), 10))
+	}
+	return args
+}
+
+// container returns the ffmpeg muxer that writes filename
+func (o Options) container(filename string) string {
+	if o.Format != "" {
+		return o.Format
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mkv":
+		return "matroska"
+	case ".webm":
+		return "webm"
+	case ".mp4", ".m4v":
+		return "mp4"
+	case ".mov":
+		return "mov"
+	}
+	return ""
+}
+
+// Stdout is the file name that makes a backend write to its standard output;
+// Options.Format must be set with it
+const Stdout = "pipe:1"
+
+// Backend records video segments with an external program. The program must
+// write a playable file when it's stopped with Interrupt.
+type Backend interface {
+	// Name returns the name the backend is configured by
+	Name() string
+	// Check reports why the backend can't record, or nil if it can
+	Check() error
+	// Session reports whether the backend records the desktop session dashcam
+	// runs in, rather than a device or a virtual display
+	Session() bool
+	// Command returns the command that records into filename until interrupted
+	Command(ctx context.Context, filename string, options Options) *exec.Cmd
+}
+
+// Unfiltered is implemented by backends that can't apply Options.Filter, which
+// rules out mask regions
+type Unfiltered interface {
+	Unfiltered()
+}
+
+// FileOnly is implemented by backends that can only write into files, not to
+// Stdout, which rules out pre-roll
+type FileOnly interface {
+	FileOnly()
+}
+
+// backends lists the available backends by name
+var backends = map[string]func(Settings) Backend{
+	"wf-recorder": func(s Settings) Backend { return WFRecorder{Display: s.Display, Output: s.Output} },
+	"x11grab":     func(s Settings) Backend { return X11Grab{Display: s.Display} },
+	"portal":      func(Settings) Backend { return Portal{} },
+	"v4l2":        func(s Settings) Backend { return V4L2{Device: s.Device, Size: s.Size, Framerate: s.Framerate} },
+	"libcamera":   func(s Settings) Backend { return Libcamera{Camera: s.Camera, Size: s.Size, Framerate: s.Framerate} },
+	"testsrc":     func(s Settings) Backend { return Testsrc{Size: s.Size, Framerate: s.Framerate} },
+}
+
+// Settings holds the backend specific configuration
+type Settings struct {
+	Display string // Wayland socket or X display to record instead of the session's, e.g. wayland-1 or :99
+	Output  string // Output (monitor) for wf-recorder, e.g. HEADLESS-1; empty for the only or selected one
+
+	Device    string // Video device for v4l2, e.g. /dev/video0
+	Camera    int    // Camera index for libcamera
+	Size      string // Capture size for v4l2, libcamera and testsrc, e.g. 1280x720; empty for the default
+	Framerate int    // Capture rate for v4l2, libcamera and testsrc; 0 for the default
+
+	AudioDevice string // DirectShow audio device for the Windows backends; empty records no audio
+}
+
+// Names returns the names of all backends, sorted
+func Names() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the backend with the given name
+func New(name string, settings Settings) (Backend, error) {
+	backend, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown capture backend '%s' (use %s)", name, strings.Join(Names(), ", "))
+	}
+	return backend(settings), nil
+}
+
+// lookPath reports a missing program as a backend error
+func lookPath(program string) error {
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("%s not found, please install it first", program)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package capture
+
+import (
+	"os"
+	"syscall"
+)
+
+// Interrupt asks a recording program to finish its file and exit, like Ctrl+C
+func Interrupt(process *os.Process) error {
+	return process.Signal(syscall.SIGINT)
+}
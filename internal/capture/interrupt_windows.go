@@ -0,0 +1,17 @@
+//go:build windows
+
+package capture
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Interrupt asks a recording program to finish its file and exit. Windows can't
+// signal a single process; Ctrl+Break goes to the process group the backends
+// start their program in, which ffmpeg handles like Ctrl+C. This needs dashcam to
+// run in a console the program shares.
+func Interrupt(process *os.Process) error {
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(process.Pid))
+}
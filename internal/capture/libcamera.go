@@ -0,0 +1,100 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Libcamera records a Raspberry Pi camera with rpicam-vid (libcamera-vid on older
+// systems), which writes the segment itself through libav, e.g. as an embedded
+// vehicle dashcam. Audio comes from the default PulseAudio/PipeWire source.
+type Libcamera struct {
+	Camera    int
+	Size      string
+	Framerate int
+}
+
+// hardwareEncoder is the Pi's H.264 encoder; the Pi 5 has none and needs libx264
+const hardwareEncoder = "h264_v4l2m2m"
+
+// Name returns the name the backend is configured by
+func (Libcamera) Name() string {
+	return "libcamera"
+}
+
+// program returns the installed recording program
+func (Libcamera) program() string {
+	for _, name := range []string{"rpicam-vid", "libcamera-vid"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return "rpicam-vid"
+}
+
+// Check reports whether rpicam-vid or libcamera-vid is installed and the size is valid
+func (l Libcamera) Check() error {
+	if err := lookPath(l.program()); err != nil {
+		return err
+	}
+	if _, _, err := l.dimensions(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Session reports false: the camera records without a desktop session
+func (Libcamera) Session() bool {
+	return false
+}
+
+// Unfiltered marks that the camera stack can't apply ffmpeg filters
+func (Libcamera) Unfiltered() {}
+
+// dimensions splits the size into width and height; both are empty for the camera default
+func (l Libcamera) dimensions() (string, string, error) {
+	if l.Size == "" {
+		return "", "", nil
+	}
+	width, height, ok := strings.Cut(l.Size, "x")
+	if _, err := strconv.Atoi(width); !ok || err != nil {
+		return "", "", fmt.Errorf("invalid capture size %s (use WIDTHxHEIGHT)", l.Size)
+	}
+	if _, err := strconv.Atoi(height); err != nil {
+		return "", "", fmt.Errorf("invalid capture size %s (use WIDTHxHEIGHT)", l.Size)
+	}
+	return width, height, nil
+}
+
+// Command returns the rpicam-vid command for a segment. It stops on SIGINT and
+// finishes the file.
+func (l Libcamera) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	// The Pi can't encode H.265 in real time in software, so the default codec
+	// is replaced by the hardware encoder
+	encoder := options.Codec
+	if encoder == "" || encoder == "libx265" {
+		encoder = hardwareEncoder
+	}
+
+	format := options.Format
+	if format == "" {
+		format = "matroska"
+	}
+
+	args := []string{"--timeout", "0", "--nopreview", "--camera", strconv.Itoa(l.Camera),
+		"--codec", "libav", "--libav-format", format, "--libav-video-codec", encoder}
+	if width, height, _ := l.dimensions(); width != "" {
+		args = append(args, "--width", width, "--height", height)
+	}
+	if l.Framerate > 0 {
+		args = append(args, "--framerate", strconv.Itoa(l.Framerate))
+	}
+	if options.Audio {
+		args = append(args, "--libav-audio")
+	}
+	args = append(args, "--output", filename)
+	return exec.CommandContext(ctx, l.program(), args...)
+}
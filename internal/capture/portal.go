@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// Portal records the screen through the XDG desktop portal with
+// gpu-screen-recorder, for Wayland desktops without the wlroots screencopy
+// protocol such as GNOME and KDE Plasma. The desktop asks once which screen to
+// share; later segments restore that choice.
+type Portal struct{}
+
+// Name returns the name the backend is configured by
+func (Portal) Name() string {
+	return "portal"
+}
+
+// Check reports whether gpu-screen-recorder is installed
+func (Portal) Check() error {
+	return lookPath("gpu-screen-recorder")
+}
+
+// Session reports true: the portal shares the session's screen
+func (Portal) Session() bool {
+	return true
+}
+
+// Unfiltered marks that gpu-screen-recorder can't apply ffmpeg filters
+func (Portal) Unfiltered() {}
+
+// FileOnly marks that gpu-screen-recorder is only used to write files
+func (Portal) FileOnly() {}
+
+// Command returns the gpu-screen-recorder command for a segment
+func (Portal) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "gpu-screen-recorder", "-w", "portal", "-restore-portal-session", "yes", "-f", "30", "-o", filename)
+	if codec := portalCodec(options.Codec); codec != "" {
+		cmd.Args = append(cmd.Args, "-k", codec)
+	}
+	if options.Audio {
+		cmd.Args = append(cmd.Args, "-a", "default_input")
+	}
+	if options.Adaptive {
+		// Frames are only captured when the content of the screen changes
+		cmd.Args = append(cmd.Args, "-fm", "content")
+	}
+	return cmd
+}
+
+// portalCodec maps an ffmpeg encoder name onto the codecs gpu-screen-recorder
+// encodes on the GPU; anything else leaves the choice to it
+func portalCodec(codec string) string {
+	switch {
+	case strings.Contains(codec, "265"), strings.Contains(codec, "hevc"):
+		return "hevc"
+	case strings.Contains(codec, "264"):
+		return "h264"
+	case strings.Contains(codec, "av1"):
+		return "av1"
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// Test pattern defaults, where Settings leaves them empty
+const (
+	testsrcSize      = "1280x720"
+	testsrcFramerate = 30
+)
+
+// Testsrc records a generated test pattern (and a beeping tone for audio) with
+// ffmpeg instead of a screen or camera. It needs no display or device, so the
+// recorder can be tried out or tested end to end, e.g. in a CI container.
+type Testsrc struct {
+	Size      string
+	Framerate int
+}
+
+// Name returns the name the backend is configured by
+func (Testsrc) Name() string {
+	return "testsrc"
+}
+
+// Check reports whether ffmpeg is installed
+func (Testsrc) Check() error {
+	return lookPath("ffmpeg")
+}
+
+// Session reports false: the pattern is generated without a desktop session
+func (Testsrc) Session() bool {
+	return false
+}
+
+// Command returns the ffmpeg command for a segment. The sources are read in real
+// time (-re), as they'd otherwise be generated as fast as ffmpeg can encode.
+func (t Testsrc) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	size, framerate := t.Size, t.Framerate
+	if size == "" {
+		size = testsrcSize
+	}
+	if framerate <= 0 {
+		framerate = testsrcFramerate
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-re", "-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=%s:rate=%d", size, framerate)}
+	if options.Audio {
+		args = append(args, "-re", "-f", "lavfi", "-i", "sine=frequency=440:beep_factor=2", "-c:a", "libopus")
+	}
+	if filter := options.ffmpegFilter(""); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, options.ffmpegOutput(filename)...)
+	if options.Codec != "" {
+		args = append(args, "-c:v", options.Codec)
+	}
+	if options.Format != "" {
+		args = append(args, "-f", options.Format)
+	}
+	args = append(args, "-pix_fmt", "yuv420p", filename)
+	return exec.CommandContext(ctx, "ffmpeg", args...)
+}
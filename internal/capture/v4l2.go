@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// V4L2 records a Video4Linux device, such as a USB webcam or an HDMI capture
+// stick, with ffmpeg. Audio comes from the default PulseAudio/PipeWire source.
+type V4L2 struct {
+	Device    string
+	Size      string
+	Framerate int
+}
+
+// Name returns the name the backend is configured by
+func (V4L2) Name() string {
+	return "v4l2"
+}
+
+// Check reports whether ffmpeg is installed and the device exists
+func (v V4L2) Check() error {
+	if err := lookPath("ffmpeg"); err != nil {
+		return err
+	}
+	info, err := os.Stat(v.Device)
+	if err != nil {
+		return fmt.Errorf("video device %s: %w", v.Device, err)
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return fmt.Errorf("%s is not a video device", v.Device)
+	}
+	return nil
+}
+
+// Session reports false: the device records without a desktop session
+func (V4L2) Session() bool {
+	return false
+}
+
+// Command returns the ffmpeg command for a segment
+func (v V4L2) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-f", "v4l2"}
+	if v.Size != "" {
+		args = append(args, "-video_size", v.Size)
+	}
+	if v.Framerate > 0 {
+		args = append(args, "-framerate", strconv.Itoa(v.Framerate))
+	}
+	args = append(args, "-i", v.Device)
+	if options.Audio {
+		args = append(args, "-f", "pulse", "-i", "default", "-c:a", "libopus")
+	}
+	if filter := options.ffmpegFilter(""); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, options.ffmpegOutput(filename)...)
+	if options.Codec != "" {
+		args = append(args, "-c:v", options.Codec)
+	}
+	if options.Format != "" {
+		args = append(args, "-f", options.Format)
+	}
+	// Cameras often deliver 4:2:2, which many players can't decode
+	args = append(args, "-pix_fmt", "yuv420p", filename)
+	return exec.CommandContext(ctx, "ffmpeg", args...)
+}
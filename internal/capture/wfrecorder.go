@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// WFRecorder records the screen of a wlroots-based Wayland compositor with
+// wf-recorder: the session's, or a headless compositor (e.g. sway with
+// WLR_BACKENDS=headless) given by Display
+type WFRecorder struct {
+	Display string
+	Output  string
+}
+
+// Name returns the name the backend is configured by
+func (WFRecorder) Name() string {
+	return "wf-recorder"
+}
+
+// Check reports whether wf-recorder is installed and there's a compositor to record
+func (w WFRecorder) Check() error {
+	if err := lookPath("wf-recorder"); err != nil {
+		return err
+	}
+	if w.Display == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return fmt.Errorf("WAYLAND_DISPLAY not set - set capture_display to record a headless compositor")
+	}
+	return nil
+}
+
+// Session reports whether the session's compositor is recorded
+func (w WFRecorder) Session() bool {
+	return w.Display == ""
+}
+
+// Command returns the wf-recorder command for a segment
+//
+// wf-recorder runs ffmpeg's filters, so Options.Adaptive adds the same filter
+// as for the ffmpeg backends; the frame rate is variable anyway, as every frame
+// keeps the time it was captured at. It can't be told how to mux, so
+// Options.Flush is left to the recorder's syncing.
+func (w WFRecorder) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "wf-recorder", "-f", filename)
+	if w.Output != "" {
+		cmd.Args = append(cmd.Args, "-o", w.Output)
+	}
+	if options.Codec != "" {
+		cmd.Args = append(cmd.Args, "-c", options.Codec)
+	}
+	if filter := options.ffmpegFilter(""); filter != "" {
+		cmd.Args = append(cmd.Args, "-F", filter)
+	}
+	if options.Format != "" {
+		cmd.Args = append(cmd.Args, "-m", options.Format)
+	}
+	if options.Audio {
+		cmd.Args = append(cmd.Args, "-a")
+	}
+	if w.Display != "" {
+		cmd.Env = append(os.Environ(), "WAYLAND_DISPLAY="+w.Display)
+	}
+	return cmd
+}
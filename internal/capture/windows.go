@@ -0,0 +1,98 @@
+//go:build windows
+
+package capture
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+func init() {
+	backends["ddagrab"] = func(s Settings) Backend { return DDAGrab{AudioDevice: s.AudioDevice} }
+	backends["gdigrab"] = func(s Settings) Backend { return GDIGrab{AudioDevice: s.AudioDevice} }
+}
+
+// windowsFramerate is the rate the Windows backends capture the desktop at
+const windowsFramerate = "30"
+
+// DDAGrab records the primary monitor through the Desktop Duplication API
+// (ffmpeg 6.1 or later), which is cheap and captures hardware accelerated windows
+type DDAGrab struct {
+	AudioDevice string
+}
+
+// Name returns the name the backend is configured by
+func (DDAGrab) Name() string {
+	return "ddagrab"
+}
+
+// Check reports whether ffmpeg is installed
+func (DDAGrab) Check() error {
+	return lookPath("ffmpeg")
+}
+
+// Session reports true: the desktop of the logged in user is recorded
+func (DDAGrab) Session() bool {
+	return true
+}
+
+// Command returns the ffmpeg command for a segment
+func (d DDAGrab) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	input := []string{"-f", "lavfi", "-i", "ddagrab=output_idx=0:framerate=" + windowsFramerate}
+	// The frames stay on the GPU; encoders and filters other than the hardware
+	// ones need them in system memory
+	return windowsCommand(ctx, input, "hwdownload,format=bgra", d.AudioDevice, filename, options)
+}
+
+// GDIGrab records the whole desktop through GDI. It works with any ffmpeg build
+// and Windows version, but costs more CPU than ddagrab.
+type GDIGrab struct {
+	AudioDevice string
+}
+
+// Name returns the name the backend is configured by
+func (GDIGrab) Name() string {
+	return "gdigrab"
+}
+
+// Check reports whether ffmpeg is installed
+func (GDIGrab) Check() error {
+	return lookPath("ffmpeg")
+}
+
+// Session reports true: the desktop of the logged in user is recorded
+func (GDIGrab) Session() bool {
+	return true
+}
+
+// Command returns the ffmpeg command for a segment
+func (g GDIGrab) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	input := []string{"-f", "gdigrab", "-framerate", windowsFramerate, "-i", "desktop"}
+	return windowsCommand(ctx, input, "", g.AudioDevice, filename, options)
+}
+
+// windowsCommand builds the ffmpeg command shared by the Windows backends; filter
+// is applied before the filters of the options
+func windowsCommand(ctx context.Context, input []string, filter, audioDevice, filename string, options Options) *exec.Cmd {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-nostdin"}, input...)
+	if options.Audio && audioDevice != "" {
+		args = append(args, "-f", "dshow", "-i", "audio="+audioDevice, "-c:a", "libopus")
+	}
+	if filter := options.ffmpegFilter(filter); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, options.ffmpegOutput(filename)...)
+	if options.Codec != "" {
+		args = append(args, "-c:v", options.Codec)
+	}
+	if options.Format != "" {
+		args = append(args, "-f", options.Format)
+	}
+	args = append(args, "-pix_fmt", "yuv420p", filename)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	// A process group of its own lets Interrupt reach ffmpeg alone
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	return cmd
+}
@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// X11Grab records an X display with ffmpeg: the session's, or a virtual one such
+// as Xvfb on a CI machine or kiosk given by Display. Audio comes from the default
+// PulseAudio/PipeWire source.
+type X11Grab struct {
+	Display string
+}
+
+// Name returns the name the backend is configured by
+func (X11Grab) Name() string {
+	return "x11grab"
+}
+
+// display returns the X display to record
+func (x X11Grab) display() string {
+	if x.Display != "" {
+		return x.Display
+	}
+	return os.Getenv("DISPLAY")
+}
+
+// Check reports whether ffmpeg is installed and there's a display to record
+func (x X11Grab) Check() error {
+	if err := lookPath("ffmpeg"); err != nil {
+		return err
+	}
+	if x.display() == "" {
+		return fmt.Errorf("DISPLAY not set - set capture_display to record a virtual display")
+	}
+	return nil
+}
+
+// Session reports whether the session's display is recorded
+func (x X11Grab) Session() bool {
+	return x.Display == ""
+}
+
+// Command returns the ffmpeg command for a segment
+func (x X11Grab) Command(ctx context.Context, filename string, options Options) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-f", "x11grab", "-i", x.display()}
+	if options.Audio {
+		args = append(args, "-f", "pulse", "-i", "default", "-c:a", "libopus")
+	}
+	if filter := options.ffmpegFilter(""); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, options.ffmpegOutput(filename)...)
+	if options.Codec != "" {
+		args = append(args, "-c:v", options.Codec)
+	}
+	if options.Format != "" {
+		args = append(args, "-f", options.Format)
+	}
+	args = append(args, "-pix_fmt", "yuv420p", filename)
+	return exec.CommandContext(ctx, "ffmpeg", args...)
+}
@@ -0,0 +1,305 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Handler processes a command and returns a JSON-serializable result
+type Handler func(args json.RawMessage) (any, error)
+
+// StreamHandler answers a command with any number of results, passing each to
+// send, until it returns or send fails because the client went away
+type StreamHandler func(args json.RawMessage, send func(any) error) error
+
+// Request is sent by clients, one JSON object per line
+type Request struct {
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+// Response is returned by the server, one JSON object per line
+type Response struct {
+	OK    bool            `json:"ok"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Server answers commands on a unix socket
+type Server struct {
+	path          string
+	listener      net.Listener
+	handlers      map[string]Handler
+	streams       map[string]StreamHandler
+	handlersMutex sync.RWMutex
+}
+
+// RuntimeDir returns the per-user runtime directory ($XDG_RUNTIME_DIR or a /tmp fallback)
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return fallbackDir()
+}
+
+// fallbackDir is the runtime directory without $XDG_RUNTIME_DIR
+func fallbackDir() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("dashcam-%d", os.Getuid()))
+}
+
+// EnsureDir creates a directory for runtime files (e.g. RuntimeDir) if it
+// doesn't exist yet, see checkDir
+func EnsureDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return checkDir(dir)
+}
+
+// checkDir refuses the /tmp fallback of RuntimeDir unless it's a directory of the
+// current user that nobody else can access: another user could have created it
+// first, to plant a socket of their own or symlinks to files to overwrite
+func checkDir(dir string) error {
+	if filepath.Clean(dir) != fallbackDir() {
+		return nil
+	}
+	if err := checkPrivate(dir); err != nil {
+		return fmt.Errorf("refusing to use %s: %w", dir, err)
+	}
+	return nil
+}
+
+// DefaultSocketPath returns the location of the control socket
+func DefaultSocketPath() string {
+	return filepath.Join(RuntimeDir(), "dashcam.sock")
+}
+
+// NewServer creates a control server listening on the given socket
+func NewServer(path string) (*Server, error) {
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %v", err)
+	}
+
+	// A socket left over from a crashed instance blocks Listen; only remove it if nobody answers
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another dashcam instance is listening on %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to secure %s: %v", path, err)
+	}
+
+	return &Server{
+		path:     path,
+		listener: listener,
+		handlers: make(map[string]Handler),
+		streams:  make(map[string]StreamHandler),
+	}, nil
+}
+
+// Handle registers a handler for a command
+func (s *Server) Handle(command string, handler Handler) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.handlers[command] = handler
+}
+
+// HandleStream registers a handler for a command that streams results; the
+// connection is closed when it returns
+func (s *Server) HandleStream(command string, handler StreamHandler) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+	s.streams[command] = handler
+}
+
+// Serve accepts connections until the server is closed
+func (s *Server) Serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // Listener closed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and removes the socket
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// serveConn answers requests on a single connection
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var request Request
+		response := Response{}
+
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response.Error = fmt.Sprintf("invalid request: %v", err)
+		} else if stream := s.stream(request.Command); stream != nil {
+			s.serveStream(stream, request, encoder)
+			return
+		} else {
+			response = s.dispatch(request)
+		}
+
+		if err := encoder.Encode(response); err != nil {
+			log.Printf("Warning: Could not answer control request: %v", err)
+			return
+		}
+	}
+}
+
+// stream returns the stream handler for a command, or nil
+func (s *Server) stream(command string) StreamHandler {
+	s.handlersMutex.RLock()
+	defer s.handlersMutex.RUnlock()
+	return s.streams[command]
+}
+
+// serveStream runs a stream handler, sending every result as a response line
+func (s *Server) serveStream(stream StreamHandler, request Request, encoder *json.Encoder) {
+	err := stream(request.Args, func(result any) error {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to encode result: %v", err)
+		}
+		return encoder.Encode(Response{OK: true, Data: data})
+	})
+	if err != nil {
+		encoder.Encode(Response{Error: err.Error()})
+	}
+}
+
+// dispatch runs the handler for a request
+func (s *Server) dispatch(request Request) Response {
+	s.handlersMutex.RLock()
+	handler, exists := s.handlers[request.Command]
+	s.handlersMutex.RUnlock()
+
+	if !exists {
+		return Response{Error: fmt.Sprintf("unknown command: %s", request.Command)}
+	}
+
+	result, err := handler(request.Args)
+	if err != nil {
+		return Response{Error: err.Error()}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return Response{Error: fmt.Sprintf("failed to encode result: %v", err)}
+	}
+	return Response{OK: true, Data: data}
+}
+
+// dial connects to the server at path
+func dial(path string) (net.Conn, error) {
+	// Without the directory there's no server either
+	if err := checkDir(filepath.Dir(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("dashcam is not running (cannot connect to %s)", path)
+	}
+	return conn, nil
+}
+
+// Call sends a command to the server at path and decodes the result into result (if not nil)
+func Call(path string, command string, args any, result any) error {
+	return CallTimeout(path, command, args, result, 30*time.Second)
+}
+
+// CallTimeout is Call for commands that may take longer, giving up after timeout.
+// A timeout of 0 waits for the result however long it takes (e.g. a merge).
+func CallTimeout(path string, command string, args any, result any, timeout time.Duration) error {
+	conn, err := dial(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	request := Request{Command: command}
+	if args != nil {
+		if request.Args, err = json.Marshal(args); err != nil {
+			return err
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return fmt.Errorf("failed to send command: %v", err)
+	}
+
+	var response Response
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if !response.OK {
+		return fmt.Errorf("%s", response.Error)
+	}
+	if result != nil && len(response.Data) > 0 {
+		return json.Unmarshal(response.Data, result)
+	}
+	return nil
+}
+
+// Stream sends a streaming command to the server at path and calls handle with
+// every result until the server ends the stream or handle fails
+func Stream(path string, command string, args any, handle func(json.RawMessage) error) error {
+	conn, err := dial(path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	request := Request{Command: command}
+	if args != nil {
+		if request.Args, err = json.Marshal(args); err != nil {
+			return err
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return fmt.Errorf("failed to send command: %v", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var response Response
+		if err := decoder.Decode(&response); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+		if !response.OK {
+			return fmt.Errorf("%s", response.Error)
+		}
+		if err := handle(response.Data); err != nil {
+			return err
+		}
+	}
+}
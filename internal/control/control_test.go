@@ -0,0 +1,168 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// serve starts a server on a socket in a temporary directory
+func serve(t *testing.T) (*Server, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dashcam.sock")
+	server, err := NewServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+	return server, path
+}
+
+func TestCall(t *testing.T) {
+	server, path := serve(t)
+	server.Handle("echo", func(args json.RawMessage) (any, error) {
+		var values map[string]int
+		if err := json.Unmarshal(args, &values); err != nil {
+			return nil, err
+		}
+		values["sum"] = values["a"] + values["b"]
+		return values, nil
+	})
+	server.Handle("fail", func(args json.RawMessage) (any, error) {
+		return nil, errors.New("not recording")
+	})
+
+	var result map[string]int
+	if err := Call(path, "echo", map[string]int{"a": 1, "b": 2}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"a": 1, "b": 2, "sum": 3}; !reflect.DeepEqual(result, want) {
+		t.Errorf("echo = %v, want %v", result, want)
+	}
+	if err := Call(path, "fail", nil, nil); err == nil || err.Error() != "not recording" {
+		t.Errorf("fail = %v, want the handler's error", err)
+	}
+	if err := Call(path, "nope", nil, nil); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("unknown command = %v", err)
+	}
+	if err := Call(filepath.Join(t.TempDir(), "missing.sock"), "echo", nil, nil); err == nil {
+		t.Errorf("calling a missing socket succeeded")
+	}
+}
+
+func TestFraming(t *testing.T) {
+	server, path := serve(t)
+	server.Handle("ping", func(args json.RawMessage) (any, error) {
+		return "pong", nil
+	})
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// One request per line; a broken line is answered and the connection stays usable
+	fmt.Fprint(conn, "{\"command\":\"ping\"}\n{not json\n{\"command\":\"ping\",\"args\":{}}\n")
+	reader := bufio.NewReader(conn)
+	var responses []Response
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("response %d: %v", i+1, err)
+		}
+		var response Response
+		if err := json.Unmarshal([]byte(line), &response); err != nil {
+			t.Fatalf("response %d isn't one JSON line: %q", i+1, line)
+		}
+		responses = append(responses, response)
+	}
+	if !responses[0].OK || string(responses[0].Data) != `"pong"` {
+		t.Errorf("first response = %+v, want pong", responses[0])
+	}
+	if responses[1].OK || !strings.HasPrefix(responses[1].Error, "invalid request") {
+		t.Errorf("broken request answered with %+v", responses[1])
+	}
+	if !responses[2].OK {
+		t.Errorf("request after the broken one answered with %+v", responses[2])
+	}
+}
+
+func TestStream(t *testing.T) {
+	server, path := serve(t)
+	server.HandleStream("count", func(args json.RawMessage, send func(any) error) error {
+		for i := 1; i <= 3; i++ {
+			if err := send(i); err != nil {
+				return err
+			}
+		}
+		if string(args) == `"fail"` {
+			return errors.New("stopped")
+		}
+		return nil
+	})
+
+	var got []int
+	collect := func(data json.RawMessage) error {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		got = append(got, n)
+		return nil
+	}
+	if err := Stream(path, "count", nil, collect); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("streamed %v, want %v", got, want)
+	}
+
+	got = nil
+	if err := Stream(path, "count", "fail", collect); err == nil || err.Error() != "stopped" {
+		t.Errorf("failing stream = %v, want the handler's error", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("%d results before the error, want 3", len(got))
+	}
+}
+
+func TestSecondServer(t *testing.T) {
+	_, path := serve(t)
+	if second, err := NewServer(path); err == nil {
+		second.Close()
+		t.Errorf("a second server took over a socket that's in use")
+	}
+}
+
+func TestFallbackDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the temporary directory is private on Windows")
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+	dir := fallbackDir()
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDir(dir); err == nil {
+		t.Errorf("a fallback directory others can read was accepted")
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDir(dir); err != nil {
+		t.Errorf("the private fallback directory was refused: %v", err)
+	}
+}
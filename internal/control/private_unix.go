@@ -0,0 +1,28 @@
+//go:build !windows
+
+package control
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivate checks that dir is a directory (not a symlink to one) owned by
+// the current user with mode 0700
+func checkPrivate(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("owned by another user")
+	}
+	if info.Mode().Perm() != 0700 {
+		return fmt.Errorf("mode is %o instead of 700", info.Mode().Perm())
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package control
+
+// checkPrivate does nothing on Windows, where the temporary directory belongs
+// to the user already
+func checkPrivate(dir string) error {
+	return nil
+}
@@ -0,0 +1,248 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Extension is appended to the names of encrypted segments
+const Extension = ".enc"
+
+// PassphraseEnv names the environment variable used when no key file is configured
+const PassphraseEnv = "DASHCAM_PASSPHRASE"
+
+// File layout:
+//
+//	magic | salt (16) | base nonce (12) | chunk...
+//	chunk = plaintext length (4, big endian) | final flag (1) | AES-256-GCM ciphertext
+//
+// The chunk header is authenticated as additional data and the nonce is the base
+// nonce XOR the chunk counter, so chunks can't be reordered, dropped or truncated.
+var magic = []byte("DASHCAM-ENC1\n")
+
+const (
+	saltSize   = 16
+	nonceSize  = 12
+	chunkSize  = 1 << 20
+	iterations = 600000
+)
+
+// LoadSecret reads the secret from the key file, or from DASHCAM_PASSPHRASE if keyFile is empty
+func LoadSecret(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("no encryption key file configured and %s is not set", PassphraseEnv)
+		}
+		return []byte(passphrase), nil
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file '%s': %w", keyFile, err)
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("key file '%s' is empty", keyFile)
+	}
+	return secret, nil
+}
+
+// IsEncrypted reports whether the file starts with the encryption header
+func IsEncrypted(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, magic)
+}
+
+// PlainName strips the encryption extension from a file name
+func PlainName(path string) string {
+	return strings.TrimSuffix(path, Extension)
+}
+
+// EncryptFile encrypts src into dst
+func EncryptFile(src string, dst string, secret []byte) error {
+	return transformFile(src, dst, secret, Encrypt)
+}
+
+// DecryptFile decrypts src into dst
+func DecryptFile(src string, dst string, secret []byte) error {
+	return transformFile(src, dst, secret, Decrypt)
+}
+
+// transformFile runs fn from src to dst, removing dst on failure
+func transformFile(src string, dst string, secret []byte, fn func(io.Reader, io.Writer, []byte) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(in, out, secret); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// Encrypt streams r into w in encrypted form
+func Encrypt(r io.Reader, w io.Writer, secret []byte) error {
+	salt := make([]byte, saltSize)
+	baseNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(baseNonce); err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(secret, salt)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(append(append(append([]byte{}, magic...), salt...), baseNonce...)); err != nil {
+		return err
+	}
+
+	// Read one chunk ahead so we know which chunk is the last one
+	current := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+	n, err := io.ReadFull(r, current)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	for counter := uint64(0); ; counter++ {
+		m := 0
+		if n == chunkSize {
+			m, err = io.ReadFull(r, next)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+		}
+		final := m == 0
+
+		header := chunkHeader(n, final)
+		sealed := aead.Seal(nil, chunkNonce(baseNonce, counter), current[:n], header)
+		if _, err := w.Write(append(header, sealed...)); err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+		current, next = next, current
+		n = m
+	}
+}
+
+// Decrypt streams the encrypted r into w in plain form
+func Decrypt(r io.Reader, w io.Writer, secret []byte) error {
+	prefix := make([]byte, len(magic)+saltSize+nonceSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if !bytes.Equal(prefix[:len(magic)], magic) {
+		return errors.New("not an encrypted dashcam file")
+	}
+	salt := prefix[len(magic) : len(magic)+saltSize]
+	baseNonce := prefix[len(magic)+saltSize:]
+
+	aead, err := newAEAD(secret, salt)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 5)
+	buf := make([]byte, chunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("encrypted file is truncated: %w", err)
+		}
+		n := int(binary.BigEndian.Uint32(header))
+		if n > chunkSize {
+			return errors.New("encrypted file is corrupt")
+		}
+
+		sealed := buf[:n+aead.Overhead()]
+		if _, err := io.ReadFull(r, sealed); err != nil {
+			return fmt.Errorf("encrypted file is truncated: %w", err)
+		}
+
+		plain, err := aead.Open(sealed[:0], chunkNonce(baseNonce, counter), sealed, header)
+		if err != nil {
+			return errors.New("decryption failed - wrong key or corrupt file")
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+
+		if header[4] == 1 {
+			return nil
+		}
+	}
+}
+
+// newAEAD derives the file key from the secret and salt
+func newAEAD(secret []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkHeader encodes the plaintext length and final flag of a chunk
+func chunkHeader(n int, final bool) []byte {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header, uint32(n))
+	if final {
+		header[4] = 1
+	}
+	return header
+}
+
+// chunkNonce derives the nonce of a chunk from the base nonce
+func chunkNonce(baseNonce []byte, counter uint64) []byte {
+	nonce := append([]byte{}, baseNonce...)
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	for i := range c {
+		nonce[nonceSize-8+i] ^= c[i]
+	}
+	return nonce
+}
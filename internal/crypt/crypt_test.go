@@ -0,0 +1,107 @@
+package crypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+var secret = []byte("correct horse battery staple")
+
+// encrypt returns the encrypted form of plain
+func encrypt(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	var encrypted bytes.Buffer
+	if err := Encrypt(bytes.NewReader(plain), &encrypted, secret); err != nil {
+		t.Fatal(err)
+	}
+	return encrypted.Bytes()
+}
+
+// pattern returns n bytes that differ from chunk to chunk
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/chunkSize)
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, 1000, chunkSize, chunkSize + 1, 2*chunkSize + 17} {
+		plain := pattern(size)
+		encrypted := encrypt(t, plain)
+		if !bytes.HasPrefix(encrypted, magic) {
+			t.Errorf("%d bytes: encrypted data doesn't start with the header", size)
+		}
+
+		var decrypted bytes.Buffer
+		if err := Decrypt(bytes.NewReader(encrypted), &decrypted, secret); err != nil {
+			t.Errorf("%d bytes: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Errorf("%d bytes: decrypted data differs from the original", size)
+		}
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	encrypted := encrypt(t, pattern(2*chunkSize+17))
+	header := len(magic) + saltSize + nonceSize
+	secondChunk := header + 5 + chunkSize + 16
+
+	tests := []struct {
+		name   string
+		data   []byte
+		secret []byte
+	}{
+		{"wrong key", encrypted, []byte("wrong")},
+		{"not encrypted", []byte("plain text that is long enough to hold a header"), secret},
+		{"truncated header", encrypted[:header-1], secret},
+		{"truncated chunk", encrypted[:len(encrypted)-1], secret},
+		{"last chunk missing", encrypted[:secondChunk+5+chunkSize+16], secret},
+		{"flipped byte", flip(encrypted, header+100), secret},
+		{"flipped final flag", flip(encrypted, header+4), secret},
+		{"chunks swapped", swapChunks(encrypted, header, secondChunk), secret},
+	}
+	for _, test := range tests {
+		if err := Decrypt(bytes.NewReader(test.data), &bytes.Buffer{}, test.secret); err == nil {
+			t.Errorf("%s: decryption succeeded", test.name)
+		}
+	}
+}
+
+// flip returns a copy of data with the byte at i inverted
+func flip(data []byte, i int) []byte {
+	flipped := bytes.Clone(data)
+	flipped[i] ^= 0xff
+	return flipped
+}
+
+// swapChunks returns a copy of data with the full chunks at a and b swapped
+func swapChunks(data []byte, a int, b int) []byte {
+	size := 5 + chunkSize + 16
+	swapped := bytes.Clone(data)
+	copy(swapped[a:a+size], data[b:b+size])
+	copy(swapped[b:b+size], data[a:a+size])
+	return swapped
+}
+
+func TestIsEncryptedAndPlainName(t *testing.T) {
+	path := t.TempDir() + "/segment.mkv" + Extension
+	if IsEncrypted(path) {
+		t.Errorf("a missing file is reported as encrypted")
+	}
+	if err := EncryptFile("crypt_test.go", path, secret); err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(path) {
+		t.Errorf("%s isn't reported as encrypted", path)
+	}
+	if IsEncrypted("crypt_test.go") {
+		t.Errorf("a plain file is reported as encrypted")
+	}
+	if got, want := PlainName(path), path[:len(path)-len(Extension)]; got != want {
+		t.Errorf("PlainName(%q) = %q, want %q", path, got, want)
+	}
+}
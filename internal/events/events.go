@@ -0,0 +1,138 @@
+// Package events distributes what happens in the recorder (segments, marks,
+// pauses, errors, cleanup, ...) to everything that reacts to it: the journal,
+// notifications, status updates, uploads and API clients.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Event kinds. Most are written to the event journal under the same name.
+const (
+	Start            = "start"
+	Stop             = "stop"
+	Pause            = "pause"
+	Resume           = "resume"
+	Mute             = "mute"
+	Unmute           = "unmute"
+	Annotate         = "annotate"
+	Emergency        = "emergency"
+	Merge            = "merge"
+	Upload           = "upload"
+	ScreenShareStart = "screen_share_start"
+	ScreenShareEnd   = "screen_share_end"
+	SegmentStart     = "segment_start"
+	SegmentEnd       = "segment_end"
+	Cleanup          = "cleanup"
+	Error            = "error"
+	JobQueued        = "job_queued"
+	JobDone          = "job_done"
+)
+
+// Event is something that happened in the recorder
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Detail  string    `json:"detail,omitempty"`
+	Segment string    `json:"segment,omitempty"` // Path of the segment the event is about
+	Source  string    `json:"source,omitempty"`  // Recording source of the segment; empty for the main one
+	Marker  string    `json:"marker,omitempty"`  // Marker of the segment
+}
+
+// queueSize is how many events a subscriber may fall behind before events are dropped
+const queueSize = 256
+
+// subscriber receives events in order on a goroutine of its own
+type subscriber struct {
+	handle func(Event)
+	queue  chan Event
+	done   chan struct{}
+}
+
+// Bus delivers published events to all subscribers. Publishing never blocks on a
+// slow subscriber; one that falls too far behind misses events.
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+	closed      bool
+	done        chan struct{}
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*subscriber]bool), done: make(chan struct{})}
+}
+
+// Subscribe calls handle for every event published from now on, until the
+// returned function is called or the bus is closed
+func (b *Bus) Subscribe(handle func(Event)) (unsubscribe func()) {
+	s := &subscriber{handle: handle, queue: make(chan Event, queueSize), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		for event := range s.queue {
+			handle(event)
+		}
+	}()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		close(s.queue)
+		return func() {}
+	}
+	b.subscribers[s] = true
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if b.subscribers[s] {
+			delete(b.subscribers, s)
+			close(s.queue)
+		}
+	}
+}
+
+// Publish sends an event to all subscribers, stamping it with the current time
+// if it has none
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.subscribers {
+		select {
+		case s.queue <- event:
+		default:
+			log.Printf("Warning: Event subscriber is falling behind, dropping %s event", event.Kind)
+		}
+	}
+}
+
+// Close stops accepting events and waits until every subscriber has handled the
+// events it was sent
+func (b *Bus) Close() {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return
+	}
+	subscribers := b.subscribers
+	b.subscribers = make(map[*subscriber]bool)
+	b.closed = true
+	b.mutex.Unlock()
+
+	for s := range subscribers {
+		close(s.queue)
+		<-s.done
+	}
+	close(b.done)
+}
+
+// Done is closed once the bus is closed and every event has been handled
+func (b *Bus) Done() <-chan struct{} {
+	return b.done
+}
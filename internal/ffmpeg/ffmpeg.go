@@ -0,0 +1,756 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Available reports whether the ffmpeg binary can be found
+func Available() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// Run executes ffmpeg quietly with the given arguments, overwriting outputs
+func Run(args ...string) error {
+	cmd := exec.Command("ffmpeg", append([]string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %v, output: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Output executes ffmpeg with info logging and returns what it printed.
+// Analysis filters (freezedetect, scdet, ...) report their findings in the log.
+func Output(args ...string) (string, error) {
+	cmd := exec.Command("ffmpeg", append([]string{"-hide_banner", "-loglevel", "info", "-nostdin", "-y"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %v, output: %s", err, lastLines(string(output), 5))
+	}
+	return string(output), nil
+}
+
+// lastLines returns the last n lines of text, where ffmpeg puts its error
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Span is a time range in seconds from the start of a file
+type Span struct {
+	Start float64
+	End   float64
+}
+
+// MuteAudio writes a copy of src to dst with all audio silenced during the spans.
+// Video is stream-copied; only the audio has to be re-encoded.
+func MuteAudio(src string, dst string, spans []Span) error {
+	var conditions []string
+	for _, span := range spans {
+		conditions = append(conditions, fmt.Sprintf("between(t,%.3f,%.3f)", span.Start, span.End))
+	}
+	filter := fmt.Sprintf("volume=enable='%s':volume=0", strings.Join(conditions, "+"))
+
+	return Run("-i", src, "-map", "0", "-c", "copy", "-c:a", "aac", "-af", filter, dst)
+}
+
+// Chapter marks the start of a named section, in seconds from the start of a file
+type Chapter struct {
+	Start float64
+	Title string
+}
+
+// Embed describes extra data to mux into a file
+type Embed struct {
+	Chapters     []Chapter
+	Duration     float64           // Length of the file, ends the last chapter
+	SubtitleFile string            // SRT file to add as subtitle track
+	Tags         map[string]string // Container metadata, written as TAGS in Matroska
+}
+
+// Empty reports whether there is nothing to embed
+func (e Embed) Empty() bool {
+	return len(e.Chapters) == 0 && e.SubtitleFile == "" && len(e.Tags) == 0
+}
+
+// Remux writes a stream copy of src to dst with the chapters and subtitles added
+func Remux(src string, dst string, embed Embed) error {
+	args := []string{"-i", src}
+	maps := []string{"-map", "0"}
+	inputs := 1
+
+	if len(embed.Chapters) > 0 {
+		metaFile, err := WriteChapters(embed.Chapters, embed.Duration)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(metaFile)
+		args = append(args, "-i", metaFile)
+		maps = append(maps, "-map_metadata", "0", "-map_chapters", fmt.Sprint(inputs))
+		inputs++
+	}
+
+	if embed.SubtitleFile != "" {
+		args = append(args, "-i", embed.SubtitleFile)
+		maps = append(maps, "-map", fmt.Sprint(inputs))
+		inputs++
+	}
+
+	args = append(args, maps...)
+	args = append(args, "-c", "copy")
+	keys := make([]string, 0, len(embed.Tags))
+	for key := range embed.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+embed.Tags[key])
+	}
+	if embed.SubtitleFile != "" {
+		// MP4 only supports mov_text subtitles
+		codec := "srt"
+		if ext := strings.ToLower(filepath.Ext(dst)); ext == ".mp4" || ext == ".mov" {
+			codec = "mov_text"
+		}
+		args = append(args, "-c:s", codec, "-metadata:s:s:0", "title=dashcam")
+	}
+	args = append(args, dst)
+
+	return Run(args...)
+}
+
+// WriteChapters writes the chapters to a temporary FFMETADATA file.
+// Each chapter lasts until the next one starts; the last one until duration.
+func WriteChapters(chapters []Chapter, duration float64) (string, error) {
+	var meta strings.Builder
+	meta.WriteString(";FFMETADATA1\n")
+	for i, chapter := range chapters {
+		end := duration
+		if i+1 < len(chapters) {
+			end = chapters[i+1].Start
+		}
+		if end <= chapter.Start {
+			continue
+		}
+		fmt.Fprintf(&meta, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(chapter.Start*1000), int64(end*1000), escapeMetadata(chapter.Title))
+	}
+
+	metaFile, err := os.CreateTemp("", "dashcam-chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	if _, err := metaFile.WriteString(meta.String()); err != nil {
+		metaFile.Close()
+		os.Remove(metaFile.Name())
+		return "", err
+	}
+	metaFile.Close()
+	return metaFile.Name(), nil
+}
+
+// escapeMetadata escapes the characters with special meaning in FFMETADATA files
+func escapeMetadata(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+	return replacer.Replace(value)
+}
+
+// Thumbnail extracts a single frame at the given second as JPEG, scaled to width
+func Thumbnail(src string, dst string, at float64, width int) error {
+	return Run("-ss", fmt.Sprintf("%.3f", at), "-i", src, "-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", width), "-q:v", "4", dst)
+}
+
+// SpriteSheet renders columns x rows frames spread evenly over the file into one JPEG
+func SpriteSheet(src string, dst string, duration float64, columns int, rows int, width int) error {
+	if duration <= 0 {
+		return fmt.Errorf("unknown duration")
+	}
+	fps := float64(columns*rows) / duration
+	filter := fmt.Sprintf("fps=%.6f,scale=%d:-2,tile=%dx%d", fps, width, columns, rows)
+	return Run("-i", src, "-vf", filter, "-frames:v", "1", "-q:v", "5", dst)
+}
+
+// Analysis is what one decoding pass over a recording found
+type Analysis struct {
+	Activity *float64  // Share of the time (0 to 1) the picture changed; nil if not asked for
+	Scenes   []float64 // Seconds at which the picture changed noticeably
+}
+
+// Analyze decodes a recording once for its activity score (if activity is set)
+// and its scene changes (if sceneThreshold, a scdet score from 0 to 100, is
+// positive), on a downscaled copy of the video. With src "pipe:0" the recording
+// is read from input, so the caller can share its own read of the file.
+//
+// Activity is based on frame differences at 1 fps, scene changes on the scdet
+// filter at the full rate.
+func Analyze(src string, input io.Reader, duration float64, activity bool, sceneThreshold float64) (Analysis, error) {
+	if activity && duration <= 0 {
+		return Analysis{}, fmt.Errorf("unknown duration")
+	}
+	const freeze = "fps=1,freezedetect=n=-50dB:d=2"
+	scenes := fmt.Sprintf("scdet=t=%g", sceneThreshold)
+
+	args := []string{"-hide_banner", "-loglevel", "info", "-nostdin", "-y", "-i", src, "-an"}
+	switch {
+	case activity && sceneThreshold > 0:
+		args = append(args, "-filter_complex", "[0:v]scale=320:-2,split[a][s];[a]"+freeze+"[freeze];[s]"+scenes+"[scenes]",
+			"-map", "[freeze]", "-f", "null", "-", "-map", "[scenes]", "-f", "null", "-")
+	case activity:
+		args = append(args, "-vf", "scale=320:-2,"+freeze, "-f", "null", "-")
+	case sceneThreshold > 0:
+		args = append(args, "-vf", "scale=320:-2,"+scenes, "-f", "null", "-")
+	default:
+		return Analysis{}, nil
+	}
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return Analysis{}, fmt.Errorf("ffmpeg failed: %v, output: %s", err, lastLines(string(output), 5))
+	}
+
+	var analysis Analysis
+	frozen := 0.0
+	freezeStart := -1.0
+	for _, line := range strings.Split(string(output), "\n") {
+		if value, ok := logValue(line, "lavfi.freezedetect.freeze_start:"); ok {
+			freezeStart = value
+		} else if value, ok := logValue(line, "lavfi.freezedetect.freeze_end:"); ok && freezeStart >= 0 {
+			frozen += value - freezeStart
+			freezeStart = -1
+		} else if value, ok := logValue(line, "lavfi.scd.time:"); ok {
+			analysis.Scenes = append(analysis.Scenes, value)
+		}
+	}
+	if activity {
+		// Still frozen when the file ended
+		if freezeStart >= 0 {
+			frozen += duration - freezeStart
+		}
+		score := min(max(1-frozen/duration, 0), 1)
+		analysis.Activity = &score
+	}
+	return analysis, nil
+}
+
+// logValue extracts the number following key in an ffmpeg log line
+func logValue(line string, key string) (float64, bool) {
+	_, rest, found := strings.Cut(line, key)
+	if !found {
+		return 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	return value, err == nil
+}
+
+// ExtractFrames writes one PNG frame every interval seconds into dir (frame-0001.png, ...).
+// Frame n (counting from 1) shows the picture at (n-1)*interval seconds.
+func ExtractFrames(src string, dir string, interval float64) ([]string, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid frame interval")
+	}
+
+	pattern := filepath.Join(dir, "frame-%04d.png")
+	if err := Run("-i", src, "-an", "-vf", fmt.Sprintf("fps=1/%.3f:round=down", interval), pattern); err != nil {
+		return nil, err
+	}
+	return filepath.Glob(filepath.Join(dir, "frame-*.png"))
+}
+
+// ExtractAudio writes the audio track of src as the 16 kHz mono WAV file speech recognizers expect
+func ExtractAudio(src string, dst string) error {
+	return Run("-i", src, "-vn", "-ac", "1", "-ar", "16000", "-c:a", "pcm_s16le", dst)
+}
+
+// AudioFormats maps the formats audio tracks can be exported as to their encoder
+var AudioFormats = map[string]string{
+	"wav":  "pcm_s16le",
+	"opus": "libopus",
+}
+
+// AudioTracks returns the number of audio streams in src
+func AudioTracks(src string) (int, error) {
+	output, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "a",
+		"-show_entries", "stream=index", "-of", "csv=p=0", src).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed on '%s': %v", src, err)
+	}
+	return len(strings.Fields(string(output))), nil
+}
+
+// ExtractTrack writes audio track n (counting from 0) of src to dst in the given
+// format (see AudioFormats)
+func ExtractTrack(src string, dst string, track int, format string) error {
+	encoder, ok := AudioFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown audio format '%s'", format)
+	}
+	return Run("-i", src, "-map", fmt.Sprintf("0:a:%d", track), "-c:a", encoder, "-f", format, dst)
+}
+
+// DropAudio writes src to dst without the given audio tracks (counting from 0),
+// copying everything else
+func DropAudio(src string, dst string, tracks []int) error {
+	args := []string{"-i", src, "-map", "0"}
+	for _, track := range tracks {
+		args = append(args, "-map", fmt.Sprintf("-0:a:%d", track))
+	}
+	return Run(append(args, "-c", "copy", dst)...)
+}
+
+// Duration returns the length of a media file in seconds, as reported by ffprobe
+func Duration(src string) (float64, error) {
+	output, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", src).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed on '%s': %v", src, err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+}
+
+// Concat joins files with identical stream layouts into dst without re-encoding.
+// The list of files for ffmpeg is kept next to dst.
+func Concat(srcs []string, dst string) error {
+	list, err := os.CreateTemp(filepath.Dir(dst), ".dashcam-concat-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+
+	for _, src := range srcs {
+		absolute, err := filepath.Abs(src)
+		if err != nil {
+			list.Close()
+			return err
+		}
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(absolute, "'", `'\''`))
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+
+	return Run("-f", "concat", "-safe", "0", "-i", list.Name(), "-map", "0", "-c", "copy", dst)
+}
+
+// Keyframes returns the times (in seconds) of the video keyframes of a file
+func Keyframes(src string) ([]float64, error) {
+	output, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-skip_frame", "nokey",
+		"-show_entries", "frame=pts_time", "-of", "csv=p=0", src).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed on '%s': %v", src, err)
+	}
+
+	var keyframes []float64
+	for _, line := range strings.Fields(string(output)) {
+		if value, err := strconv.ParseFloat(strings.Trim(line, ","), 64); err == nil {
+			keyframes = append(keyframes, value)
+		}
+	}
+	return keyframes, nil
+}
+
+// VideoCodec returns the codec name of the first video stream (e.g. h264, hevc)
+func VideoCodec(src string) (string, error) {
+	return streamCodec(src, "v:0")
+}
+
+// AudioCodec returns the codec name of the first audio stream, or "" without audio
+func AudioCodec(src string) (string, error) {
+	return streamCodec(src, "a:0")
+}
+
+// streamCodec returns the codec name of the selected stream
+func streamCodec(src string, stream string) (string, error) {
+	output, err := exec.Command("ffprobe", "-v", "error", "-select_streams", stream,
+		"-show_entries", "stream=codec_name", "-of", "csv=p=0", src).Output()
+	if err != nil {
+		return "", fmt.Errorf("ffprobe failed on '%s': %v", src, err)
+	}
+	return strings.Trim(strings.TrimSpace(string(output)), ","), nil
+}
+
+// encoders maps codec names to the encoder used to re-encode cut boundaries
+var encoders = map[string]string{
+	"h264": "libx264",
+	"hevc": "libx265",
+	"vp8":  "libvpx",
+	"vp9":  "libvpx-vp9",
+	"av1":  "libsvtav1",
+}
+
+// videoParams are the properties of a video stream that re-encoded frames must
+// share with copied ones to be joined into one stream
+type videoParams struct {
+	Codec   string `json:"codec_name"`
+	Profile string `json:"profile"`
+	PixFmt  string `json:"pix_fmt"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+// probeVideo returns the parameters of the first video stream of a file
+func probeVideo(src string) (videoParams, error) {
+	output, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=codec_name,profile,pix_fmt,width,height", "-of", "json", src).Output()
+	if err != nil {
+		return videoParams{}, fmt.Errorf("ffprobe failed on '%s': %v", src, err)
+	}
+	var probe struct {
+		Streams []videoParams `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return videoParams{}, fmt.Errorf("failed to parse ffprobe output for '%s': %w", src, err)
+	}
+	if len(probe.Streams) == 0 {
+		return videoParams{}, fmt.Errorf("no video stream in '%s'", src)
+	}
+	return probe.Streams[0], nil
+}
+
+// encoderArgs returns the arguments that make the encoder for p's codec produce
+// frames with p's parameters. The profile is passed on for H.264 and H.265
+// (whose encoders name it like ffprobe in lower case and without spaces, e.g.
+// "High 10" as high10); the other codecs follow from the pixel format.
+func (p videoParams) encoderArgs() []string {
+	args := []string{"-c:v", encoders[p.Codec], "-pix_fmt", p.PixFmt}
+	profile := strings.ToLower(p.Profile)
+	for _, word := range []string{"constrained", "predictive", " ", ":"} {
+		profile = strings.ReplaceAll(profile, word, "")
+	}
+	switch p.Codec {
+	case "h264":
+		if profile != "" {
+			args = append(args, "-profile:v", profile)
+		}
+	case "hevc":
+		if profile != "" {
+			args = append(args, "-profile:v", profile)
+		}
+		// Parameter sets in every keyframe, not only in the stream header, which
+		// the copied frames after the joint would otherwise be decoded with
+		args = append(args, "-x265-params", "repeat-headers=1")
+	}
+	return args
+}
+
+// Trim writes the part of src between start and end (in seconds; end <= 0 means
+// until the end) to dst, starting exactly at start. Only the frames up to the first
+// keyframe after start are re-encoded, with the parameters of the source; the
+// rest is copied. If that fails, or the re-encoded frames don't match the
+// copied ones, the whole range is re-encoded. Intermediate files are kept next
+// to dst.
+func Trim(src string, dst string, start float64, end float64) error {
+	duration := []string{}
+	if end > 0 {
+		duration = []string{"-t", fmt.Sprintf("%.3f", end-start)}
+	}
+
+	params, err := probeVideo(src)
+	if err != nil {
+		return err
+	}
+	if _, ok := encoders[params.Codec]; !ok {
+		return fmt.Errorf("cannot re-encode %s video for trimming", params.Codec)
+	}
+
+	keyframes, err := Keyframes(src)
+	if err != nil {
+		return err
+	}
+	keyframe := -1.0
+	for _, k := range keyframes {
+		if k >= start-0.001 {
+			keyframe = k
+			break
+		}
+	}
+
+	// Starting on a keyframe: nothing needs re-encoding
+	if keyframe >= 0 && keyframe-start < 0.001 {
+		return Run(append(append([]string{"-ss", fmt.Sprintf("%.3f", start), "-i", src}, duration...), "-map", "0", "-c", "copy", dst)...)
+	}
+
+	reencode := func() error {
+		return Run(append(append([]string{"-ss", fmt.Sprintf("%.3f", start), "-i", src}, duration...),
+			"-map", "0", "-c", "copy", "-c:v", encoders[params.Codec], "-pix_fmt", params.PixFmt, dst)...)
+	}
+	if keyframe < 0 || (end > 0 && keyframe >= end) {
+		return reencode()
+	}
+
+	// Decrypted footage doesn't belong in a shared temporary directory
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dst), ".dashcam-trim-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ext := filepath.Ext(dst)
+	head := filepath.Join(tmpDir, "head"+ext)
+	body := filepath.Join(tmpDir, "body"+ext)
+	err = Run(append([]string{"-ss", fmt.Sprintf("%.3f", start), "-i", src, "-t", fmt.Sprintf("%.3f", keyframe-start),
+		"-map", "0", "-c", "copy"}, append(params.encoderArgs(), head)...)...)
+	if err == nil {
+		// The encoder may not support the source's profile or pixel format
+		var encoded videoParams
+		if encoded, err = probeVideo(head); err == nil && encoded != params {
+			err = fmt.Errorf("re-encoded frames (%+v) don't match the source (%+v)", encoded, params)
+		}
+	}
+	if err == nil {
+		// Seeking to a keyframe before the input copies from exactly that frame
+		bodyArgs := []string{"-ss", fmt.Sprintf("%.3f", keyframe), "-i", src}
+		if end > 0 {
+			bodyArgs = append(bodyArgs, "-t", fmt.Sprintf("%.3f", end-keyframe))
+		}
+		err = Run(append(bodyArgs, "-map", "0", "-c", "copy", body)...)
+	}
+	if err == nil {
+		err = Concat([]string{head, body}, dst)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return reencode()
+	}
+	return nil
+}
+
+// SpeedUp reads a video from input and writes it speed times faster, without audio,
+// as H.264 at 30 fps scaled down to at most width pixels wide
+func SpeedUp(input io.Reader, dst string, speed float64, width int) error {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "pipe:0", "-an",
+		"-vf", fmt.Sprintf("setpts=PTS/%g,fps=30,scale='min(%d,iw)':-2", speed, width),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p", dst)
+	cmd.Stdin = input
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed: %v, output: %s", err, lastLines(string(output), 5))
+	}
+	return nil
+}
+
+// Format describes a container for sharing recordings
+type Format struct {
+	VideoCodecs  []string // Codecs that can be copied into the container
+	AudioCodecs  []string
+	VideoEncoder string // Used when the video codec can't be copied
+	AudioEncoder string
+	Subtitles    string // Subtitle codec of the container
+}
+
+// Formats lists the containers recordings can be converted to, by file extension
+var Formats = map[string]Format{
+	"mp4": {
+		VideoCodecs:  []string{"h264", "hevc", "av1"},
+		AudioCodecs:  []string{"aac", "mp3", "opus"},
+		VideoEncoder: "libx264",
+		AudioEncoder: "aac",
+		Subtitles:    "mov_text",
+	},
+	"webm": {
+		VideoCodecs:  []string{"vp8", "vp9", "av1"},
+		AudioCodecs:  []string{"opus", "vorbis"},
+		VideoEncoder: "libvpx-vp9",
+		AudioEncoder: "libopus",
+		Subtitles:    "webvtt",
+	},
+}
+
+// Convert writes src to dst in the container named by format (see Formats),
+// copying streams whose codec the container supports and re-encoding the others
+func Convert(src string, dst string, format string) error {
+	f, ok := Formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+
+	videoCodec, err := VideoCodec(src)
+	if err != nil {
+		return err
+	}
+	audioCodec, err := AudioCodec(src)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-i", src, "-map", "0:v", "-map", "0:a?", "-map", "0:s?", "-c:s", f.Subtitles}
+	if slices.Contains(f.VideoCodecs, videoCodec) {
+		args = append(args, "-c:v", "copy")
+		// Apple players only accept HEVC in MP4 with the hvc1 tag
+		if videoCodec == "hevc" {
+			args = append(args, "-tag:v", "hvc1")
+		}
+	} else {
+		args = append(args, "-c:v", f.VideoEncoder, "-pix_fmt", "yuv420p")
+	}
+	if audioCodec == "" || slices.Contains(f.AudioCodecs, audioCodec) {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", f.AudioEncoder)
+	}
+	if format == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	// The format names double as muxer names; dst may not carry the extension yet
+	return Run(append(args, "-f", format, dst)...)
+}
+
+// Reencode writes src to dst with the video re-encoded by encoder at the given
+// quality (CRF), copying the other streams, chapters and tags
+func Reencode(src string, dst string, encoder string, crf int) error {
+	return Run("-i", src, "-map", "0", "-c", "copy", "-c:v", encoder, "-crf", strconv.Itoa(crf), dst)
+}
+
+// ClipInput is a part of a file to put into a clip
+type ClipInput struct {
+	Path     string
+	Start    float64 // Seconds into the file
+	Duration float64 // Seconds to take, 0 for everything after Start
+}
+
+// Clip joins the inputs into a small, silent GIF or WebM of at most width pixels
+// wide, for pasting into chats and issue trackers
+func Clip(inputs []ClipInput, dst string, gif bool, width int) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("nothing to clip")
+	}
+
+	var args []string
+	var streams strings.Builder
+	for i, input := range inputs {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", input.Start))
+		if input.Duration > 0 {
+			args = append(args, "-t", fmt.Sprintf("%.3f", input.Duration))
+		}
+		args = append(args, "-i", input.Path)
+		fmt.Fprintf(&streams, "[%d:v]", i)
+	}
+
+	scale := fmt.Sprintf("scale='min(%d,iw)':-2", width)
+	if gif {
+		// A palette made for the clip keeps GIFs of screen content readable
+		filter := fmt.Sprintf("%sconcat=n=%d:v=1:a=0,fps=10,%s:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			streams.String(), len(inputs), scale)
+		return Run(append(args, "-filter_complex", filter, "-f", "gif", dst)...)
+	}
+
+	filter := fmt.Sprintf("%sconcat=n=%d:v=1:a=0,%s", streams.String(), len(inputs), scale)
+	return Run(append(args, "-filter_complex", filter, "-an", "-c:v", "libvpx-vp9", "-crf", "36", "-b:v", "0",
+		"-pix_fmt", "yuv420p", "-f", "webm", dst)...)
+}
+
+// LabeledFrame extracts a single frame at the given second as JPEG, scaled to width,
+// with label printed in its bottom left corner
+func LabeledFrame(src string, dst string, at float64, width int, label string) error {
+	// Quotes can't be escaped inside the quoted text, so they are dropped
+	text := strings.NewReplacer(`\`, `\\`, ":", `\:`, "'", "", "%", `\%`).Replace(label)
+	filter := fmt.Sprintf("scale=%d:-2,drawtext=text='%s':x=8:y=h-th-8:fontsize=h/12:fontcolor=white:box=1:boxcolor=black@0.6:boxborderw=4",
+		width, text)
+	return Run("-ss", fmt.Sprintf("%.3f", at), "-i", src, "-frames:v", "1", "-vf", filter, "-q:v", "4", dst)
+}
+
+// Tile arranges images of equal size into a grid of columns x rows in one JPEG
+func Tile(images []string, dst string, columns int, rows int) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no images to tile")
+	}
+
+	list, err := os.CreateTemp("", "dashcam-tile-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	for _, image := range images {
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(image, "'", `'\''`))
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+
+	filter := fmt.Sprintf("tile=%dx%d:padding=4:margin=4", columns, rows)
+	return Run("-f", "concat", "-safe", "0", "-i", list.Name(), "-vf", filter, "-frames:v", "1", "-q:v", "3", dst)
+}
+
+// Overlay is text burned into exported video
+type Overlay struct {
+	Clock     time.Time // Wall-clock time of the first frame; zero for no running timestamp
+	Hostname  string
+	Watermark string
+}
+
+// Empty reports whether there is nothing to draw
+func (o Overlay) Empty() bool {
+	return o.Clock.IsZero() && o.Hostname == "" && o.Watermark == ""
+}
+
+// BurnOverlay writes src to dst with the overlay drawn onto the video: the running
+// timestamp and hostname in the bottom left corner, the watermark in the top right.
+// The video is re-encoded with the codec it had; all other streams are copied.
+func BurnOverlay(src string, dst string, overlay Overlay) error {
+	codec, err := VideoCodec(src)
+	if err != nil {
+		return err
+	}
+	encoder, ok := encoders[codec]
+	if !ok {
+		encoder = "libx264"
+	}
+
+	tmpDir, err := os.MkdirTemp("", "dashcam-overlay-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The text goes through files so only drawtext's own expansion needs escaping
+	escape := strings.NewReplacer(`\`, `\\`, "%", `\%`).Replace
+	var lines []string
+	if !overlay.Clock.IsZero() {
+		lines = append(lines, fmt.Sprintf(`%%{pts:localtime:%d:%%Y-%%m-%%d %%H\:%%M\:%%S}`, overlay.Clock.Unix()))
+	}
+	if overlay.Hostname != "" {
+		lines = append(lines, escape(overlay.Hostname))
+	}
+
+	style := "fontsize=h/30:fontcolor=white:box=1:boxcolor=black@0.6:boxborderw=6"
+	var filters []string
+	if len(lines) > 0 {
+		file := filepath.Join(tmpDir, "info.txt")
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+			return err
+		}
+		filters = append(filters, fmt.Sprintf("drawtext=textfile='%s':x=12:y=h-th-12:%s", file, style))
+	}
+	if overlay.Watermark != "" {
+		file := filepath.Join(tmpDir, "watermark.txt")
+		if err := os.WriteFile(file, []byte(escape(overlay.Watermark)), 0600); err != nil {
+			return err
+		}
+		filters = append(filters, fmt.Sprintf("drawtext=textfile='%s':x=w-tw-12:y=12:fontsize=h/20:fontcolor=white@0.5", file))
+	}
+	if len(filters) == 0 {
+		return fmt.Errorf("empty overlay")
+	}
+
+	return Run("-i", src, "-map", "0", "-c", "copy", "-vf", strings.Join(filters, ","),
+		"-c:v", encoder, "-pix_fmt", "yuv420p", dst)
+}
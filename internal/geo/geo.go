@@ -0,0 +1,111 @@
+package geo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCommand is GeoClue's demo client, which prints locations as it receives them
+const DefaultCommand = "/usr/libexec/geoclue-2.0/demos/where-am-i"
+
+// Fix is a single position report
+type Fix struct {
+	Time      time.Time
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64 // meters
+	Altitude  float64 // meters, 0 if unknown
+}
+
+// Query asks GeoClue for the current position using the where-am-i client.
+// The client waits for updates until its timeout, so this takes up to timeout;
+// cancelling ctx kills it.
+func Query(ctx context.Context, command string, timeout time.Duration) (Fix, error) {
+	seconds := max(int(timeout.Seconds()), 1)
+	ctx, cancel := context.WithTimeout(ctx, timeout+5*time.Second)
+	defer cancel()
+
+	// -a 8: request the most exact accuracy level available
+	cmd := exec.CommandContext(ctx, command, "-t", strconv.Itoa(seconds), "-a", "8")
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return Fix{}, fmt.Errorf("failed to query GeoClue via %s: %v", command, err)
+	}
+
+	fix, ok := parse(output)
+	if !ok {
+		return Fix{}, fmt.Errorf("GeoClue reported no location")
+	}
+	fix.Time = time.Now()
+	return fix, nil
+}
+
+// parse returns the last location printed by where-am-i
+func parse(output []byte) (Fix, bool) {
+	var fix, current Fix
+	found, haveLat := false, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		number, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "°"), 64)
+		if err != nil {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "Latitude":
+			current = Fix{Latitude: number}
+			haveLat = true
+		case "Longitude":
+			if haveLat {
+				current.Longitude = number
+				fix = current
+				found = true
+			}
+		case "Accuracy":
+			fix.Accuracy = number
+		case "Altitude":
+			fix.Altitude = number
+		}
+	}
+	return fix, found
+}
+
+// WriteGPX writes the fixes as a GPX track
+func WriteGPX(path string, name string, fixes []Fix) error {
+	var gpx strings.Builder
+	gpx.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	gpx.WriteString(`<gpx version="1.1" creator="dashcam" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+	fmt.Fprintf(&gpx, "  <trk>\n    <name>%s</name>\n    <trkseg>\n", escapeXML(name))
+	for _, fix := range fixes {
+		fmt.Fprintf(&gpx, "      <trkpt lat=\"%.7f\" lon=\"%.7f\">", fix.Latitude, fix.Longitude)
+		if fix.Altitude != 0 {
+			fmt.Fprintf(&gpx, "<ele>%.1f</ele>", fix.Altitude)
+		}
+		fmt.Fprintf(&gpx, "<time>%s</time></trkpt>\n", fix.Time.UTC().Format(time.RFC3339))
+	}
+	gpx.WriteString("    </trkseg>\n  </trk>\n</gpx>\n")
+
+	return os.WriteFile(path, []byte(gpx.String()), 0600)
+}
+
+// escapeXML escapes text for use in XML content
+func escapeXML(value string) string {
+	replacer := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	return replacer.Replace(value)
+}
@@ -5,10 +5,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
@@ -23,31 +21,36 @@ type HotkeyEntry struct {
 	Active   bool
 }
 
-// HyprlandHotkeyManager manages hotkeys for Hyprland
-type HyprlandHotkeyManager struct {
+// compositor binds keys in a compositor to a shell command
+type compositor interface {
+	// name returns the compositor's name for messages
+	name() string
+	// bind runs command whenever the key is pressed with the modifiers held
+	bind(mods []string, key, command string) error
+	// unbind removes the binding of the key
+	unbind(mods []string, key string) error
+}
+
+// HotkeyManager manages hotkeys bound in the compositor. Each binding writes the
+// hotkey's ID to a named pipe the manager listens on.
+type HotkeyManager struct {
 	pipePath     string
 	hotkeys      map[string]*HotkeyEntry
 	hotkeysMutex sync.RWMutex
 	listening    bool
 	stopChan     chan bool
-	instanceSig  string
+	compositor   compositor
 }
 
-// NewHyprlandHotkeyManager creates a new hotkey manager
-func NewHyprlandHotkeyManager() (*HyprlandHotkeyManager, error) {
-	// Check if we're running under Hyprland
-	instanceSig := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
-	if instanceSig == "" {
-		return nil, fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE not found - are you running under Hyprland?")
-	}
-
-	pipePath := "/tmp/hyprland_hotkey_pipe"
+// newHotkeyManager creates a hotkey manager binding keys in the given compositor
+func newHotkeyManager(compositor compositor) (*HotkeyManager, error) {
+	pipePath := "/tmp/dashcam_hotkey_pipe"
 
-	manager := &HyprlandHotkeyManager{
-		pipePath:    pipePath,
-		hotkeys:     make(map[string]*HotkeyEntry),
-		stopChan:    make(chan bool),
-		instanceSig: instanceSig,
+	manager := &HotkeyManager{
+		pipePath:   pipePath,
+		hotkeys:    make(map[string]*HotkeyEntry),
+		stopChan:   make(chan bool),
+		compositor: compositor,
 	}
 
 	// Create the named pipe
@@ -59,12 +62,12 @@ func NewHyprlandHotkeyManager() (*HyprlandHotkeyManager, error) {
 }
 
 // createPipe creates the named pipe for communication
-func (hm *HyprlandHotkeyManager) createPipe() error {
+func (hm *HotkeyManager) createPipe() error {
 	// Remove existing pipe if it exists
 	os.Remove(hm.pipePath)
 
 	// Create new pipe
-	err := syscall.Mkfifo(hm.pipePath, 0666)
+	err := mkfifo(hm.pipePath, 0666)
 	if err != nil {
 		return fmt.Errorf("failed to create named pipe: %v", err)
 	}
@@ -73,8 +76,9 @@ func (hm *HyprlandHotkeyManager) createPipe() error {
 	return nil
 }
 
-// parseHotkey converts common hotkey format to Hyprland format
-func (hm *HyprlandHotkeyManager) parseHotkey(hotkey string) (string, string) {
+// parseHotkey splits the common hotkey format (CTRL+SUPER+E) into modifiers
+// (CTRL, ALT, SHIFT, SUPER) and an XKB key name
+func (hm *HotkeyManager) parseHotkey(hotkey string) ([]string, string) {
 	parts := strings.Split(strings.ToUpper(strings.ReplaceAll(hotkey, " ", "")), "+")
 
 	var mods []string
@@ -131,19 +135,18 @@ func (hm *HyprlandHotkeyManager) parseHotkey(hotkey string) (string, string) {
 		}
 	}
 
-	modStr := strings.Join(mods, " ")
-	return modStr, key
+	return mods, key
 }
 
 // generateHotkeyID generates a unique ID for a hotkey
-func (hm *HyprlandHotkeyManager) generateHotkeyID(hotkey string) string {
+func (hm *HotkeyManager) generateHotkeyID(hotkey string) string {
 	return fmt.Sprintf("hotkey_%s_%d",
 		strings.ReplaceAll(strings.ReplaceAll(hotkey, "+", "_"), " ", ""),
 		time.Now().UnixNano())
 }
 
 // RegisterHotkey registers a new hotkey with callback
-func (hm *HyprlandHotkeyManager) RegisterHotkey(hotkey string, callback HotkeyCallback) (string, error) {
+func (hm *HotkeyManager) RegisterHotkey(hotkey string, callback HotkeyCallback) (string, error) {
 	hm.hotkeysMutex.Lock()
 	defer hm.hotkeysMutex.Unlock()
 
@@ -159,17 +162,8 @@ func (hm *HyprlandHotkeyManager) RegisterHotkey(hotkey string, callback HotkeyCa
 	// Create command that will write to our pipe
 	command := fmt.Sprintf("echo '%s' > %s", id, hm.pipePath)
 
-	// Register with Hyprland
-	var cmd *exec.Cmd
-	if mod != "" {
-		cmd = exec.Command("hyprctl", "keyword", "bind", fmt.Sprintf("%s, %s, exec, %s", mod, key, command))
-	} else {
-		cmd = exec.Command("hyprctl", "keyword", "bind", fmt.Sprintf(", %s, exec, %s", key, command))
-	}
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to register hotkey with Hyprland: %v, output: %s", err, output)
+	if err := hm.compositor.bind(mod, key, command); err != nil {
+		return "", fmt.Errorf("failed to register hotkey with %s: %v", hm.compositor.name(), err)
 	}
 
 	// Store hotkey entry
@@ -187,7 +181,7 @@ func (hm *HyprlandHotkeyManager) RegisterHotkey(hotkey string, callback HotkeyCa
 }
 
 // UnregisterHotkey removes a hotkey registration
-func (hm *HyprlandHotkeyManager) UnregisterHotkey(id string) error {
+func (hm *HotkeyManager) UnregisterHotkey(id string) error {
 	hm.hotkeysMutex.Lock()
 	defer hm.hotkeysMutex.Unlock()
 
@@ -199,16 +193,8 @@ func (hm *HyprlandHotkeyManager) UnregisterHotkey(id string) error {
 	// Parse the original hotkey to unbind it
 	mod, key := hm.parseHotkey(entry.Hotkey)
 
-	// Unbind from Hyprland by binding to a no-op command
-	var cmd *exec.Cmd
-	if mod != "" {
-		cmd = exec.Command("hyprctl", "keyword", "unbind", fmt.Sprintf("%s, %s", mod, key))
-	} else {
-		cmd = exec.Command("hyprctl", "keyword", "unbind", fmt.Sprintf(", %s", key))
-	}
-
-	if err := cmd.Run(); err != nil {
-		log.Printf("Warning: failed to unbind hotkey from Hyprland: %v", err)
+	if err := hm.compositor.unbind(mod, key); err != nil {
+		log.Printf("Warning: failed to unbind hotkey from %s: %v", hm.compositor.name(), err)
 	}
 
 	// Remove from our registry
@@ -219,7 +205,7 @@ func (hm *HyprlandHotkeyManager) UnregisterHotkey(id string) error {
 }
 
 // StartListening starts listening for hotkey events
-func (hm *HyprlandHotkeyManager) StartListening() error {
+func (hm *HotkeyManager) StartListening() error {
 	if hm.listening {
 		return fmt.Errorf("already listening")
 	}
@@ -264,7 +250,7 @@ func (hm *HyprlandHotkeyManager) StartListening() error {
 }
 
 // handleHotkeyEvent processes a hotkey event
-func (hm *HyprlandHotkeyManager) handleHotkeyEvent(hotkeyID string) {
+func (hm *HotkeyManager) handleHotkeyEvent(hotkeyID string) {
 	hm.hotkeysMutex.RLock()
 	entry, exists := hm.hotkeys[hotkeyID]
 	hm.hotkeysMutex.RUnlock()
@@ -289,7 +275,7 @@ func (hm *HyprlandHotkeyManager) handleHotkeyEvent(hotkeyID string) {
 }
 
 // StopListening stops the hotkey listener
-func (hm *HyprlandHotkeyManager) StopListening() {
+func (hm *HotkeyManager) StopListening() {
 	if !hm.listening {
 		return
 	}
@@ -299,7 +285,7 @@ func (hm *HyprlandHotkeyManager) StopListening() {
 }
 
 // GetRegisteredHotkeys returns a list of registered hotkeys
-func (hm *HyprlandHotkeyManager) GetRegisteredHotkeys() map[string]*HotkeyEntry {
+func (hm *HotkeyManager) GetRegisteredHotkeys() map[string]*HotkeyEntry {
 	hm.hotkeysMutex.RLock()
 	defer hm.hotkeysMutex.RUnlock()
 
@@ -316,7 +302,7 @@ func (hm *HyprlandHotkeyManager) GetRegisteredHotkeys() map[string]*HotkeyEntry
 }
 
 // SetHotkeyActive enables or disables a hotkey without unregistering it
-func (hm *HyprlandHotkeyManager) SetHotkeyActive(id string, active bool) error {
+func (hm *HotkeyManager) SetHotkeyActive(id string, active bool) error {
 	hm.hotkeysMutex.Lock()
 	defer hm.hotkeysMutex.Unlock()
 
@@ -331,18 +317,23 @@ func (hm *HyprlandHotkeyManager) SetHotkeyActive(id string, active bool) error {
 }
 
 // Close cleans up resources
-func (hm *HyprlandHotkeyManager) Close() error {
-	log.Println("Closing Hyprland hotkey manager...")
+func (hm *HotkeyManager) Close() error {
+	log.Printf("Closing %s hotkey manager...", hm.compositor.name())
 
 	// Stop listening
 	hm.StopListening()
 
-	// Unregister all hotkeys
-	hm.hotkeysMutex.Lock()
+	// Unregister all hotkeys (UnregisterHotkey takes the lock itself)
+	hm.hotkeysMutex.RLock()
+	ids := make([]string, 0, len(hm.hotkeys))
 	for id := range hm.hotkeys {
+		ids = append(ids, id)
+	}
+	hm.hotkeysMutex.RUnlock()
+
+	for _, id := range ids {
 		hm.UnregisterHotkey(id)
 	}
-	hm.hotkeysMutex.Unlock()
 
 	// Remove pipe
 	if err := os.Remove(hm.pipePath); err != nil && !os.IsNotExist(err) {
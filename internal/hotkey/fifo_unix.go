@@ -0,0 +1,10 @@
+//go:build !windows
+
+package hotkey
+
+import "syscall"
+
+// mkfifo creates a named pipe
+func mkfifo(path string, mode uint32) error {
+	return syscall.Mkfifo(path, mode)
+}
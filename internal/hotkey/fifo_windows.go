@@ -0,0 +1,10 @@
+//go:build windows
+
+package hotkey
+
+import "errors"
+
+// mkfifo fails on Windows, which has no Hyprland to send hotkeys through a pipe
+func mkfifo(path string, mode uint32) error {
+	return errors.New("named pipes are not supported on Windows")
+}
@@ -0,0 +1,37 @@
+package hotkey
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hyprland binds keys with hyprctl
+type hyprland struct{}
+
+// NewHyprlandHotkeyManager creates a hotkey manager for Hyprland
+func NewHyprlandHotkeyManager() (*HotkeyManager, error) {
+	// Check if we're running under Hyprland
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") == "" {
+		return nil, fmt.Errorf("HYPRLAND_INSTANCE_SIGNATURE not found - are you running under Hyprland?")
+	}
+	return newHotkeyManager(hyprland{})
+}
+
+func (hyprland) name() string {
+	return "Hyprland"
+}
+
+func (hyprland) bind(mods []string, key, command string) error {
+	binding := fmt.Sprintf("%s, %s, exec, %s", strings.Join(mods, " "), key, command)
+	output, err := exec.Command("hyprctl", "keyword", "bind", binding).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v, output: %s", err, output)
+	}
+	return nil
+}
+
+func (hyprland) unbind(mods []string, key string) error {
+	return exec.Command("hyprctl", "keyword", "unbind", fmt.Sprintf("%s, %s", strings.Join(mods, " "), key)).Run()
+}
@@ -0,0 +1,52 @@
+package hotkey
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sway binds keys with swaymsg
+type sway struct{}
+
+// swayModifiers maps the common modifier names onto sway's
+var swayModifiers = map[string]string{
+	"CTRL":  "Ctrl",
+	"ALT":   "Mod1",
+	"SHIFT": "Shift",
+	"SUPER": "Mod4",
+}
+
+// NewSwayHotkeyManager creates a hotkey manager for sway
+func NewSwayHotkeyManager() (*HotkeyManager, error) {
+	if os.Getenv("SWAYSOCK") == "" {
+		return nil, fmt.Errorf("SWAYSOCK not found - are you running under sway?")
+	}
+	return newHotkeyManager(sway{})
+}
+
+func (sway) name() string {
+	return "sway"
+}
+
+// combination returns the key in sway's format, e.g. Ctrl+Mod4+e
+func (sway) combination(mods []string, key string) string {
+	var parts []string
+	for _, mod := range mods {
+		parts = append(parts, swayModifiers[mod])
+	}
+	return strings.Join(append(parts, key), "+")
+}
+
+func (s sway) bind(mods []string, key, command string) error {
+	output, err := exec.Command("swaymsg", "bindsym", "--no-warn", s.combination(mods, key), "exec", command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v, output: %s", err, output)
+	}
+	return nil
+}
+
+func (s sway) unbind(mods []string, key string) error {
+	return exec.Command("swaymsg", "unbindsym", s.combination(mods, key)).Run()
+}
@@ -0,0 +1,225 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Job is a piece of deferred post-processing
+type Job struct {
+	Kind   string    `json:"kind"`   // What to do, e.g. "ocr"
+	Target string    `json:"target"` // What to do it on, e.g. a segment file name or a day
+	Added  time.Time `json:"added"`
+}
+
+// Queue is a first-in, first-out job queue whose pending jobs are stored in a
+// JSON file, so they survive restarts. A job stays in the file until it is done.
+type Queue struct {
+	path    string
+	mutex   sync.Mutex
+	loaded  bool
+	pending []Job
+	running map[Job]bool
+	wake    chan struct{}
+}
+
+// Open returns the queue stored at path; the file is read on first use
+func Open(path string) *Queue {
+	return &Queue{
+		path:    path,
+		running: make(map[Job]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Path returns the location of the queue file
+func (q *Queue) Path() string {
+	return q.path
+}
+
+// Add queues a job unless the same job is already pending
+func (q *Queue) Add(kind string, target string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.load()
+	for _, job := range q.pending {
+		if job.Kind == kind && job.Target == target {
+			return nil
+		}
+	}
+	q.pending = append(q.pending, Job{Kind: kind, Target: target, Added: time.Now().Round(0)})
+	err := q.save()
+	q.poke()
+	return err
+}
+
+// Len returns the number of pending jobs, including running ones
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.load()
+	return len(q.pending)
+}
+
+// Has reports whether any job on target is pending, including running ones
+func (q *Queue) Has(target string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.load()
+	for _, job := range q.pending {
+		if job.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Run processes jobs with the given number of workers until ctx is cancelled,
+// then waits for running jobs to finish. Workers run at the given nice level,
+// which the programs they start inherit. Failed jobs are logged and dropped.
+func (q *Queue) Run(ctx context.Context, workers int, nice int, handle func(Job) error) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, nice, handle)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs jobs one after the other
+func (q *Queue) work(ctx context.Context, nice int, handle func(Job) error) {
+	// The priority is per thread, so keep this goroutine on a thread of its own;
+	// the thread exits with the goroutine instead of being reused
+	runtime.LockOSThread()
+	if nice != 0 {
+		if err := lowerPriority(nice); err != nil {
+			log.Printf("Warning: Could not set nice level of job worker: %v", err)
+		}
+	}
+
+	for {
+		job, ok := q.next()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := handle(job); err != nil {
+			log.Printf("Warning: Job %s of %s failed: %v", job.Kind, job.Target, err)
+		}
+		q.done(job)
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next claims the oldest job no worker is running
+func (q *Queue) next() (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.load()
+	claimed, found := Job{}, false
+	for _, job := range q.pending {
+		if q.running[job] {
+			continue
+		}
+		if found {
+			// Get an idle worker started on the rest
+			q.poke()
+			break
+		}
+		q.running[job] = true
+		claimed, found = job, true
+	}
+	return claimed, found
+}
+
+// poke wakes one idle worker without blocking
+func (q *Queue) poke() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// done removes a finished job from the queue
+func (q *Queue) done(finished Job) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.running, finished)
+	for i, job := range q.pending {
+		if job == finished {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+
+	if err := q.save(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
+
+// load reads the pending jobs from the queue file once; the caller holds the mutex
+func (q *Queue) load() {
+	if q.loaded {
+		return
+	}
+	q.loaded = true
+
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: Could not read job queue '%s': %v", q.path, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &q.pending); err != nil {
+		log.Printf("Warning: Could not parse job queue '%s', starting empty: %v", q.path, err)
+		q.pending = nil
+	}
+}
+
+// save replaces the queue file with the pending jobs; the caller holds the mutex
+func (q *Queue) save() error {
+	if len(q.pending) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove job queue '%s': %w", q.path, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q.pending, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFile := filepath.Join(filepath.Dir(q.path), "."+filepath.Base(q.path)+".tmp")
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write job queue '%s': %w", q.path, err)
+	}
+	if err := os.Rename(tmpFile, q.path); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write job queue '%s': %w", q.path, err)
+	}
+	return nil
+}
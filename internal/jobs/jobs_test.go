@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPersistence(t *testing.T) {
+	path := t.TempDir() + "/jobs.json"
+
+	queue := Open(path)
+	for _, job := range [][2]string{{"ocr", "a.mkv"}, {"thumbnail", "a.mkv"}, {"ocr", "a.mkv"}, {"timelapse", "2026-10-16"}} {
+		if err := queue.Add(job[0], job[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if queue.Len() != 3 {
+		t.Errorf("%d jobs queued, want 3 without the duplicate", queue.Len())
+	}
+
+	// A restart picks up where the last run stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled []string
+	Open(path).Run(ctx, 1, 0, func(job Job) error {
+		handled = append(handled, job.Kind)
+		cancel()
+		return nil
+	})
+	if want := []string{"ocr"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %q before stopping, want %q", handled, want)
+	}
+
+	queue = Open(path)
+	if queue.Len() != 2 || !queue.Has("a.mkv") || !queue.Has("2026-10-16") || queue.Has("b.mkv") {
+		t.Errorf("reopened queue has %d jobs, want the thumbnail and the timelapse", queue.Len())
+	}
+
+	// Failed jobs are dropped like finished ones, and the empty queue leaves no file
+	ctx, cancel = context.WithCancel(context.Background())
+	handled = nil
+	var mutex sync.Mutex
+	queue.Run(ctx, 2, 0, func(job Job) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled = append(handled, job.Kind)
+		if len(handled) == 2 {
+			defer cancel()
+		}
+		return errors.New("failed")
+	})
+	if len(handled) != 2 || queue.Len() != 0 {
+		t.Errorf("handled %q with %d jobs left, want both handled and none left", handled, queue.Len())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("queue file still exists after the last job: %v", err)
+	}
+}
+
+func TestCorruptQueue(t *testing.T) {
+	path := t.TempDir() + "/jobs.json"
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	queue := Open(path)
+	if queue.Len() != 0 {
+		t.Errorf("corrupt queue has %d jobs, want none", queue.Len())
+	}
+	if err := queue.Add("ocr", "a.mkv"); err != nil {
+		t.Fatal(err)
+	}
+	if Open(path).Len() != 1 {
+		t.Errorf("queue wasn't replaced after a corrupt file")
+	}
+}
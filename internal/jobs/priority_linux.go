@@ -0,0 +1,8 @@
+package jobs
+
+import "syscall"
+
+// lowerPriority sets the nice level of the current thread
+func lowerPriority(nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), nice)
+}
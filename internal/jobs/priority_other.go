@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package jobs
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// lowerPriority can't lower the priority of a single thread here: nice levels
+// are per process, and lowering dashcam's would slow down the capture as well
+func lowerPriority(nice int) error {
+	return fmt.Errorf("not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package jobs
+
+import "golang.org/x/sys/windows"
+
+var setThreadPriority = windows.NewLazySystemDLL("kernel32.dll").NewProc("SetThreadPriority")
+
+const (
+	threadPriorityBelowNormal = -1
+	threadPriorityLowest      = -2
+)
+
+// lowerPriority maps the nice level onto the priority of the current thread:
+// Windows only knows a few levels below normal
+func lowerPriority(nice int) error {
+	priority := threadPriorityBelowNormal
+	if nice >= 10 {
+		priority = threadPriorityLowest
+	}
+	if ok, _, err := setThreadPriority.Call(uintptr(windows.CurrentThread()), uintptr(priority)); ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry represents a single event in the journal
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Journal appends events to a JSON lines file
+type Journal struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// New creates a journal writing to the given file
+func New(path string) *Journal {
+	return &Journal{path: path}
+}
+
+// Path returns the location of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Record appends an event to the journal
+func (j *Journal) Record(event string, detail string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	data, err := json.Marshal(Entry{Time: time.Now(), Event: event, Detail: detail})
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal '%s': %w", j.path, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal '%s': %w", j.path, err)
+	}
+	return nil
+}
+
+// Read returns all entries in the journal, oldest first
+func (j *Journal) Read() ([]Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	file, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open journal '%s': %w", j.path, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip damaged lines
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,84 @@
+package mask
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region describes a rectangle of the screen to hide in the recording
+type Region struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Mode   string `json:"mode"` // "black" (default) or "blur"
+}
+
+// Validate checks that the region describes a usable rectangle
+func (r Region) Validate() error {
+	if r.Width <= 0 || r.Height <= 0 {
+		return fmt.Errorf("mask region %dx%d+%d+%d has no area", r.Width, r.Height, r.X, r.Y)
+	}
+	if r.X < 0 || r.Y < 0 {
+		return fmt.Errorf("mask region %dx%d+%d+%d starts off-screen", r.Width, r.Height, r.X, r.Y)
+	}
+	switch r.Mode {
+	case "", "black", "blur":
+		return nil
+	default:
+		return fmt.Errorf("unknown mask mode '%s' (use black or blur)", r.Mode)
+	}
+}
+
+// blurRadius returns the largest box blur radius ffmpeg accepts for the region,
+// capped so a large region doesn't cost too much CPU per frame.
+// Chroma planes are half size, so the limit is a quarter of the shorter side.
+func (r Region) blurRadius() int {
+	radius := min(r.Width, r.Height) / 4
+	return min(radius, 20)
+}
+
+// Filter builds an ffmpeg filter graph that blacks out or blurs the regions.
+// Returns an empty string if there is nothing to mask.
+func Filter(regions []Region) string {
+	var blurred []Region
+	var boxes []string
+
+	for _, r := range regions {
+		if r.Mode == "blur" && r.blurRadius() > 0 {
+			blurred = append(blurred, r)
+			continue
+		}
+		// Regions too small to blur are simply blacked out
+		boxes = append(boxes, fmt.Sprintf("drawbox=x=%d:y=%d:w=%d:h=%d:color=black:t=fill", r.X, r.Y, r.Width, r.Height))
+	}
+
+	if len(blurred) == 0 {
+		return strings.Join(boxes, ",")
+	}
+
+	// Split the input into the base picture plus one copy per blurred region,
+	// blur a cropped copy of each region and overlay it back at its position
+	var graph strings.Builder
+	graph.WriteString(fmt.Sprintf("split=%d[base]", len(blurred)+1))
+	for i := range blurred {
+		graph.WriteString(fmt.Sprintf("[c%d]", i))
+	}
+	for i, r := range blurred {
+		graph.WriteString(fmt.Sprintf(";[c%d]crop=%d:%d:%d:%d,boxblur=%d:2[b%d]", i, r.Width, r.Height, r.X, r.Y, r.blurRadius(), i))
+	}
+
+	current := "base"
+	for i, r := range blurred {
+		graph.WriteString(fmt.Sprintf(";[%s][b%d]overlay=%d:%d", current, i, r.X, r.Y))
+		if i < len(blurred)-1 {
+			current = fmt.Sprintf("m%d", i)
+			graph.WriteString("[" + current + "]")
+		}
+	}
+
+	for _, box := range boxes {
+		graph.WriteString("," + box)
+	}
+	return graph.String()
+}
@@ -0,0 +1,66 @@
+package mask
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		regions []Region
+		want    string
+	}{
+		{"nothing to mask", nil, ""},
+		{
+			"black boxes",
+			[]Region{{X: 10, Y: 20, Width: 300, Height: 40}, {X: 0, Y: 0, Width: 50, Height: 50, Mode: "black"}},
+			"drawbox=x=10:y=20:w=300:h=40:color=black:t=fill,drawbox=x=0:y=0:w=50:h=50:color=black:t=fill",
+		},
+		{
+			"one blurred region",
+			[]Region{{X: 100, Y: 200, Width: 400, Height: 40, Mode: "blur"}},
+			"split=2[base][c0];[c0]crop=400:40:100:200,boxblur=10:2[b0];[base][b0]overlay=100:200",
+		},
+		{
+			"blur radius is capped",
+			[]Region{{X: 0, Y: 0, Width: 800, Height: 600, Mode: "blur"}},
+			"split=2[base][c0];[c0]crop=800:600:0:0,boxblur=20:2[b0];[base][b0]overlay=0:0",
+		},
+		{
+			"too small to blur is blacked out",
+			[]Region{{X: 5, Y: 5, Width: 3, Height: 100, Mode: "blur"}},
+			"drawbox=x=5:y=5:w=3:h=100:color=black:t=fill",
+		},
+		{
+			"blurred regions chained, then boxes",
+			[]Region{
+				{X: 0, Y: 0, Width: 40, Height: 40, Mode: "blur"},
+				{X: 10, Y: 10, Width: 20, Height: 20},
+				{X: 100, Y: 0, Width: 80, Height: 40, Mode: "blur"},
+			},
+			"split=3[base][c0][c1];[c0]crop=40:40:0:0,boxblur=10:2[b0];[c1]crop=80:40:100:0,boxblur=10:2[b1]" +
+				";[base][b0]overlay=0:0[m0];[m0][b1]overlay=100:0,drawbox=x=10:y=10:w=20:h=20:color=black:t=fill",
+		},
+	}
+	for _, test := range tests {
+		if got := Filter(test.regions); got != test.want {
+			t.Errorf("%s:\n got  %s\n want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		region Region
+		valid  bool
+	}{
+		{Region{Width: 10, Height: 10}, true},
+		{Region{X: 5, Y: 5, Width: 10, Height: 10, Mode: "blur"}, true},
+		{Region{Width: 0, Height: 10}, false},
+		{Region{X: -1, Width: 10, Height: 10}, false},
+		{Region{Width: 10, Height: 10, Mode: "pixelate"}, false},
+	}
+	for _, test := range tests {
+		if err := test.region.Validate(); (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, want valid: %v", test.region, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"bytes"
+	"dashcam/internal/crypt"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Extension is appended to a segment's file name to get its sidecar file
+const Extension = ".json"
+
+// Interval is a span of a segment, in seconds from the segment start
+type Interval struct {
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// WindowSample records which window got focus, in seconds from the segment start
+type WindowSample struct {
+	Offset float64 `json:"offset"`
+	AppID  string  `json:"app_id"`
+	Title  string  `json:"title"`
+}
+
+// Location is a position fix, in seconds from the segment start
+type Location struct {
+	Offset    float64 `json:"offset"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy,omitempty"`
+	Altitude  float64 `json:"altitude,omitempty"`
+}
+
+// SystemSample is the system load over the interval ending at Offset seconds from the segment start
+type SystemSample struct {
+	Offset  float64 `json:"offset"`
+	CPU     float64 `json:"cpu"`    // 0 to 1
+	Memory  float64 `json:"memory"` // 0 to 1
+	RxBytes float64 `json:"rx_bytes_per_second"`
+	TxBytes float64 `json:"tx_bytes_per_second"`
+}
+
+// Annotation is a label added by another program, in seconds from the segment start
+type Annotation struct {
+	Offset float64 `json:"offset"`
+	Text   string  `json:"text"`
+}
+
+// Part is one of the recordings a merged segment was made of
+type Part struct {
+	Offset float64   `json:"offset"` // Seconds from the start of the merged segment
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Segment holds the metadata recorded alongside a segment
+type Segment struct {
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Source        string         `json:"source,omitempty"` // Name of the additional source that recorded it
+	MuteIntervals []Interval     `json:"mute_intervals,omitempty"`
+	ScreenShared  bool           `json:"screen_shared,omitempty"`
+	Windows       []WindowSample `json:"windows,omitempty"`
+	Locations     []Location     `json:"locations,omitempty"`
+	System        []SystemSample `json:"system,omitempty"`
+	Annotations   []Annotation   `json:"annotations,omitempty"`
+	Parts         []Part         `json:"parts,omitempty"`     // Set when recordings were merged into this segment
+	Activity      *float64       `json:"activity,omitempty"`  // Share of time the screen changed, nil if not analysed
+	Scenes        []float64      `json:"scenes,omitempty"`    // Seconds from the segment start at which the picture changed
+	Marker        string         `json:"marker,omitempty"`    // Set on copies kept where extended attributes can't be stored
+	SHA256        string         `json:"sha256,omitempty"`    // Of the recording as stored (encrypted with encryption on) when it was finished
+	Review        string         `json:"review,omitempty"`    // Review state of a protected recording: reviewed, archived or deleted; empty while new
+	Reencoded     string         `json:"reencoded,omitempty"` // Encoder the recording was re-encoded with for the archive
+	Sealed        []byte         `json:"sealed,omitempty"`    // Windows, locations, system samples and annotations, encrypted (see Seal)
+}
+
+// private holds the parts of the metadata that tell what was on screen and where,
+// which are sealed with encryption on
+type private struct {
+	Windows     []WindowSample `json:"windows,omitempty"`
+	Locations   []Location     `json:"locations,omitempty"`
+	System      []SystemSample `json:"system,omitempty"`
+	Annotations []Annotation   `json:"annotations,omitempty"`
+}
+
+// Seal returns the metadata with the windows, locations, system samples and
+// annotations moved into Sealed, encrypted with secret. Without any of them it's
+// returned as is.
+func (s Segment) Seal(secret []byte) (Segment, error) {
+	if len(s.Windows) == 0 && len(s.Locations) == 0 && len(s.System) == 0 && len(s.Annotations) == 0 {
+		return s, nil
+	}
+	data, err := json.Marshal(private{Windows: s.Windows, Locations: s.Locations, System: s.System, Annotations: s.Annotations})
+	if err != nil {
+		return s, err
+	}
+	var sealed bytes.Buffer
+	if err := crypt.Encrypt(bytes.NewReader(data), &sealed, secret); err != nil {
+		return s, fmt.Errorf("failed to seal metadata: %w", err)
+	}
+
+	s.Windows, s.Locations, s.System, s.Annotations = nil, nil, nil, nil
+	s.Sealed = sealed.Bytes()
+	return s, nil
+}
+
+// Unseal is the inverse of Seal. Metadata that isn't sealed is returned as is.
+func (s Segment) Unseal(secret []byte) (Segment, error) {
+	if len(s.Sealed) == 0 {
+		return s, nil
+	}
+	var data bytes.Buffer
+	if err := crypt.Decrypt(bytes.NewReader(s.Sealed), &data, secret); err != nil {
+		return s, fmt.Errorf("failed to unseal metadata: %w", err)
+	}
+	var p private
+	if err := json.Unmarshal(data.Bytes(), &p); err != nil {
+		return s, fmt.Errorf("failed to parse sealed metadata: %w", err)
+	}
+
+	s.Windows, s.Locations, s.System, s.Annotations = p.Windows, p.Locations, p.System, p.Annotations
+	s.Sealed = nil
+	return s, nil
+}
+
+// TimeAt returns the wall-clock time at an offset into the segment. Merged segments
+// skip the gaps between their parts, so the offset is mapped through the parts.
+func (s Segment) TimeAt(offset float64) time.Time {
+	start, partOffset := s.Start, 0.0
+	for _, part := range s.Parts {
+		if part.Offset > offset {
+			break
+		}
+		start, partOffset = part.Start, part.Offset
+	}
+	return start.Add(time.Duration((offset - partOffset) * float64(time.Second)))
+}
+
+// OffsetAt returns the offset into the segment at a wall-clock time, the inverse of TimeAt.
+// Times in gaps between merged parts map to the start of the next part.
+func (s Segment) OffsetAt(t time.Time) float64 {
+	if len(s.Parts) == 0 {
+		return t.Sub(s.Start).Seconds()
+	}
+
+	for i, part := range s.Parts {
+		if t.Before(part.Start) {
+			return part.Offset
+		}
+		if t.Before(part.End) || i == len(s.Parts)-1 {
+			return part.Offset + t.Sub(part.Start).Seconds()
+		}
+	}
+	return 0
+}
+
+// Path returns the sidecar file of a segment
+func Path(segment string) string {
+	return segment + Extension
+}
+
+// Load reads the metadata of a segment. A missing sidecar yields empty metadata.
+func Load(segment string) (Segment, error) {
+	var meta Segment
+
+	data, err := os.ReadFile(Path(segment))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return meta, fmt.Errorf("failed to read metadata for '%s': %w", segment, err)
+	}
+
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse metadata for '%s': %w", segment, err)
+	}
+	return meta, nil
+}
+
+// Save writes the metadata of a segment to its sidecar file
+func Save(segment string, meta Segment) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves half a sidecar
+	tmpPath := Path(segment) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write metadata for '%s': %w", segment, err)
+	}
+	if err := os.Rename(tmpPath, Path(segment)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write metadata for '%s': %w", segment, err)
+	}
+	return nil
+}
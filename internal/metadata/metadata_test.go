@@ -0,0 +1,104 @@
+package metadata
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSealRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	meta := Segment{
+		Start:       time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		End:         time.Date(2026, 10, 17, 12, 1, 0, 0, time.UTC),
+		Windows:     []WindowSample{{Offset: 1, AppID: "firefox", Title: "Private mail"}},
+		Locations:   []Location{{Offset: 2, Latitude: 52.5, Longitude: 13.4}},
+		System:      []SystemSample{{Offset: 3, CPU: 0.12}},
+		Annotations: []Annotation{{Offset: 4, Text: "call with the bank"}},
+		SHA256:      "abc",
+		Review:      "reviewed",
+	}
+
+	sealed, err := meta.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed.Windows != nil || sealed.Locations != nil || sealed.System != nil || sealed.Annotations != nil {
+		t.Errorf("private fields are still set after sealing: %+v", sealed)
+	}
+	if !sealed.Start.Equal(meta.Start) || sealed.SHA256 != meta.SHA256 || sealed.Review != meta.Review {
+		t.Errorf("sealing changed the public fields: %+v", sealed)
+	}
+	for _, text := range []string{"firefox", "Private mail", "bank"} {
+		if bytes.Contains(sealed.Sealed, []byte(text)) {
+			t.Errorf("sealed data contains %q in plain text", text)
+		}
+	}
+
+	// Through the sidecar file, as the recorder stores it
+	segment := t.TempDir() + "/segment.mkv"
+	if err := Save(segment, sealed); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(segment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsealed, err := loaded.Unseal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unsealed, meta) {
+		t.Errorf("unsealed metadata = %+v, want %+v", unsealed, meta)
+	}
+
+	if _, err := loaded.Unseal([]byte("wrong")); err == nil {
+		t.Errorf("unsealing with the wrong secret succeeded")
+	}
+	if plain, err := meta.Unseal(nil); err != nil || !reflect.DeepEqual(plain, meta) {
+		t.Errorf("unsealing metadata that isn't sealed = %+v, %v", plain, err)
+	}
+}
+
+func TestTimeAtAndOffsetAt(t *testing.T) {
+	base := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	minute := func(m float64) time.Time { return base.Add(time.Duration(m * float64(time.Minute))) }
+
+	plain := Segment{Start: base, End: minute(1)}
+	// Two recordings merged into one file, with a pause from 9:01 to 9:05
+	merged := Segment{Start: base, End: minute(6), Parts: []Part{
+		{Offset: 0, Start: minute(0), End: minute(1)},
+		{Offset: 60, Start: minute(5), End: minute(6)},
+	}}
+
+	tests := []struct {
+		name   string
+		meta   Segment
+		offset float64
+		time   time.Time
+	}{
+		{"plain start", plain, 0, minute(0)},
+		{"plain middle", plain, 30, minute(0.5)},
+		{"first part", merged, 30, minute(0.5)},
+		{"second part start", merged, 60, minute(5)},
+		{"second part", merged, 90, minute(5.5)},
+		{"past the end", merged, 150, minute(6.5)},
+	}
+	for _, test := range tests {
+		if got := test.meta.TimeAt(test.offset); !got.Equal(test.time) {
+			t.Errorf("%s: TimeAt(%g) = %s, want %s", test.name, test.offset, got, test.time)
+		}
+		if got := test.meta.OffsetAt(test.time); got != test.offset {
+			t.Errorf("%s: OffsetAt(%s) = %g, want %g", test.name, test.time, got, test.offset)
+		}
+	}
+
+	// Times in the pause map to the start of the part after it
+	if got := merged.OffsetAt(minute(3)); got != 60 {
+		t.Errorf("OffsetAt in the pause = %g, want 60", got)
+	}
+	if got := merged.OffsetAt(minute(-1)); got != 0 {
+		t.Errorf("OffsetAt before the first part = %g, want 0", got)
+	}
+}
@@ -0,0 +1,17 @@
+package notify
+
+import (
+	"log"
+	"os/exec"
+)
+
+// Send shows a desktop notification via notify-send. Missing notify-send or a
+// missing notification daemon only gets logged, notifications are best effort.
+func Send(summary string, body string) {
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return
+	}
+	if err := exec.Command("notify-send", "--app-name=dashcam", summary, body).Run(); err != nil {
+		log.Printf("Warning: Could not send notification: %v", err)
+	}
+}
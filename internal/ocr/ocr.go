@@ -0,0 +1,28 @@
+package ocr
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Available reports whether the tesseract binary can be found
+func Available() bool {
+	_, err := exec.LookPath("tesseract")
+	return err == nil
+}
+
+// Text runs tesseract on an image and returns the recognized text with
+// whitespace collapsed, so every frame becomes a single searchable line
+func Text(image string, language string) (string, error) {
+	args := []string{image, "stdout"}
+	if language != "" {
+		args = append(args, "-l", language)
+	}
+
+	output, err := exec.Command("tesseract", args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract failed on '%s': %v", image, err)
+	}
+	return strings.Join(strings.Fields(string(output)), " "), nil
+}
@@ -0,0 +1,168 @@
+package screenshare
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultProcesses are remote desktop servers that share the screen with other people
+var DefaultProcesses = []string{"wayvnc", "krfb", "x11vnc", "rustdesk", "sunshine", "weylus"}
+
+// screencastNodeNames identify PipeWire nodes created by the desktop portals for a screen cast
+var screencastNodeNames = []string{"xdpw", "xdph", "screencast", "screen-cast", "gnome-shell-screen"}
+
+// Detect reports whether the screen is currently shared with someone else:
+// either an active portal ScreenCast stream in PipeWire that isn't dashcam's
+// own capture (e.g. the portal backend) or a running remote desktop server from
+// the given process list. The returned string describes what was found.
+func Detect(processes []string) (string, bool) {
+	if name, ok := activeScreencast(); ok {
+		return "screencast: " + name, true
+	}
+	if name, ok := runningProcess(processes); ok {
+		return "remote desktop: " + name, true
+	}
+	return "", false
+}
+
+// pwObject is the subset of pw-dump output we need
+type pwObject struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	Info struct {
+		State      string         `json:"state"`
+		Props      map[string]any `json:"props"`
+		OutputNode int            `json:"output-node-id"` // Links only
+		InputNode  int            `json:"input-node-id"`
+	} `json:"info"`
+}
+
+// activeScreencast looks for a running portal screen cast stream via pw-dump
+func activeScreencast() (string, bool) {
+	output, err := exec.Command("pw-dump").Output()
+	if err != nil {
+		return "", false
+	}
+
+	var objects []pwObject
+	if err := json.Unmarshal(output, &objects); err != nil {
+		return "", false
+	}
+	return findScreencast(objects, ownProcess)
+}
+
+// findScreencast returns a running screen cast node in the pw-dump objects that
+// is consumed by a process other than our own. A stream without any known
+// consumer counts as well.
+func findScreencast(objects []pwObject, own func(pid int) bool) (string, bool) {
+	nodes := make(map[int]pwObject)
+	for _, object := range objects {
+		if object.Type == "PipeWire:Interface:Node" {
+			nodes[object.ID] = object
+		}
+	}
+
+	for _, object := range objects {
+		if object.Type != "PipeWire:Interface:Node" || object.Info.State != "running" {
+			continue
+		}
+		if class, _ := object.Info.Props["media.class"].(string); class != "Video/Source" {
+			continue
+		}
+
+		nodeName, _ := object.Info.Props["node.name"].(string)
+		mediaName, _ := object.Info.Props["media.name"].(string)
+		for _, pattern := range screencastNodeNames {
+			if strings.Contains(strings.ToLower(nodeName), pattern) || strings.Contains(strings.ToLower(mediaName), pattern) {
+				if foreignConsumer(object.ID, objects, nodes, own) {
+					return nodeName, true
+				}
+				break
+			}
+		}
+	}
+	return "", false
+}
+
+// foreignConsumer reports whether a node is linked to a node of another process
+// than our own, or to none we know the process of
+func foreignConsumer(node int, objects []pwObject, nodes map[int]pwObject, own func(pid int) bool) bool {
+	consumers := 0
+	for _, object := range objects {
+		if object.Type != "PipeWire:Interface:Link" || object.Info.OutputNode != node {
+			continue
+		}
+		consumers++
+		pid, ok := processID(nodes[object.Info.InputNode].Info.Props["application.process.id"])
+		if !ok || !own(pid) {
+			return true
+		}
+	}
+	return consumers == 0
+}
+
+// processID reads a process id property, which pw-dump gives as a number or a string
+func processID(value any) (int, bool) {
+	switch value := value.(type) {
+	case float64:
+		return int(value), true
+	case string:
+		pid, err := strconv.Atoi(value)
+		return pid, err == nil
+	}
+	return 0, false
+}
+
+// ownProcess reports whether pid is this process or one of its descendants,
+// such as the capture command
+func ownProcess(pid int) bool {
+	self := os.Getpid()
+	for pid > 1 {
+		if pid == self {
+			return true
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err != nil {
+			return false
+		}
+		// The command name in parentheses may contain spaces; the parent follows the state
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) < 2 {
+			return false
+		}
+		if pid, err = strconv.Atoi(fields[1]); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// runningProcess returns the first process from the list found in /proc
+func runningProcess(processes []string) (string, bool) {
+	if len(processes) == 0 {
+		return "", false
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return "", false
+	}
+
+	for _, entry := range entries {
+		comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil {
+			continue // Not a process directory, or the process already exited
+		}
+		name := strings.TrimSpace(string(comm))
+		for _, process := range processes {
+			if name == process {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,82 @@
+package screenshare
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// dump is pw-dump output with a running portal stream (40) that consumers 50 and
+// 60 may be linked to
+const dump = `[
+	{"id": 40, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+		"props": {"media.class": "Video/Source", "node.name": "xdph-streaming-0"}}},
+	{"id": 41, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+		"props": {"media.class": "Video/Source", "node.name": "v4l2_input.pci-0000_00_14.0"}}},
+	{"id": 50, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+		"props": {"media.class": "Stream/Input/Video", "application.process.id": 100}}},
+	{"id": 60, "type": "PipeWire:Interface:Node", "info": {"state": "running",
+		"props": {"media.class": "Stream/Input/Video", "application.process.id": "200"}}}
+]`
+
+// link returns a pw-dump link from node output to node input
+func link(output int, input int) pwObject {
+	var object pwObject
+	object.Type = "PipeWire:Interface:Link"
+	object.Info.OutputNode = output
+	object.Info.InputNode = input
+	return object
+}
+
+func TestFindScreencast(t *testing.T) {
+	var nodes []pwObject
+	if err := json.Unmarshal([]byte(dump), &nodes); err != nil {
+		t.Fatal(err)
+	}
+	own := func(pid int) bool { return pid == 100 }
+
+	tests := []struct {
+		name  string
+		links []pwObject
+		want  bool
+	}{
+		{"no consumer known", nil, true},
+		{"own capture", []pwObject{link(40, 50)}, false},
+		{"someone else", []pwObject{link(40, 60)}, true},
+		{"own capture and someone else", []pwObject{link(40, 50), link(40, 60)}, true},
+		{"unknown consumer node", []pwObject{link(40, 70)}, true},
+		{"only the camera is consumed", []pwObject{link(40, 50), link(41, 60)}, false},
+	}
+	for _, test := range tests {
+		name, sharing := findScreencast(append(append([]pwObject{}, nodes...), test.links...), own)
+		if sharing != test.want {
+			t.Errorf("%s: sharing = %v, want %v", test.name, sharing, test.want)
+		}
+		if sharing && name != "xdph-streaming-0" {
+			t.Errorf("%s: found %q, want the portal stream", test.name, name)
+		}
+	}
+}
+
+func TestOwnProcess(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	if !ownProcess(os.Getpid()) {
+		t.Errorf("this process isn't reported as our own")
+	}
+	if ownProcess(os.Getppid()) {
+		t.Errorf("the parent process is reported as our own")
+	}
+
+	// Like the capture command
+	child := exec.Command("sleep", "5")
+	if err := child.Start(); err != nil {
+		t.Skip(err)
+	}
+	defer child.Process.Kill()
+	if !ownProcess(child.Process.Pid) {
+		t.Errorf("a child process isn't reported as our own")
+	}
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Desktop is the kind of graphical session dashcam runs in
+type Desktop string
+
+const (
+	Hyprland Desktop = "Hyprland"
+	Sway     Desktop = "Sway"
+	Wlroots  Desktop = "wlroots" // Another wlroots-based compositor (river, labwc, Wayfire, ...)
+	GNOME    Desktop = "GNOME"
+	KDE      Desktop = "KDE Plasma"
+	X11      Desktop = "X11"
+	Windows  Desktop = "Windows"
+	None     Desktop = "none"
+)
+
+// Detect determines the desktop session from the environment
+func Detect() Desktop {
+	if runtime.GOOS == "windows" {
+		return Windows
+	}
+	switch {
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		return Hyprland
+	case os.Getenv("SWAYSOCK") != "":
+		return Sway
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		// XDG_CURRENT_DESKTOP is a colon-separated list, e.g. ubuntu:GNOME
+		current := strings.ToUpper(os.Getenv("XDG_CURRENT_DESKTOP"))
+		switch {
+		case strings.Contains(current, "GNOME"):
+			return GNOME
+		case strings.Contains(current, "KDE"):
+			return KDE
+		}
+		return Wlroots
+	case os.Getenv("DISPLAY") != "":
+		return X11
+	}
+	return None
+}
+
+// CaptureBackend returns the name of the capture backend that records the desktop
+func (d Desktop) CaptureBackend() string {
+	switch d {
+	case GNOME, KDE:
+		// Neither supports the wlroots screencopy protocol; the portal works everywhere
+		return "portal"
+	case X11:
+		return "x11grab"
+	case Windows:
+		return "ddagrab"
+	}
+	return "wf-recorder"
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// WaylandSocketPath returns the path of the compositor socket for the current session
+func WaylandSocketPath() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		return "", fmt.Errorf("WAYLAND_DISPLAY not set - are you running under Wayland?")
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		return "", fmt.Errorf("XDG_RUNTIME_DIR not set")
+	}
+	return filepath.Join(runtimeDir, display), nil
+}
+
+// WatchWayland connects to the compositor and returns a channel that is closed
+// once the compositor drops the connection, i.e. when the session ends, or once
+// ctx is cancelled
+func WatchWayland(ctx context.Context) (<-chan struct{}, error) {
+	socketPath, err := WaylandSocketPath()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to compositor at %s: %v", socketPath, err)
+	}
+
+	ended := make(chan struct{})
+	// Closing the connection ends the read below
+	stopWatching := context.AfterFunc(ctx, func() { conn.Close() })
+	go func() {
+		defer stopWatching()
+		defer conn.Close()
+		defer close(ended)
+
+		// We never send requests, so the compositor never writes to us.
+		// Read only returns once the connection is closed.
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	return ended, nil
+}
@@ -0,0 +1,46 @@
+package shred
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+// File overwrites a file with random data before removing it, so the contents
+// can't be recovered by simply undeleting it. On copy-on-write filesystems and
+// SSDs with wear levelling this is best effort only.
+func File(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open '%s' for shredding: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat '%s': %w", path, err)
+	}
+
+	if _, err := io.CopyN(file, rand.Reader, info.Size()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to overwrite '%s': %w", path, err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync '%s': %w", path, err)
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to truncate '%s': %w", path, err)
+	}
+	file.Close()
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package subtitle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Cue is a subtitle shown between Start and End, in seconds from the start of the video
+type Cue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// FormatSRT renders cues in SubRip format
+func FormatSRT(cues []Cue) string {
+	var srt strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&srt, "%d\n%s --> %s\n%s\n\n", i+1, timestamp(cue.Start), timestamp(cue.End), strings.TrimSpace(cue.Text))
+	}
+	return srt.String()
+}
+
+// WriteSRT writes cues to a SubRip file
+func WriteSRT(path string, cues []Cue) error {
+	return os.WriteFile(path, []byte(FormatSRT(cues)), 0600)
+}
+
+// timestamp formats seconds as HH:MM:SS,mmm
+func timestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,65 @@
+package subtitle
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadVTT parses the cues of a WebVTT file
+func ReadVTT(path string) ([]Cue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cues []Cue
+	var current *Cue
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if start, end, ok := strings.Cut(line, "-->"); ok {
+			cues = append(cues, Cue{Start: parseVTTTimestamp(start), End: parseVTTTimestamp(end)})
+			current = &cues[len(cues)-1]
+			continue
+		}
+		if line == "" {
+			current = nil
+			continue
+		}
+		if current != nil {
+			current.Text = strings.TrimSpace(current.Text + " " + line)
+		}
+	}
+	return cues, nil
+}
+
+// parseVTTTimestamp parses [HH:]MM:SS.mmm into seconds, ignoring cue settings
+func parseVTTTimestamp(value string) float64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(fields[0], ":") {
+		var n float64
+		fmt.Sscanf(part, "%g", &n)
+		seconds = seconds*60 + n
+	}
+	return seconds
+}
+
+// WriteVTT writes cues to a WebVTT file
+func WriteVTT(path string, cues []Cue) error {
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&vtt, "%s --> %s\n%s\n\n", vttTimestamp(cue.Start), vttTimestamp(cue.End), strings.TrimSpace(cue.Text))
+	}
+	return os.WriteFile(path, []byte(vtt.String()), 0600)
+}
+
+// vttTimestamp formats seconds as HH:MM:SS.mmm
+func vttTimestamp(seconds float64) string {
+	return strings.Replace(timestamp(seconds), ",", ".", 1)
+}
@@ -0,0 +1,145 @@
+package sysstat
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is the system load over the interval ending at Time
+type Sample struct {
+	Time    time.Time
+	CPU     float64 // Share of busy CPU time, 0 to 1
+	Memory  float64 // Share of memory in use (not available to applications), 0 to 1
+	RxBytes float64 // Bytes received per second over all non-loopback interfaces
+	TxBytes float64 // Bytes sent per second over all non-loopback interfaces
+}
+
+// counters are the raw cumulative values read from /proc
+type counters struct {
+	time    time.Time
+	busy    uint64
+	total   uint64
+	rxBytes uint64
+	txBytes uint64
+}
+
+// Sampler turns the cumulative counters in /proc into rates between calls
+type Sampler struct {
+	previous *counters
+}
+
+// Read returns the load since the previous call. The first call only primes the
+// sampler and reports false.
+func (s *Sampler) Read() (Sample, bool, error) {
+	current, err := readCounters()
+	if err != nil {
+		return Sample{}, false, err
+	}
+	memory, err := readMemory()
+	if err != nil {
+		return Sample{}, false, err
+	}
+
+	previous := s.previous
+	s.previous = &current
+	if previous == nil {
+		return Sample{}, false, nil
+	}
+
+	sample := Sample{Time: current.time, Memory: memory}
+	if total := current.total - previous.total; total > 0 {
+		sample.CPU = float64(current.busy-previous.busy) / float64(total)
+	}
+	if seconds := current.time.Sub(previous.time).Seconds(); seconds > 0 {
+		// Counters go backwards when an interface disappears; report no traffic then
+		if current.rxBytes >= previous.rxBytes {
+			sample.RxBytes = float64(current.rxBytes-previous.rxBytes) / seconds
+		}
+		if current.txBytes >= previous.txBytes {
+			sample.TxBytes = float64(current.txBytes-previous.txBytes) / seconds
+		}
+	}
+	return sample, true, nil
+}
+
+// readCounters reads the CPU times from /proc/stat and the traffic from /proc/net/dev
+func readCounters() (counters, error) {
+	c := counters{time: time.Now()}
+
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return c, fmt.Errorf("failed to read CPU times: %w", err)
+	}
+	line, _, _ := strings.Cut(string(stat), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return c, fmt.Errorf("unexpected /proc/stat format")
+	}
+	// user nice system idle iowait irq softirq steal ...
+	for i, field := range fields[1:] {
+		value, _ := strconv.ParseUint(field, 10, 64)
+		c.total += value
+		if i != 3 && i != 4 {
+			c.busy += value
+		}
+	}
+
+	dev, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return c, fmt.Errorf("failed to read network traffic: %w", err)
+	}
+	defer dev.Close()
+
+	scanner := bufio.NewScanner(dev)
+	for scanner.Scan() {
+		name, values, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(values)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		c.rxBytes += rx
+		c.txBytes += tx
+	}
+	return c, scanner.Err()
+}
+
+// readMemory returns the share of memory not available to applications
+func readMemory() (float64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read memory usage: %w", err)
+	}
+	defer file.Close()
+
+	var total, available float64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseFloat(fields[1], 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+		case "MemAvailable:":
+			available = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("unexpected /proc/meminfo format")
+	}
+	return 1 - available/total, nil
+}
@@ -0,0 +1,32 @@
+package thumbnail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CacheDir returns the directory thumbnails are cached in
+func CacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "dashcam", "thumbnails")
+}
+
+// key derives the cache key from a segment's file name
+func key(segment string) string {
+	name := filepath.Base(segment)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Path returns the cached mid-segment thumbnail of a segment
+func Path(segment string) string {
+	return filepath.Join(CacheDir(), key(segment)+".jpg")
+}
+
+// SpritePath returns the cached sprite sheet of a segment
+func SpritePath(segment string) string {
+	return filepath.Join(CacheDir(), key(segment)+".sprite.jpg")
+}
@@ -0,0 +1,38 @@
+package transcribe
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DefaultCommand is the whisper.cpp command line client
+const DefaultCommand = "whisper-cli"
+
+// Extension is the file extension of transcripts
+const Extension = ".vtt"
+
+// Available reports whether the whisper.cpp client can be found
+func Available(command string) bool {
+	_, err := exec.LookPath(command)
+	return err == nil
+}
+
+// VTT transcribes a 16 kHz WAV file with whisper.cpp and writes the result as WebVTT to dst
+func VTT(command string, model string, language string, wav string, dst string) error {
+	if language == "" {
+		language = "auto"
+	}
+
+	// whisper.cpp appends the extension to the output base name itself
+	base := strings.TrimSuffix(dst, Extension)
+	cmd := exec.Command(command, "-m", model, "-l", language, "-f", wav, "-ovtt", "-of", base, "-np")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	if base+Extension != dst {
+		return os.Rename(base+Extension, dst)
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+// Package tray shows an icon with a menu in the system tray through the
+// StatusNotifierItem D-Bus protocol, which waybar, KDE Plasma, GNOME (with the
+// AppIndicator extension) and most other panels host. The menu is served with
+// the dbusmenu protocol.
+package tray
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+	"log"
+	"os"
+	"sync"
+)
+
+const (
+	itemPath      = "/StatusNotifierItem"
+	itemInterface = "org.kde.StatusNotifierItem"
+	menuPath      = "/MenuBar"
+	menuInterface = "com.canonical.dbusmenu"
+	watcherName   = "org.kde.StatusNotifierWatcher"
+	watcherPath   = "/StatusNotifierWatcher"
+)
+
+// Item is an entry of the tray menu
+type Item struct {
+	Label     string
+	Disabled  bool
+	Separator bool   // A line between groups of items; the other fields are ignored
+	Action    func() // Called on a goroutine of its own when the item is clicked
+	Children  []Item // Shown as a submenu
+}
+
+// Tray is an icon in the system tray
+type Tray struct {
+	conn  *dbus.Conn
+	name  string
+	props *prop.Properties
+
+	mutex    sync.Mutex
+	revision uint32
+	nodes    map[int32]*node // The menu by item ID; 0 is the root
+}
+
+// node is a menu item as served over dbusmenu
+type node struct {
+	properties map[string]dbus.Variant
+	children   []int32
+	action     func()
+}
+
+// pixmap is an icon image; icons are given by name, so none are sent
+type pixmap struct {
+	Width  int32
+	Height int32
+	Data   []byte
+}
+
+// toolTip is the StatusNotifierItem tool tip: icon name, icon images, title and text
+type toolTip struct {
+	IconName   string
+	IconPixmap []pixmap
+	Title      string
+	Text       string
+}
+
+// New shows an icon with the given ID and title in the tray of the session. A
+// tray that starts later picks the icon up.
+func New(id string, title string, icon string) (*Tray, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session bus: %w", err)
+	}
+
+	t := &Tray{
+		conn:  conn,
+		name:  fmt.Sprintf("org.kde.StatusNotifierItem-%d-1", os.Getpid()),
+		nodes: map[int32]*node{0: {properties: map[string]dbus.Variant{"children-display": dbus.MakeVariant("submenu")}}},
+	}
+	if err := t.export(id, title, icon); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := conn.RequestName(t.name, dbus.NameFlagDoNotQueue)
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		err = fmt.Errorf("it is taken")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to claim bus name %s: %w", t.name, err)
+	}
+
+	// Register again whenever a tray (re)starts
+	err = conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, watcherName),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to watch for trays: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+	go func() {
+		for signal := range signals {
+			if len(signal.Body) != 3 {
+				continue
+			}
+			if owner, _ := signal.Body[2].(string); owner != "" {
+				t.register()
+			}
+		}
+	}()
+
+	t.register()
+	return t, nil
+}
+
+// export serves the icon and the menu on the bus
+func (t *Tray) export(id string, title string, icon string) error {
+	itemProps := map[string]*prop.Prop{
+		"Category":          {Value: "ApplicationStatus", Emit: prop.EmitFalse},
+		"Id":                {Value: id, Emit: prop.EmitFalse},
+		"Title":             {Value: title, Emit: prop.EmitFalse},
+		"Status":            {Value: "Active", Emit: prop.EmitFalse},
+		"WindowId":          {Value: int32(0), Emit: prop.EmitFalse},
+		"IconName":          {Value: icon, Emit: prop.EmitFalse},
+		"IconPixmap":        {Value: []pixmap{}, Emit: prop.EmitFalse},
+		"IconThemePath":     {Value: "", Emit: prop.EmitFalse},
+		"OverlayIconName":   {Value: "", Emit: prop.EmitFalse},
+		"AttentionIconName": {Value: "", Emit: prop.EmitFalse},
+		"ToolTip":           {Value: toolTip{IconName: icon, IconPixmap: []pixmap{}, Title: title}, Emit: prop.EmitFalse},
+		"ItemIsMenu":        {Value: true, Emit: prop.EmitFalse},
+		"Menu":              {Value: dbus.ObjectPath(menuPath), Emit: prop.EmitFalse},
+	}
+	menuProps := map[string]*prop.Prop{
+		"Version":       {Value: uint32(3), Emit: prop.EmitFalse},
+		"TextDirection": {Value: "ltr", Emit: prop.EmitFalse},
+		"Status":        {Value: "normal", Emit: prop.EmitFalse},
+		"IconThemePath": {Value: []string{}, Emit: prop.EmitFalse},
+	}
+
+	var err error
+	if t.props, err = prop.Export(t.conn, itemPath, prop.Map{itemInterface: itemProps}); err != nil {
+		return fmt.Errorf("failed to export tray icon: %w", err)
+	}
+	menuProperties, err := prop.Export(t.conn, menuPath, prop.Map{menuInterface: menuProps})
+	if err != nil {
+		return fmt.Errorf("failed to export tray menu: %w", err)
+	}
+	if err := t.conn.Export(item{}, itemPath, itemInterface); err != nil {
+		return fmt.Errorf("failed to export tray icon: %w", err)
+	}
+	if err := t.conn.Export(menu{t}, menuPath, menuInterface); err != nil {
+		return fmt.Errorf("failed to export tray menu: %w", err)
+	}
+
+	// Some trays look the interfaces up before using them
+	exports := []struct {
+		path  dbus.ObjectPath
+		iface introspect.Interface
+	}{
+		{itemPath, introspect.Interface{
+			Name:       itemInterface,
+			Methods:    introspect.Methods(item{}),
+			Properties: t.props.Introspection(itemInterface),
+			Signals:    []introspect.Signal{{Name: "NewIcon"}, {Name: "NewToolTip"}, {Name: "NewStatus", Args: []introspect.Arg{{Name: "status", Type: "s"}}}},
+		}},
+		{menuPath, introspect.Interface{
+			Name:       menuInterface,
+			Methods:    introspect.Methods(menu{}),
+			Properties: menuProperties.Introspection(menuInterface),
+			Signals:    []introspect.Signal{{Name: "LayoutUpdated", Args: []introspect.Arg{{Name: "revision", Type: "u"}, {Name: "parent", Type: "i"}}}},
+		}},
+	}
+	for _, export := range exports {
+		node := &introspect.Node{
+			Name:       string(export.path),
+			Interfaces: []introspect.Interface{introspect.IntrospectData, prop.IntrospectData, export.iface},
+		}
+		if err := t.conn.Export(introspect.NewIntrospectable(node), export.path, "org.freedesktop.DBus.Introspectable"); err != nil {
+			return fmt.Errorf("failed to export introspection data: %w", err)
+		}
+	}
+	return nil
+}
+
+// register announces the icon to the tray, if one is running
+func (t *Tray) register() {
+	call := t.conn.Object(watcherName, watcherPath).Call(watcherName+".RegisterStatusNotifierItem", 0, t.name)
+	if call.Err != nil {
+		log.Printf("Warning: No system tray found, the icon shows once one starts: %v", call.Err)
+	}
+}
+
+// SetIcon changes the icon and its tool tip. attention asks the tray to draw
+// attention to the icon, e.g. by highlighting it.
+func (t *Tray) SetIcon(icon string, title string, text string, attention bool) {
+	status := "Active"
+	if attention {
+		status = "NeedsAttention"
+	}
+	t.props.SetMust(itemInterface, "IconName", icon)
+	t.props.SetMust(itemInterface, "AttentionIconName", icon)
+	t.props.SetMust(itemInterface, "ToolTip", toolTip{IconName: icon, IconPixmap: []pixmap{}, Title: title, Text: text})
+	t.props.SetMust(itemInterface, "Status", status)
+
+	t.conn.Emit(itemPath, itemInterface+".NewIcon")
+	t.conn.Emit(itemPath, itemInterface+".NewToolTip")
+	t.conn.Emit(itemPath, itemInterface+".NewStatus", status)
+}
+
+// SetMenu replaces the menu
+func (t *Tray) SetMenu(items []Item) {
+	t.mutex.Lock()
+	root := t.nodes[0]
+	root.children = nil
+	t.nodes = map[int32]*node{0: root}
+	nextID := int32(1)
+	root.children = t.addNodes(items, &nextID)
+	t.revision++
+	revision := t.revision
+	t.mutex.Unlock()
+
+	t.conn.Emit(menuPath, menuInterface+".LayoutUpdated", revision, int32(0))
+}
+
+// addNodes numbers items and their submenus from nextID on and returns their IDs;
+// the caller holds the mutex
+func (t *Tray) addNodes(items []Item, nextID *int32) []int32 {
+	var ids []int32
+	for _, item := range items {
+		id := *nextID
+		*nextID++
+		n := &node{properties: map[string]dbus.Variant{}, action: item.Action}
+		if item.Separator {
+			n.properties["type"] = dbus.MakeVariant("separator")
+		} else {
+			n.properties["label"] = dbus.MakeVariant(item.Label)
+			n.properties["enabled"] = dbus.MakeVariant(!item.Disabled)
+		}
+		t.nodes[id] = n
+		if len(item.Children) > 0 {
+			n.properties["children-display"] = dbus.MakeVariant("submenu")
+			n.children = t.addNodes(item.Children, nextID)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Close removes the icon from the tray
+func (t *Tray) Close() error {
+	return t.conn.Close()
+}
+
+// item serves the StatusNotifierItem methods. The icon only opens its menu
+// (ItemIsMenu), so clicks on it need no handling.
+type item struct{}
+
+func (item) Activate(x, y int32) *dbus.Error                    { return nil }
+func (item) SecondaryActivate(x, y int32) *dbus.Error           { return nil }
+func (item) ContextMenu(x, y int32) *dbus.Error                 { return nil }
+func (item) Scroll(delta int32, orientation string) *dbus.Error { return nil }
+
+// menu serves the dbusmenu methods
+type menu struct {
+	t *Tray
+}
+
+// layout is an item of the menu with its submenu, as (ia{sv}av)
+type layout struct {
+	ID         int32
+	Properties map[string]dbus.Variant
+	Children   []dbus.Variant
+}
+
+// properties is an item's properties, as (ia{sv})
+type properties struct {
+	ID         int32
+	Properties map[string]dbus.Variant
+}
+
+// event is something that happened to an item, e.g. a click, as (isvu)
+type event struct {
+	ID        int32
+	EventID   string
+	Data      dbus.Variant
+	Timestamp uint32
+}
+
+// errUnknownItem is returned for IDs of items that don't exist (any more)
+var errUnknownItem = dbus.NewError("com.canonical.dbusmenu.Error.UnknownItem", []any{"unknown menu item"})
+
+func (m menu) GetLayout(parentID int32, depth int32, names []string) (uint32, layout, *dbus.Error) {
+	m.t.mutex.Lock()
+	defer m.t.mutex.Unlock()
+
+	if _, ok := m.t.nodes[parentID]; !ok {
+		return 0, layout{}, errUnknownItem
+	}
+	return m.t.revision, m.t.layout(parentID, depth, names), nil
+}
+
+// layout returns an item and its submenu down to depth levels (-1 for all); the
+// caller holds the mutex
+func (t *Tray) layout(id int32, depth int32, names []string) layout {
+	n := t.nodes[id]
+	l := layout{ID: id, Properties: filterProperties(n.properties, names), Children: []dbus.Variant{}}
+	if depth == 0 {
+		return l
+	}
+	for _, child := range n.children {
+		l.Children = append(l.Children, dbus.MakeVariant(t.layout(child, depth-1, names)))
+	}
+	return l
+}
+
+// filterProperties returns the named properties, or all if no names are given
+func filterProperties(all map[string]dbus.Variant, names []string) map[string]dbus.Variant {
+	if len(names) == 0 {
+		return all
+	}
+	filtered := map[string]dbus.Variant{}
+	for _, name := range names {
+		if value, ok := all[name]; ok {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+func (m menu) GetGroupProperties(ids []int32, names []string) ([]properties, *dbus.Error) {
+	m.t.mutex.Lock()
+	defer m.t.mutex.Unlock()
+
+	result := []properties{}
+	for _, id := range ids {
+		if n, ok := m.t.nodes[id]; ok {
+			result = append(result, properties{ID: id, Properties: filterProperties(n.properties, names)})
+		}
+	}
+	return result, nil
+}
+
+func (m menu) GetProperty(id int32, name string) (dbus.Variant, *dbus.Error) {
+	m.t.mutex.Lock()
+	defer m.t.mutex.Unlock()
+
+	n, ok := m.t.nodes[id]
+	if !ok {
+		return dbus.Variant{}, errUnknownItem
+	}
+	value, ok := n.properties[name]
+	if !ok {
+		return dbus.Variant{}, dbus.NewError("com.canonical.dbusmenu.Error.UnknownProperty", []any{"unknown property " + name})
+	}
+	return value, nil
+}
+
+func (m menu) Event(id int32, eventID string, data dbus.Variant, timestamp uint32) *dbus.Error {
+	if !m.t.handle(id, eventID) {
+		return errUnknownItem
+	}
+	return nil
+}
+
+func (m menu) EventGroup(events []event) ([]int32, *dbus.Error) {
+	unknown := []int32{}
+	for _, e := range events {
+		if !m.t.handle(e.ID, e.EventID) {
+			unknown = append(unknown, e.ID)
+		}
+	}
+	return unknown, nil
+}
+
+func (m menu) AboutToShow(id int32) (bool, *dbus.Error) {
+	return false, nil
+}
+
+func (m menu) AboutToShowGroup(ids []int32) ([]int32, []int32, *dbus.Error) {
+	return []int32{}, []int32{}, nil
+}
+
+// handle runs the action of a clicked item, reporting whether the item exists
+func (t *Tray) handle(id int32, eventID string) bool {
+	t.mutex.Lock()
+	n, ok := t.nodes[id]
+	t.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	if eventID == "clicked" && n.action != nil {
+		go n.action()
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Available reports whether rclone can be found
+func Available() bool {
+	_, err := exec.LookPath("rclone")
+	return err == nil
+}
+
+// Copy uploads a file into a directory on an rclone remote, e.g. "s3:bucket/dashcam" or
+// ":webdav,url='https://dav.example.com':dashcam". bandwidth limits the transfer rate
+// in rclone's --bwlimit syntax (e.g. "1M"); empty means unlimited.
+func Copy(ctx context.Context, src string, remote string, bandwidth string) error {
+	args := []string{"copyto", src, Join(remote, filepath.Base(src)), "--retries", "1", "--low-level-retries", "3"}
+	if bandwidth != "" {
+		args = append(args, "--bwlimit", bandwidth)
+	}
+
+	output, err := exec.CommandContext(ctx, "rclone", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rclone failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Join appends a file name to a remote path
+func Join(remote string, name string) string {
+	if strings.HasSuffix(remote, ":") || strings.HasSuffix(remote, "/") {
+		return remote + name
+	}
+	return remote + "/" + name
+}
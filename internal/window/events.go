@@ -0,0 +1,100 @@
+package window
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Watch calls changed whenever the compositor reports that the focused window
+// (or its title) changed, until ctx is cancelled or the event stream breaks.
+// It returns nil once ctx is cancelled, and an error if the compositor's
+// events can't be followed, in which case callers fall back to polling Focused.
+func Watch(ctx context.Context, changed func()) error {
+	var err error
+	switch {
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		err = watchHyprland(ctx, changed)
+	case os.Getenv("SWAYSOCK") != "":
+		err = watchSway(ctx, changed)
+	default:
+		return fmt.Errorf("no supported compositor found (Hyprland or Sway required)")
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// hyprlandEventSocket returns the path of Hyprland's event socket; Hyprland
+// before 0.40 kept it in /tmp
+func hyprlandEventSocket() string {
+	signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+	path := filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "hypr", signature, ".socket2.sock")
+	if _, err := os.Stat(path); err != nil {
+		return filepath.Join("/tmp", "hypr", signature, ".socket2.sock")
+	}
+	return path
+}
+
+// watchHyprland follows the activewindow and windowtitle events on Hyprland's
+// event socket
+func watchHyprland(ctx context.Context, changed func()) error {
+	path := hyprlandEventSocket()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Hyprland events at %s: %v", path, err)
+	}
+	defer conn.Close()
+	// Closing the connection ends the scan below
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		event, _, _ := strings.Cut(scanner.Text(), ">>")
+		switch event {
+		case "activewindow", "windowtitle", "closewindow":
+			changed()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read Hyprland events: %v", err)
+	}
+	return fmt.Errorf("Hyprland closed the event socket")
+}
+
+// watchSway follows sway's window events with swaymsg
+func watchSway(ctx context.Context, changed func()) error {
+	cmd := exec.CommandContext(ctx, "swaymsg", "-t", "subscribe", "-m", "-r", `["window"]`)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to subscribe to sway events: %v", err)
+	}
+	defer cmd.Wait()
+
+	decoder := json.NewDecoder(stdout)
+	for {
+		var event struct {
+			Change string `json:"change"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			cmd.Process.Kill()
+			return fmt.Errorf("sway event subscription ended: %v", err)
+		}
+		switch event.Change {
+		case "focus", "title", "close":
+			changed()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package window
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Window describes the currently focused window
+type Window struct {
+	AppID string `json:"app_id"`
+	Title string `json:"title"`
+}
+
+// Matches reports whether the window matches a pattern.
+// Patterns are compared to the app_id/class (case-insensitive);
+// a "title:" prefix matches a substring of the window title instead.
+func (w Window) Matches(pattern string) bool {
+	if rest, ok := strings.CutPrefix(pattern, "title:"); ok {
+		return rest != "" && strings.Contains(strings.ToLower(w.Title), strings.ToLower(rest))
+	}
+	return strings.EqualFold(w.AppID, pattern)
+}
+
+// MatchesAny returns the first pattern the window matches
+func (w Window) MatchesAny(patterns []string) (string, bool) {
+	for _, pattern := range patterns {
+		if w.Matches(pattern) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// Focused queries the compositor for the focused window
+func Focused() (Window, error) {
+	switch {
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		return focusedHyprland()
+	case os.Getenv("SWAYSOCK") != "":
+		return focusedSway()
+	default:
+		return Window{}, fmt.Errorf("no supported compositor found (Hyprland or Sway required)")
+	}
+}
+
+// focusedHyprland uses hyprctl to query the active window
+func focusedHyprland() (Window, error) {
+	output, err := exec.Command("hyprctl", "-j", "activewindow").Output()
+	if err != nil {
+		return Window{}, fmt.Errorf("failed to query hyprctl: %v", err)
+	}
+
+	var active struct {
+		Class string `json:"class"`
+		Title string `json:"title"`
+	}
+	// hyprctl prints an empty object when no window is focused
+	if err := json.Unmarshal(output, &active); err != nil {
+		return Window{}, fmt.Errorf("failed to parse hyprctl output: %v", err)
+	}
+	return Window{AppID: active.Class, Title: active.Title}, nil
+}
+
+// swayNode is the subset of the sway tree we care about
+type swayNode struct {
+	Focused          bool   `json:"focused"`
+	Name             string `json:"name"`
+	AppID            string `json:"app_id"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+// focusedSway walks the sway tree to find the focused window
+func focusedSway() (Window, error) {
+	output, err := exec.Command("swaymsg", "-t", "get_tree", "-r").Output()
+	if err != nil {
+		return Window{}, fmt.Errorf("failed to query swaymsg: %v", err)
+	}
+
+	var root swayNode
+	if err := json.Unmarshal(output, &root); err != nil {
+		return Window{}, fmt.Errorf("failed to parse swaymsg output: %v", err)
+	}
+
+	if node := findFocused(&root); node != nil {
+		appID := node.AppID
+		if appID == "" {
+			appID = node.WindowProperties.Class // XWayland window
+		}
+		return Window{AppID: appID, Title: node.Name}, nil
+	}
+	return Window{}, nil
+}
+
+// findFocused returns the focused node in the tree, if any
+func findFocused(node *swayNode) *swayNode {
+	if node.Focused {
+		return node
+	}
+	for i := range node.Nodes {
+		if found := findFocused(&node.Nodes[i]); found != nil {
+			return found
+		}
+	}
+	for i := range node.FloatingNodes {
+		if found := findFocused(&node.FloatingNodes[i]); found != nil {
+			return found
+		}
+	}
+	return nil
+}
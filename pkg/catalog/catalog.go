@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a piece of indexed text found in a segment
+type Entry struct {
+	Segment string    `json:"segment"` // File name of the (unencrypted) segment
+	Time    time.Time `json:"time"`    // Wall-clock time of the text
+	Offset  float64   `json:"offset"`  // Seconds from the segment start
+	Kind    string    `json:"kind"`    // Where the text came from, e.g. "ocr"
+	Text    string    `json:"text"`
+}
+
+// Matches reports whether the entry's text contains every (lowercase) term
+func (e Entry) Matches(terms []string) bool {
+	text := strings.ToLower(e.Text)
+	for _, term := range terms {
+		if !strings.Contains(text, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Catalog is a searchable text index stored as a JSON lines file
+type Catalog struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// Open returns the catalog stored at path; the file is created on first write
+func Open(path string) *Catalog {
+	return &Catalog{path: path}
+}
+
+// Path returns the location of the catalog file
+func (c *Catalog) Path() string {
+	return c.path
+}
+
+// Add appends entries to the catalog
+func (c *Catalog) Add(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	file, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open catalog '%s': %w", c.path, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// Search returns all entries containing every term (case-insensitive), oldest first
+func (c *Catalog) Search(terms []string) ([]Entry, error) {
+	lowerTerms := make([]string, 0, len(terms))
+	for _, term := range terms {
+		lowerTerms = append(lowerTerms, strings.ToLower(term))
+	}
+
+	var matches []Entry
+	err := c.each(func(entry Entry) {
+		if entry.Matches(lowerTerms) {
+			matches = append(matches, entry)
+		}
+	})
+	return matches, err
+}
+
+// RemoveSegments drops all entries of the given segments from the catalog
+func (c *Catalog) RemoveSegments(segments map[string]bool) error {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	return c.rewrite(func(entry Entry) (Entry, bool) {
+		return entry, !segments[entry.Segment]
+	})
+}
+
+// Relocate moves the entries of segments that were merged into segment, shifting
+// their offsets by where each merged segment starts (offsets maps name to start)
+func (c *Catalog) Relocate(segment string, offsets map[string]float64) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	return c.rewrite(func(entry Entry) (Entry, bool) {
+		if offset, ok := offsets[entry.Segment]; ok {
+			entry.Segment = segment
+			entry.Offset += offset
+		}
+		return entry, true
+	})
+}
+
+// rewrite replaces every entry with the result of fn, dropping those it doesn't keep
+func (c *Catalog) rewrite(fn func(Entry) (Entry, bool)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var kept []Entry
+	changed := false
+	if err := c.eachLocked(func(entry Entry) {
+		updated, keep := fn(entry)
+		if !keep || updated != entry {
+			changed = true
+		}
+		if keep {
+			kept = append(kept, updated)
+		}
+	}); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	// Rewrite through a temporary file so a crash never truncates the catalog
+	tmpPath := c.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite catalog '%s': %w", c.path, err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range kept {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	file.Close()
+	return os.Rename(tmpPath, c.path)
+}
+
+// each calls fn for every entry in the catalog
+func (c *Catalog) each(fn func(Entry)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.eachLocked(fn)
+}
+
+// eachLocked calls fn for every entry; the caller holds the mutex
+func (c *Catalog) eachLocked(fn func(Entry)) error {
+	file, err := os.Open(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open catalog '%s': %w", c.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024) // OCR text of a full screen can be long
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip damaged lines
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
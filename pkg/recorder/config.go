@@ -0,0 +1,431 @@
+package recorder
+
+import (
+	"dashcam/internal/capture"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/geo"
+	"dashcam/internal/mask"
+	"dashcam/internal/ocr"
+	"dashcam/internal/screenshare"
+	"dashcam/internal/session"
+	"dashcam/internal/transcribe"
+	"dashcam/internal/upload"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaskRegion is a rectangle of the screen hidden in the recording, see
+// Config.MaskRegions
+type MaskRegion = mask.Region
+
+// Config holds the application configuration
+type Config struct {
+	RecordingsDir    string       `json:"recordings_dir"`
+	MaxFiles         int          `json:"max_files"`
+	RecordingLength  int          `json:"recording_length_seconds"`
+	Extension        string       `json:"extension"`
+	Codec            string       `json:"codec"`
+	AdaptiveEncoding bool         `json:"adaptive_encoding"`     // Drop frames while the screen is static
+	SyncInterval     int          `json:"sync_interval_seconds"` // Flush segments to disk this often while recording; 0 disables
+	CaptureBackend   string       `json:"capture_backend"`
+	V4L2Device       string       `json:"v4l2_device"`
+	V4L2Size         string       `json:"v4l2_size"`
+	V4L2Framerate    int          `json:"v4l2_framerate"`
+	LibcameraCamera  int          `json:"libcamera_camera"`
+	CaptureDisplay   string       `json:"capture_display"` // Headless compositor or virtual X display
+	CaptureOutput    string       `json:"capture_output"`
+	Sources          []Source     `json:"sources"`
+	RecordAudio      bool         `json:"record_audio"`
+	AudioDevice      string       `json:"audio_device"` // DirectShow device recorded on Windows
+	CalendarPath     string       `json:"calendar_path"`
+	CalendarTag      string       `json:"calendar_pause_tag"`
+	PauseOnApps      []string     `json:"pause_on_apps"`
+	WindowSampleSecs int          `json:"window_sample_seconds"`
+	WindowChapters   bool         `json:"window_chapters"`
+	Subtitles        bool         `json:"subtitles"`
+	EmbedTags        bool         `json:"embed_tags"`
+	MuteOnApps       []string     `json:"mute_on_apps"`
+	MuteHotkey       string       `json:"mute_hotkey"`
+	MaskRegions      []MaskRegion `json:"mask_regions"`
+	Encrypt          bool         `json:"encrypt"`
+	EncryptionKey    string       `json:"encryption_key_file"`
+	Player           string       `json:"player"`
+	WipeHotkey       string       `json:"wipe_hotkey"`
+	Geolocation      bool         `json:"geolocation"`
+	GeoInterval      int          `json:"geolocation_interval_seconds"`
+	GeoCommand       string       `json:"geoclue_command"`
+	GPXSidecar       bool         `json:"gpx_sidecar"`
+	DailyMerge       bool         `json:"daily_merge"`
+	DailyTimelapse   bool         `json:"daily_timelapse"`
+	TimelapseLength  int          `json:"timelapse_length_seconds"`
+	ArchiveCodec     string       `json:"archive_codec"`
+	ArchiveCRF       int          `json:"archive_crf"`
+	ArchiveAfter     int          `json:"archive_after_days"`
+	UploadRemote     string       `json:"upload_remote"`
+	UploadAll        bool         `json:"upload_all"`
+	UploadBandwidth  string       `json:"upload_bandwidth"`
+	UploadRetries    int          `json:"upload_retries"`
+	SystemStats      bool         `json:"system_stats"`
+	StatsInterval    int          `json:"system_stats_interval_seconds"`
+	Thumbnails       bool         `json:"thumbnails"`
+	SpriteSheets     bool         `json:"sprite_sheets"`
+	ActivityScore    bool         `json:"activity_score"`
+	SceneDetection   bool         `json:"scene_detection"`
+	SceneThreshold   float64      `json:"scene_threshold"`
+	OCR              bool         `json:"ocr"`
+	OCRInterval      int          `json:"ocr_interval_seconds"`
+	OCRLanguage      string       `json:"ocr_language"`
+	Transcribe       bool         `json:"transcribe"`
+	WhisperCommand   string       `json:"whisper_command"`
+	WhisperModel     string       `json:"whisper_model"`
+	WhisperLanguage  string       `json:"whisper_language"`
+	ScreenShare      string       `json:"screen_share_action"`
+	ShareProcesses   []string     `json:"screen_share_processes"`
+	FileMode         string       `json:"file_mode"`
+	DirMode          string       `json:"dir_mode"`
+	EmergencyHotkey  string       `json:"emergency_hotkey"`
+	PrerollSeconds   int          `json:"preroll_seconds"` // Buffer the main source in memory instead of recording segments
+	JobWorkers       int          `json:"job_workers"`
+	JobNice          int          `json:"job_nice"`
+	TrayIcon         bool         `json:"tray_icon"`
+}
+
+// DefaultConfig returns the default configuration
+func DefaultConfig() Config {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = "."
+	}
+
+	return Config{
+		RecordingsDir:    filepath.Join(homeDir, "recordings"),
+		MaxFiles:         60,
+		RecordingLength:  60,
+		Extension:        ".mkv",
+		Codec:            "libx265",
+		AdaptiveEncoding: false,
+		SyncInterval:     5,
+		CaptureBackend:   "auto",
+		V4L2Device:       "/dev/video0",
+		V4L2Size:         "",
+		V4L2Framerate:    0,
+		LibcameraCamera:  0,
+		CaptureDisplay:   "",
+		CaptureOutput:    "",
+		Sources:          []Source{},
+		RecordAudio:      false,
+		AudioDevice:      "",
+		CalendarPath:     "",
+		CalendarTag:      "confidential",
+		PauseOnApps:      []string{},
+		WindowSampleSecs: 5,
+		WindowChapters:   false,
+		Subtitles:        false,
+		EmbedTags:        false,
+		MuteOnApps:       []string{},
+		MuteHotkey:       "",
+		MaskRegions:      []MaskRegion{},
+		Encrypt:          false,
+		EncryptionKey:    "",
+		Player:           "mpv",
+		WipeHotkey:       "",
+		Geolocation:      false,
+		GeoInterval:      30,
+		GeoCommand:       geo.DefaultCommand,
+		GPXSidecar:       false,
+		DailyMerge:       false,
+		DailyTimelapse:   false,
+		TimelapseLength:  90,
+		ArchiveCodec:     "",
+		ArchiveCRF:       32,
+		ArchiveAfter:     7,
+		UploadRemote:     "",
+		UploadAll:        false,
+		UploadBandwidth:  "",
+		UploadRetries:    5,
+		SystemStats:      false,
+		StatsInterval:    5,
+		Thumbnails:       true,
+		SpriteSheets:     false,
+		ActivityScore:    false,
+		SceneDetection:   false,
+		SceneThreshold:   10,
+		OCR:              false,
+		OCRInterval:      10,
+		OCRLanguage:      "eng",
+		Transcribe:       false,
+		WhisperCommand:   transcribe.DefaultCommand,
+		WhisperModel:     "",
+		WhisperLanguage:  "auto",
+		ScreenShare:      "",
+		ShareProcesses:   screenshare.DefaultProcesses,
+		FileMode:         "0600",
+		DirMode:          "0700",
+		EmergencyHotkey:  "",
+		PrerollSeconds:   0,
+		JobWorkers:       1,
+		JobNice:          10,
+		TrayIcon:         false,
+	}
+}
+
+// parseMode parses an octal permission string such as "0600"
+func parseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid permission mode '%s'", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Validate checks the configuration for values that would make recording unsafe
+func (c Config) Validate() error {
+	fileMode, err := parseMode(c.FileMode)
+	if err != nil {
+		return fmt.Errorf("file_mode: %v", err)
+	}
+	dirMode, err := parseMode(c.DirMode)
+	if err != nil {
+		return fmt.Errorf("dir_mode: %v", err)
+	}
+	if _, err := c.captureBackend(); err != nil {
+		return fmt.Errorf("capture_backend: %v", err)
+	}
+	if c.PrerollSeconds < 0 {
+		return fmt.Errorf("preroll_seconds must not be negative")
+	}
+	if c.SyncInterval < 0 {
+		return fmt.Errorf("sync_interval_seconds must not be negative")
+	}
+	if c.LibcameraCamera < 0 {
+		return fmt.Errorf("libcamera_camera must not be negative")
+	}
+	if err := c.validateSources(); err != nil {
+		return fmt.Errorf("sources: %v", err)
+	}
+	switch c.ScreenShare {
+	case "", "pause", "mark":
+	default:
+		return fmt.Errorf("screen_share_action: unknown action '%s' (use pause or mark)", c.ScreenShare)
+	}
+
+	if c.TimelapseLength <= 0 {
+		return fmt.Errorf("timelapse_length_seconds must be positive")
+	}
+	if c.ArchiveAfter < 1 {
+		return fmt.Errorf("archive_after_days must be at least 1")
+	}
+	if c.ArchiveCRF < 0 || c.ArchiveCRF > 63 {
+		return fmt.Errorf("archive_crf must be between 0 and 63")
+	}
+	if c.SceneThreshold <= 0 || c.SceneThreshold > 100 {
+		return fmt.Errorf("scene_threshold must be between 0 and 100")
+	}
+	if c.JobWorkers < 1 {
+		return fmt.Errorf("job_workers must be at least 1")
+	}
+	if c.JobNice < 0 || c.JobNice > 19 {
+		return fmt.Errorf("job_nice must be between 0 and 19")
+	}
+
+	if fileMode&0002 != 0 || dirMode&0002 != 0 {
+		return fmt.Errorf("file_mode and dir_mode must not be world-writable")
+	}
+
+	// Refuse to record with a broken mask rather than leaking the region
+	for _, region := range c.MaskRegions {
+		if err := region.Validate(); err != nil {
+			return fmt.Errorf("mask_regions: %v", err)
+		}
+	}
+	return nil
+}
+
+// withoutUnavailable returns the configuration with features turned off (with a
+// warning) whose tools aren't installed, or that would store in plain text what
+// encrypt protects
+func (c Config) withoutUnavailable() Config {
+	// Muting rewrites the audio track with ffmpeg
+	if c.RecordAudio && (len(c.MuteOnApps) > 0 || c.MuteHotkey != "") && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, audio mute windows are only written to metadata")
+	}
+	if (c.Thumbnails || c.SpriteSheets) && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, thumbnails are disabled")
+		c.Thumbnails = false
+		c.SpriteSheets = false
+	}
+	if c.OCR && c.Encrypt {
+		log.Printf("Warning: The catalog isn't encrypted, OCR indexing is disabled with encrypt")
+		c.OCR = false
+	}
+	if c.GPXSidecar && c.Encrypt {
+		log.Printf("Warning: GPX tracks aren't encrypted, gpx_sidecar is disabled with encrypt")
+		c.GPXSidecar = false
+	}
+	if c.OCR && (!ffmpeg.Available() || !ocr.Available()) {
+		log.Printf("Warning: ffmpeg or tesseract not found, OCR indexing is disabled")
+		c.OCR = false
+	}
+	if c.Transcribe {
+		switch {
+		case !c.RecordAudio:
+			log.Printf("Warning: record_audio is off, transcription is disabled")
+			c.Transcribe = false
+		case c.Encrypt:
+			log.Printf("Warning: Transcripts and the catalog aren't encrypted, transcription is disabled with encrypt")
+			c.Transcribe = false
+		case c.WhisperModel == "":
+			log.Printf("Warning: whisper_model is not set, transcription is disabled")
+			c.Transcribe = false
+		case !ffmpeg.Available() || !transcribe.Available(c.WhisperCommand):
+			log.Printf("Warning: ffmpeg or %s not found, transcription is disabled", c.WhisperCommand)
+			c.Transcribe = false
+		}
+	}
+	if c.SceneDetection && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, scene detection is disabled")
+		c.SceneDetection = false
+	}
+	if (c.DailyMerge || c.DailyTimelapse) && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, daily merge and timelapse are disabled")
+		c.DailyMerge = false
+		c.DailyTimelapse = false
+	}
+	if c.ArchiveCodec != "" && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, re-encoding old recordings is disabled")
+		c.ArchiveCodec = ""
+	}
+	if c.UploadRemote != "" && !upload.Available() {
+		log.Printf("Warning: rclone not found, uploads are disabled")
+		c.UploadRemote = ""
+	}
+	if c.ActivityScore && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, activity scores are disabled")
+		c.ActivityScore = false
+	}
+	if (c.WindowChapters || c.Subtitles || c.EmbedTags) && !ffmpeg.Available() {
+		log.Printf("Warning: ffmpeg not found, window chapters, subtitles and embedded tags are disabled")
+		c.WindowChapters = false
+		c.Subtitles = false
+		c.EmbedTags = false
+	}
+	return c
+}
+
+// CaptureBackendName returns the configured capture backend, or for auto the one
+// that records the display given or the detected desktop
+func (c Config) CaptureBackendName() string {
+	if c.CaptureBackend != "auto" {
+		return c.CaptureBackend
+	}
+	switch {
+	case strings.HasPrefix(c.CaptureDisplay, ":"):
+		return "x11grab"
+	case c.CaptureDisplay != "":
+		return "wf-recorder"
+	}
+	return session.Detect().CaptureBackend()
+}
+
+// captureBackend returns the configured capture backend
+func (c Config) captureBackend() (capture.Backend, error) {
+	backend, err := capture.New(c.CaptureBackendName(), capture.Settings{
+		Device:    c.V4L2Device,
+		Camera:    c.LibcameraCamera,
+		Size:      c.V4L2Size,
+		Framerate: c.V4L2Framerate,
+
+		Display: c.CaptureDisplay,
+		Output:  c.CaptureOutput,
+
+		AudioDevice: c.AudioDevice,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := backend.(capture.Unfiltered); ok && len(c.MaskRegions) > 0 {
+		return nil, fmt.Errorf("mask_regions can't be applied with %s", backend.Name())
+	}
+	if _, ok := backend.(capture.FileOnly); ok && c.PrerollSeconds > 0 {
+		return nil, fmt.Errorf("preroll_seconds isn't supported with %s", backend.Name())
+	}
+	return backend, nil
+}
+
+// FilePermissions returns the permissions for recordings and files made from them (validated at startup)
+func (c Config) FilePermissions() os.FileMode {
+	mode, err := parseMode(c.FileMode)
+	if err != nil {
+		return 0600
+	}
+	return mode
+}
+
+// DirPermissions returns the permissions for the recordings directory and export directories (validated at startup)
+func (c Config) DirPermissions() os.FileMode {
+	mode, err := parseMode(c.DirMode)
+	if err != nil {
+		return 0700
+	}
+	return mode
+}
+
+// syncInterval returns how often recordings are flushed to disk; 0 if they aren't
+func (c Config) syncInterval() time.Duration {
+	return time.Duration(max(c.SyncInterval, 0)) * time.Second
+}
+
+// LoadConfig loads configuration from the user's home directory
+func LoadConfig() (Config, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return DefaultConfig(), err
+	}
+
+	configPath := filepath.Join(homeDir, ConfigFilename)
+
+	// If config file doesn't exist, create it with defaults
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		config := DefaultConfig()
+		if err := SaveConfig(config); err != nil {
+			log.Printf("Warning: Could not save default config: %v", err)
+		}
+		return config, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return DefaultConfig(), err
+	}
+
+	// Start from the defaults so options missing in older config files keep sane values
+	config := DefaultConfig()
+	if err := json.Unmarshal(data, &config); err != nil {
+		return DefaultConfig(), err
+	}
+
+	return config, nil
+}
+
+// SaveConfig saves configuration to the user's home directory
+func SaveConfig(config Config) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(homeDir, ConfigFilename)
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(configPath, data, 0644)
+}
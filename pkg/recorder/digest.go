@@ -0,0 +1,142 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"dashcam/internal/crypt"
+	"dashcam/internal/ffmpeg"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pipedContainers can be decoded from a pipe. MP4 and MOV keep their index at
+// the end, so they're analysed from the file in a read of their own.
+var pipedContainers = map[string]bool{".mkv": true, ".webm": true, ".ts": true}
+
+// errAnalysisDone stops feeding an analysis that ended early
+var errAnalysisDone = errors.New("analysis finished")
+
+// segmentDigest is what the single read of a finished segment produced
+type segmentDigest struct {
+	analysis  ffmpeg.Analysis
+	checksum  string // SHA-256 of the recording as stored, i.e. encrypted if encryption is on
+	encrypted string // The encrypted copy; empty without encryption or if it failed
+}
+
+// digestSegment reads a finished segment once, from start to end, and hands the
+// data to everything that needs all of it: the checksum, the activity and scene
+// analysis and the encryption. The analysis failing only costs its results.
+func (sr *ScreenRecorder) digestSegment(filename string, duration float64) (segmentDigest, error) {
+	var digest segmentDigest
+	file, err := os.Open(filename)
+	if err != nil {
+		return digest, err
+	}
+	defer file.Close()
+
+	checksum := sha256.New()
+	var sinks []io.Writer
+
+	analyse := sr.config.ActivityScore || sr.config.SceneDetection
+	threshold := 0.0
+	if sr.config.SceneDetection {
+		threshold = sr.config.SceneThreshold
+	}
+	var pipe *io.PipeWriter
+	analysed := make(chan error, 1)
+	if analyse && pipedContainers[strings.ToLower(filepath.Ext(filename))] {
+		var reader *io.PipeReader
+		reader, pipe = io.Pipe()
+		go func() {
+			var err error
+			digest.analysis, err = ffmpeg.Analyze("pipe:0", reader, duration, sr.config.ActivityScore, threshold)
+			reader.CloseWithError(errAnalysisDone)
+			analysed <- err
+		}()
+		sinks = append(sinks, &lenientWriter{w: pipe})
+	}
+
+	var readErr error
+	if sr.config.Encrypt {
+		digest.encrypted, readErr = sr.encryptDigested(file, filename, io.MultiWriter(sinks...), checksum)
+	} else {
+		_, readErr = io.Copy(io.MultiWriter(append(sinks, checksum)...), file)
+	}
+	if readErr == nil {
+		digest.checksum = hex.EncodeToString(checksum.Sum(nil))
+	}
+
+	if pipe != nil {
+		// End of file for the analysis
+		pipe.Close()
+		if err := <-analysed; err != nil {
+			log.Printf("Warning: Could not analyse '%s': %v", filename, err)
+		}
+	} else if analyse {
+		if digest.analysis, err = ffmpeg.Analyze(filename, nil, duration, sr.config.ActivityScore, threshold); err != nil {
+			log.Printf("Warning: Could not analyse '%s': %v", filename, err)
+		}
+	}
+	return digest, readErr
+}
+
+// encryptDigested encrypts the segment being read into filename plus
+// crypt.Extension, copying the plain data to tee and the encrypted data to
+// checksum. The copy gets its marker when the segment is sealed.
+func (sr *ScreenRecorder) encryptDigested(file io.Reader, filename string, tee io.Writer, checksum hash.Hash) (string, error) {
+	encrypted := filename + crypt.Extension
+	out, err := os.OpenFile(encrypted, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	err = crypt.Encrypt(io.TeeReader(file, tee), io.MultiWriter(out, checksum), sr.secret)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(encrypted)
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return encrypted, nil
+}
+
+// lenientWriter passes writes on until the first error, then drops them, so a
+// consumer that stops early doesn't end the read for the others
+type lenientWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (l *lenientWriter) Write(p []byte) (int, error) {
+	if !l.failed {
+		if _, err := l.w.Write(p); err != nil {
+			l.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// fileChecksum returns the hex SHA-256 of a file, like the one in the metadata
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(checksum.Sum(nil)), nil
+}
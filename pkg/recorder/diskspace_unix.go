@@ -0,0 +1,14 @@
+//go:build !windows
+
+package recorder
+
+import "syscall"
+
+// FreeSpace returns how many bytes can still be written to the file system dir is on
+func FreeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package recorder
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns how many bytes can still be written to the volume dir is on
+func FreeSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,124 @@
+package recorder
+
+import (
+	"dashcam/internal/events"
+	"dashcam/internal/notify"
+	"log"
+	"path/filepath"
+)
+
+// Event is something that happened in the recorder, see Subscribe
+type Event = events.Event
+
+// Event kinds, as in Event.Kind
+const (
+	EventStart            = events.Start
+	EventStop             = events.Stop
+	EventPause            = events.Pause
+	EventResume           = events.Resume
+	EventMute             = events.Mute
+	EventUnmute           = events.Unmute
+	EventAnnotate         = events.Annotate
+	EventEmergency        = events.Emergency
+	EventMerge            = events.Merge
+	EventUpload           = events.Upload
+	EventScreenShareStart = events.ScreenShareStart
+	EventScreenShareEnd   = events.ScreenShareEnd
+	EventSegmentStart     = events.SegmentStart
+	EventSegmentEnd       = events.SegmentEnd
+	EventCleanup          = events.Cleanup
+	EventError            = events.Error
+	EventJobQueued        = events.JobQueued
+	EventJobDone          = events.JobDone
+)
+
+// unjournaled lists the events too frequent for the event journal
+var unjournaled = map[string]bool{
+	events.SegmentStart: true,
+	events.SegmentEnd:   true,
+	events.Cleanup:      true,
+	events.JobQueued:    true,
+	events.JobDone:      true,
+}
+
+// Subscribe calls handle for every event of the recorder (see the Event kinds),
+// in order and on a goroutine of its own, until the
+// returned function is called or the recorder has stopped
+func (sr *ScreenRecorder) Subscribe(handle func(Event)) (unsubscribe func()) {
+	return sr.events.Subscribe(handle)
+}
+
+// publish sends an event to all subscribers
+func (sr *ScreenRecorder) publish(event Event) {
+	sr.events.Publish(event)
+}
+
+// emit publishes an event that isn't about a particular segment
+func (sr *ScreenRecorder) emit(kind string, detail string) {
+	sr.publish(Event{Kind: kind, Detail: detail})
+}
+
+// streamEvents passes every event to send until the recorder has stopped or
+// send fails
+func (sr *ScreenRecorder) streamEvents(send func(any) error) error {
+	received := make(chan Event)
+	done := make(chan struct{})
+	defer close(done)
+
+	unsubscribe := sr.Subscribe(func(event Event) {
+		select {
+		case received <- event:
+		case <-done:
+		}
+	})
+	defer unsubscribe()
+
+	for {
+		select {
+		case event := <-received:
+			if err := send(event); err != nil {
+				return nil // The client went away
+			}
+		case <-sr.events.Done():
+			return nil
+		}
+	}
+}
+
+// subscribeIntegrations connects the journal, status updates, notifications and
+// uploads to the recorder's events
+func (sr *ScreenRecorder) subscribeIntegrations() {
+	sr.Subscribe(func(event Event) {
+		if unjournaled[event.Kind] {
+			return
+		}
+		if err := sr.journal.Record(event.Kind, event.Detail); err != nil {
+			log.Printf("Warning: Could not write journal: %v", err)
+		}
+	})
+
+	// Every event may change the state shown in status bars
+	sr.Subscribe(func(Event) {
+		sr.notifyStatusChanged()
+	})
+
+	sr.Subscribe(func(event Event) {
+		switch event.Kind {
+		case events.Emergency:
+			notify.Send("dashcam: emergency recording", "Protecting "+event.Detail)
+		case events.Upload:
+			if event.Marker != MarkerStandard {
+				notify.Send("dashcam: upload complete", filepath.Base(event.Segment)+" is safe on "+sr.config.UploadRemote)
+			}
+		}
+	})
+
+	sr.Subscribe(func(event Event) {
+		switch {
+		case event.Kind == events.Emergency:
+			sr.requestUpload()
+		case event.Kind == events.SegmentEnd && (sr.config.UploadAll || event.Marker != MarkerStandard):
+			sr.requestUpload()
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package recorder
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/crypt"
+	"dashcam/internal/metadata"
+	"dashcam/internal/shred"
+	"dashcam/pkg/catalog"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Review states of an incident, a protected recording such as an emergency
+// recording. An incident starts out new; once looked at it's reviewed, and then
+// either archived (kept) or deleted. Deleting isn't a state the incident stays
+// in: the recording is shredded (see SetReview).
+const (
+	ReviewNew      = "new"
+	ReviewReviewed = "reviewed"
+	ReviewArchived = "archived"
+	ReviewDeleted  = "deleted"
+)
+
+// ReviewStates lists the review states in workflow order
+var ReviewStates = []string{ReviewNew, ReviewReviewed, ReviewArchived}
+
+// ReviewRequest is sent over the control socket by `dashcam review`
+type ReviewRequest struct {
+	Path  string `json:"path"`
+	State string `json:"state"` // One of ReviewStates, or ReviewDeleted
+}
+
+// Incident is a protected recording and where it is in the review workflow
+type Incident struct {
+	Segment
+	Marker string
+	Review string
+}
+
+// Open reports whether the incident still needs a decision
+func (i Incident) Open() bool {
+	return i.Review == ReviewNew || i.Review == ReviewReviewed
+}
+
+// reviewState returns the review state stored in a segment's metadata
+func reviewState(meta metadata.Segment) string {
+	if meta.Review == "" {
+		return ReviewNew
+	}
+	return meta.Review
+}
+
+// ListIncidents returns all protected recordings, oldest first
+func ListIncidents(config Config) ([]Incident, error) {
+	segments, err := ListSegments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var incidents []Incident
+	for _, segment := range segments {
+		marker, err := attributes.GetMarker(segment.Path, MarkerName)
+		if err != nil {
+			continue
+		}
+		if marker != MarkerStandard {
+			incidents = append(incidents, Incident{Segment: segment, Marker: marker, Review: reviewState(segment.Meta)})
+		}
+	}
+	return incidents, nil
+}
+
+// SetReview moves an incident to another review state, stored in its metadata,
+// or deletes it: ReviewDeleted shreds the recording and its sidecars and drops
+// it from the catalog, which can't be undone.
+func SetReview(config Config, cat *catalog.Catalog, path string, state string) error {
+	if state != ReviewDeleted && !slices.Contains(ReviewStates, state) {
+		return fmt.Errorf("unknown review state '%s' (use %s or %s)", state, strings.Join(ReviewStates, ", "), ReviewDeleted)
+	}
+
+	marker, err := attributes.GetMarker(path, MarkerName)
+	if err != nil {
+		return fmt.Errorf("failed to read marker of %s: %v", path, err)
+	}
+	if marker == MarkerStandard {
+		return fmt.Errorf("%s is a standard recording, not an incident", path)
+	}
+	if state == ReviewDeleted {
+		return deleteIncident(cat, path)
+	}
+
+	plain := crypt.PlainName(path)
+	meta, err := metadata.Load(plain)
+	if err != nil {
+		return err
+	}
+	meta.Review = state
+	if state == ReviewNew {
+		meta.Review = ""
+	}
+	return metadata.Save(plain, meta)
+}
+
+// deleteIncident securely deletes a recording like WipeRecordings does, along
+// with its catalog entries
+func deleteIncident(cat *catalog.Catalog, path string) error {
+	if err := shred.File(path); err != nil {
+		return err
+	}
+	for _, sidecar := range sidecarFiles(path) {
+		if err := shred.File(sidecar); err != nil {
+			log.Printf("Warning: Could not wipe '%s': %v", sidecar, err)
+		}
+	}
+	if err := cat.RemoveSegments(map[string]bool{filepath.Base(crypt.PlainName(path)): true}); err != nil {
+		log.Printf("Warning: Could not update catalog: %v", err)
+	}
+	return nil
+}
+
+// setReview is SetReview for the control socket, serialized with retention
+// cleanup and merging
+func (sr *ScreenRecorder) setReview(request ReviewRequest) error {
+	sr.filesMutex.Lock()
+	defer sr.filesMutex.Unlock()
+
+	if err := SetReview(sr.config, sr.catalog, request.Path, request.State); err != nil {
+		return err
+	}
+	if request.State == ReviewDeleted {
+		log.Printf("Deleted incident %s", filepath.Base(request.Path))
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+package recorder
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/crypt"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/geo"
+	"dashcam/internal/jobs"
+	"dashcam/internal/metadata"
+	"dashcam/internal/subtitle"
+	"dashcam/internal/thumbnail"
+	"dashcam/pkg/catalog"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MergeDay losslessly concatenates the standard recordings of a source (empty for
+// the main one) of a day into a single file named after the first of them, and
+// replaces the originals. Protected recordings (e.g. emergency recordings) are
+// left alone. It returns the merged file and the number of recordings that went into it.
+func MergeDay(config Config, cat *catalog.Catalog, day time.Time, source string) (string, int, error) {
+	return merge(config, cat, day, source, &sync.Mutex{})
+}
+
+// merge is MergeDay, holding markers while it checks that the parts are still
+// standard recordings and replaces them, so they can't be protected in between
+func merge(config Config, cat *catalog.Catalog, day time.Time, source string, markers sync.Locker) (string, int, error) {
+	if err := recoverMerge(config, cat); err != nil {
+		return "", 0, fmt.Errorf("failed to recover the interrupted merge: %v", err)
+	}
+	segments, err := ListSegments(config)
+	if err != nil {
+		return "", 0, err
+	}
+
+	year, month, date := day.Date()
+	var parts []Segment
+	for _, segment := range segments {
+		y, m, d := segment.Meta.Start.Date()
+		if y != year || m != month || d != date || segment.Meta.Source != source {
+			continue
+		}
+		if value, err := attributes.GetMarker(segment.Path, MarkerName); err != nil || value != MarkerStandard {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	if len(parts) < 2 {
+		return "", len(parts), nil
+	}
+	// Post-processing jobs (e.g. OCR) on a part would miss it once it's merged,
+	// and a timelapse being rendered would lose the parts after the first
+	queue := jobs.Open(filepath.Join(config.RecordingsDir, jobsFilename))
+	if queue.Has(day.Format("2006-01-02")) {
+		return "", 0, fmt.Errorf("the timelapse of %s is still being rendered, try again later", day.Format("2006-01-02"))
+	}
+	for _, part := range parts {
+		if queue.Has(filepath.Base(crypt.PlainName(part.Path))) {
+			return "", 0, fmt.Errorf("%s is still being post-processed, try again later", filepath.Base(part.Path))
+		}
+	}
+
+	// Work next to the recordings so decrypted copies get the same protection and
+	// the result can be renamed into place
+	tmpDir, err := os.MkdirTemp(config.RecordingsDir, ".merge-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create merge directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var secret []byte
+	encrypted := false
+	inputs := make([]string, len(parts))
+	for i, part := range parts {
+		inputs[i] = part.Path
+		sealed := len(part.Meta.Sealed) > 0
+		if !crypt.IsEncrypted(part.Path) && !sealed {
+			continue
+		}
+		if secret == nil {
+			if secret, err = crypt.LoadSecret(config.EncryptionKey); err != nil {
+				return "", 0, err
+			}
+		}
+		if sealed {
+			if parts[i].Meta, err = part.Meta.Unseal(secret); err != nil {
+				return "", 0, fmt.Errorf("%s: %v", filepath.Base(part.Path), err)
+			}
+		}
+		if !crypt.IsEncrypted(part.Path) {
+			continue
+		}
+		encrypted = true
+		inputs[i] = filepath.Join(tmpDir, fmt.Sprintf("part-%04d%s", i, filepath.Ext(crypt.PlainName(part.Path))))
+		if err := crypt.DecryptFile(part.Path, inputs[i], secret); err != nil {
+			return "", 0, fmt.Errorf("failed to decrypt %s: %v", filepath.Base(part.Path), err)
+		}
+	}
+
+	offsets := make([]float64, len(parts))
+	total := 0.0
+	for i, input := range inputs {
+		duration, err := ffmpeg.Duration(input)
+		if err != nil {
+			return "", 0, err
+		}
+		offsets[i] = total
+		total += duration
+	}
+
+	plainTarget := crypt.PlainName(parts[0].Path)
+	merged := filepath.Join(tmpDir, "merged"+filepath.Ext(plainTarget))
+	if err := ffmpeg.Concat(inputs, merged); err != nil {
+		return "", 0, err
+	}
+
+	target := plainTarget
+	if encrypted {
+		target += crypt.Extension
+		if err := crypt.EncryptFile(merged, merged+crypt.Extension, secret); err != nil {
+			return "", 0, fmt.Errorf("failed to encrypt merged recording: %v", err)
+		}
+		merged += crypt.Extension
+	}
+
+	// Keep the merged file's place in the retention order of the originals
+	if info, err := os.Stat(parts[len(parts)-1].Path); err == nil {
+		os.Chtimes(merged, info.ModTime(), info.ModTime())
+	}
+	if err := os.Chmod(merged, config.FilePermissions()); err != nil {
+		log.Printf("Warning: Could not set permissions on '%s': %v", merged, err)
+	}
+	if err := attributes.SetMarker(merged, MarkerName, MarkerStandard); err != nil {
+		return "", 0, fmt.Errorf("failed to set marker on merged recording: %v", err)
+	}
+
+	meta := mergeMetadata(parts, offsets)
+	// What was on screen stays sealed in the merged metadata (and the merge intent)
+	if secret != nil {
+		if meta, err = meta.Seal(secret); err != nil {
+			return "", 0, err
+		}
+	}
+	// Transcripts are plain text, so encrypted recordings don't get one (see transcribe)
+	var cues []subtitle.Cue
+	if !encrypted {
+		cues = mergeTranscripts(parts, offsets)
+	}
+
+	intent := mergeIntent{Target: target, Merged: merged, Meta: meta, Cues: cues, Duration: total,
+		Relocated: make(map[string]float64)}
+	for i, part := range parts {
+		intent.Parts = append(intent.Parts, part.Path)
+		intent.Relocated[filepath.Base(crypt.PlainName(part.Path))] = offsets[i]
+	}
+	// An emergency may have protected a part while it was being merged
+	markers.Lock()
+	defer markers.Unlock()
+	for _, part := range parts {
+		if value, err := attributes.GetMarker(part.Path, MarkerName); err != nil || value != MarkerStandard {
+			return "", 0, fmt.Errorf("%s was protected while merging, try again", filepath.Base(part.Path))
+		}
+	}
+
+	// From here on a crash must not leave the merged file next to the remaining
+	// parts, which the next merge would join again
+	if err := intent.save(config); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(merged, target); err != nil {
+		os.Remove(intent.path(config))
+		return "", 0, fmt.Errorf("failed to move merged recording into place: %v", err)
+	}
+	intent.complete(config, cat)
+
+	return target, len(parts), nil
+}
+
+// mergeIntent is a merge whose result is being moved into place, stored in the
+// recordings directory until the parts it replaces are gone
+type mergeIntent struct {
+	Target    string             `json:"target"` // The merged recording, in place of the first part
+	Merged    string             `json:"merged"` // Where it was put together
+	Parts     []string           `json:"parts"`
+	Meta      metadata.Segment   `json:"meta"`
+	Cues      []subtitle.Cue     `json:"cues,omitempty"`
+	Duration  float64            `json:"duration"`
+	Relocated map[string]float64 `json:"relocated"` // Offset of each part (by plain file name) in the merged recording
+}
+
+// mergeIntentFilename is the file a merge in progress is recorded in
+const mergeIntentFilename = ".dashcam-merge.json"
+
+// path returns the file the intent is stored in
+func (m mergeIntent) path(config Config) string {
+	return filepath.Join(config.RecordingsDir, mergeIntentFilename)
+}
+
+// save stores the intent, synced to disk before the merged file is moved into place
+func (m mergeIntent) save(config Config) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	tmpPath := m.path(config) + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to record merge: %v", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, m.path(config))
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to record merge: %v", err)
+	}
+	return nil
+}
+
+// complete replaces the parts with the merged recording once it's in place:
+// removes them and their sidecars and writes the merged sidecars. Running it
+// again after a crash picks up where it stopped.
+func (m mergeIntent) complete(config Config, cat *catalog.Catalog) {
+	for _, part := range m.Parts {
+		for _, sidecar := range sidecarFiles(part) {
+			if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: Could not remove %s: %v", sidecar, err)
+			}
+		}
+		if part == m.Target {
+			continue
+		}
+		if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Could not remove merged recording %s: %v", part, err)
+		}
+	}
+
+	plainTarget := crypt.PlainName(m.Target)
+	if err := metadata.Save(plainTarget, m.Meta); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if len(m.Cues) > 0 {
+		if err := subtitle.WriteVTT(transcriptPath(m.Target), m.Cues); err != nil {
+			log.Printf("Warning: Could not write merged transcript: %v", err)
+		}
+	}
+	if config.GPXSidecar && len(m.Meta.Locations) > 0 {
+		var fixes []geo.Fix
+		for _, location := range m.Meta.Locations {
+			fixes = append(fixes, geo.Fix{
+				Time:      m.Meta.TimeAt(location.Offset),
+				Latitude:  location.Latitude,
+				Longitude: location.Longitude,
+				Accuracy:  location.Accuracy,
+				Altitude:  location.Altitude,
+			})
+		}
+		if err := geo.WriteGPX(gpxPath(m.Target), filepath.Base(plainTarget), fixes); err != nil {
+			log.Printf("Warning: Could not write GPX track for '%s': %v", m.Target, err)
+		}
+	}
+	if config.Thumbnails && !crypt.IsEncrypted(m.Target) {
+		if err := ffmpeg.Thumbnail(m.Target, thumbnail.Path(m.Target), m.Duration/2, 320); err != nil {
+			log.Printf("Warning: Could not create thumbnail for '%s': %v", m.Target, err)
+		}
+	}
+
+	if err := cat.Relocate(filepath.Base(plainTarget), m.Relocated); err != nil {
+		log.Printf("Warning: Could not update catalog: %v", err)
+	}
+	if err := os.Remove(m.path(config)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Could not remove %s: %v", m.path(config), err)
+	}
+}
+
+// recoverMerge deals with a merge that was interrupted by a crash: one that had
+// moved the merged recording into place is completed, any other one is dropped
+// (its parts are still untouched)
+func recoverMerge(config Config, cat *catalog.Catalog) error {
+	var intent mergeIntent
+	data, err := os.ReadFile(intent.path(config))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &intent); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", intent.path(config), err)
+	}
+
+	if FileExists(intent.Merged) {
+		log.Printf("Dropping the interrupted merge into %s", filepath.Base(intent.Target))
+		os.RemoveAll(filepath.Dir(intent.Merged))
+		return os.Remove(intent.path(config))
+	}
+	log.Printf("Completing the interrupted merge into %s", filepath.Base(intent.Target))
+	intent.complete(config, cat)
+	os.RemoveAll(filepath.Dir(intent.Merged))
+	return nil
+}
+
+// mergeMetadata combines the metadata of consecutive parts, shifting every offset by
+// where the part starts in the merged file
+func mergeMetadata(parts []Segment, offsets []float64) metadata.Segment {
+	merged := metadata.Segment{
+		Start:  parts[0].Meta.Start,
+		End:    parts[len(parts)-1].Meta.End,
+		Source: parts[0].Meta.Source,
+	}
+
+	// Parts can only be joined if they share their encoding, so the merged
+	// recording is re-encoded if they were
+	merged.Reencoded = parts[0].Meta.Reencoded
+
+	activity, activityTime := 0.0, 0.0
+	for i, part := range parts {
+		meta, shift := part.Meta, offsets[i]
+
+		// Parts that were merged before bring their own parts along
+		if len(meta.Parts) > 0 {
+			for _, p := range meta.Parts {
+				p.Offset += shift
+				merged.Parts = append(merged.Parts, p)
+			}
+		} else {
+			merged.Parts = append(merged.Parts, metadata.Part{Offset: shift, Start: meta.Start, End: meta.End})
+		}
+
+		merged.ScreenShared = merged.ScreenShared || meta.ScreenShared
+		for _, interval := range meta.MuteIntervals {
+			interval.Start += shift
+			interval.End += shift
+			merged.MuteIntervals = append(merged.MuteIntervals, interval)
+		}
+		for _, sample := range meta.Windows {
+			sample.Offset += shift
+			merged.Windows = append(merged.Windows, sample)
+		}
+		for _, location := range meta.Locations {
+			location.Offset += shift
+			merged.Locations = append(merged.Locations, location)
+		}
+		for _, sample := range meta.System {
+			sample.Offset += shift
+			merged.System = append(merged.System, sample)
+		}
+		for _, annotation := range meta.Annotations {
+			annotation.Offset += shift
+			merged.Annotations = append(merged.Annotations, annotation)
+		}
+		for _, scene := range meta.Scenes {
+			merged.Scenes = append(merged.Scenes, scene+shift)
+		}
+
+		if meta.Activity != nil {
+			duration := meta.End.Sub(meta.Start).Seconds()
+			activity += *meta.Activity * duration
+			activityTime += duration
+		}
+	}
+
+	if activityTime > 0 {
+		score := activity / activityTime
+		merged.Activity = &score
+	}
+	return merged
+}
+
+// mergeTranscripts joins the VTT transcripts of the parts, shifting the cues
+func mergeTranscripts(parts []Segment, offsets []float64) []subtitle.Cue {
+	var merged []subtitle.Cue
+	for i, part := range parts {
+		cues, err := subtitle.ReadVTT(transcriptPath(part.Path))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("Warning: Could not read transcript of %s: %v", filepath.Base(part.Path), err)
+			}
+			continue
+		}
+		for _, cue := range cues {
+			cue.Start += offsets[i]
+			cue.End += offsets[i]
+			merged = append(merged, cue)
+		}
+	}
+	return merged
+}
+
+// ParseDay parses a day given as YYYY-MM-DD, "today" or "yesterday"
+func ParseDay(value string) (time.Time, error) {
+	now := time.Now()
+	switch strings.ToLower(value) {
+	case "today":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid day '%s' (use YYYY-MM-DD)", value)
+	}
+	return day, nil
+}
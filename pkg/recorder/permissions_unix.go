@@ -0,0 +1,59 @@
+//go:build !windows
+
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// setUmask sets the permission bits masked out of new files and directories
+func setUmask(mask os.FileMode) {
+	syscall.Umask(int(mask))
+}
+
+// applyDirMode gives the recordings directory its configured permissions and
+// checks nobody else can tamper with it
+func applyDirMode(dir string, dirMode os.FileMode) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm() != dirMode {
+		log.Printf("Changing permissions of %s from %o to %o", dir, info.Mode().Perm(), dirMode)
+		if err := os.Chmod(dir, dirMode); err != nil {
+			return err
+		}
+	}
+
+	return checkNotWorldWritable(dir)
+}
+
+// checkNotWorldWritable refuses directories that other users could tamper with:
+// the directory itself must not be world-writable, and no parent may be
+// world-writable without the sticky bit (which would let others replace it)
+func checkNotWorldWritable(dir string) error {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	for current := path; ; current = filepath.Dir(current) {
+		info, err := os.Stat(current)
+		if err != nil {
+			return err
+		}
+
+		worldWritable := info.Mode().Perm()&0002 != 0
+		if worldWritable && (current == path || info.Mode()&os.ModeSticky == 0) {
+			return fmt.Errorf("refusing to record into %s: %s is world-writable", path, current)
+		}
+
+		if current == filepath.Dir(current) {
+			return nil
+		}
+	}
+}
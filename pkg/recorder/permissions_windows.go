@@ -0,0 +1,15 @@
+//go:build windows
+
+package recorder
+
+import "os"
+
+// setUmask does nothing on Windows, where access is controlled by the ACLs the
+// recordings directory passes on
+func setUmask(mask os.FileMode) {}
+
+// applyDirMode does nothing on Windows: permission bits only reflect the
+// read-only flag there, so every writable directory would look world-writable
+func applyDirMode(dir string, dirMode os.FileMode) error {
+	return nil
+}
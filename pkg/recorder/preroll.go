@@ -0,0 +1,331 @@
+package recorder
+
+import (
+	"context"
+	"dashcam/internal/capture"
+	"dashcam/internal/events"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/mask"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// prerollFormat is the container the pre-roll is buffered in. MPEG-TS can be cut
+// at any packet and still be played, so old data is dropped a chunk at a time.
+const prerollFormat = "mpegts"
+
+// prerollChunkSize is how much of the stream is read at once, a multiple of the
+// 188 byte MPEG-TS packets
+const prerollChunkSize = 188 * 64
+
+// prerollDropInterval is how often context older than the buffer is dropped
+const prerollDropInterval = 10 * time.Second
+
+// prerollChunk is a piece of the buffered stream
+type prerollChunk struct {
+	at   time.Time // When it was read
+	data []byte
+}
+
+// prerollRecording is an emergency recording written from the pre-roll buffer
+type prerollRecording struct {
+	filename string // The final recording; the stream goes to filename.ts first
+	file     *os.File
+	start    time.Time
+	until    time.Time // When to stop writing the live stream into it
+	synced   time.Time // When it was last flushed to disk
+}
+
+// preroll holds the last seconds of the main source in memory. An emergency saves
+// them, and the live stream after them, as a recording.
+type preroll struct {
+	mutex        sync.Mutex
+	length       time.Duration
+	syncInterval time.Duration // How often a recording being written is flushed to disk; 0 for never
+	chunks       []prerollChunk
+	recording    *prerollRecording // Being written, nil otherwise
+}
+
+// newPreroll creates an empty buffer for the given number of seconds
+func newPreroll(seconds int, syncInterval time.Duration) *preroll {
+	return &preroll{length: time.Duration(seconds) * time.Second, syncInterval: syncInterval}
+}
+
+// oldest returns when the oldest buffered chunk was read, or the zero time if
+// nothing is buffered
+func (p *preroll) oldest() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.chunks) == 0 {
+		return time.Time{}
+	}
+	return p.chunks[0].at
+}
+
+// reset drops the buffered stream, which belongs to a capture that ended
+func (p *preroll) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.chunks = nil
+}
+
+// write buffers a chunk of the stream and appends it to the recording being
+// written. It returns the recording once it's complete.
+func (p *preroll) write(data []byte) (*prerollRecording, error) {
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.chunks = append(p.chunks, prerollChunk{at: now, data: data})
+	expired := 0
+	for expired < len(p.chunks)-1 && now.Sub(p.chunks[expired].at) > p.length {
+		expired++
+	}
+	p.chunks = slices.Delete(p.chunks, 0, expired)
+
+	recording := p.recording
+	if recording == nil {
+		return nil, nil
+	}
+	if _, err := recording.file.Write(data); err != nil {
+		p.recording = nil
+		recording.file.Close()
+		return recording, fmt.Errorf("failed to write %s: %w", recording.file.Name(), err)
+	}
+	if now.Before(recording.until) {
+		if p.syncInterval > 0 && now.Sub(recording.synced) >= p.syncInterval {
+			recording.synced = now
+			if err := recording.file.Sync(); err != nil {
+				log.Printf("Warning: Could not sync %s: %v", recording.file.Name(), err)
+			}
+		}
+		return nil, nil
+	}
+	p.recording = nil
+	return recording, p.finish(recording)
+}
+
+// save starts a recording, named by the start of the buffer, of the buffer
+// followed by the live stream until duration has passed. ok is false if there's
+// nothing buffered or a recording is already being written.
+func (p *preroll) save(name func(start time.Time) string, duration time.Duration, mode os.FileMode) (recording *prerollRecording, ok bool, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.recording != nil || len(p.chunks) == 0 {
+		return nil, false, nil
+	}
+	filename := name(p.chunks[0].at)
+	file, err := os.OpenFile(filename+".ts", os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create %s.ts: %w", filename, err)
+	}
+	for _, chunk := range p.chunks {
+		if _, err := file.Write(chunk.data); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, false, fmt.Errorf("failed to write %s: %w", file.Name(), err)
+		}
+	}
+
+	p.recording = &prerollRecording{filename: filename, file: file, start: p.chunks[0].at, until: time.Now().Add(duration)}
+	return p.recording, true, nil
+}
+
+// close ends the recording being written, if any, and returns it
+func (p *preroll) close() (*prerollRecording, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	recording := p.recording
+	if recording == nil {
+		return nil, nil
+	}
+	p.recording = nil
+	return recording, p.finish(recording)
+}
+
+// finish flushes a complete recording to disk and closes it
+func (p *preroll) finish(recording *prerollRecording) error {
+	if p.syncInterval > 0 {
+		if err := recording.file.Sync(); err != nil {
+			recording.file.Close()
+			return fmt.Errorf("failed to sync %s: %w", recording.file.Name(), err)
+		}
+	}
+	return recording.file.Close()
+}
+
+// prerollLoop buffers the main source in memory until ctx is cancelled, instead
+// of recording segments
+func (sr *ScreenRecorder) prerollLoop(ctx context.Context, src *source) {
+	for ctx.Err() == nil {
+		// Nothing is buffered while recording is paused
+		pauseChanged := sr.pauseChanges()
+		if sr.isPaused() {
+			select {
+			case <-ctx.Done():
+			case <-pauseChanged:
+			}
+			continue
+		}
+
+		if err := sr.bufferScreen(ctx, src); err != nil {
+			log.Printf("Pre-roll failed (%s): %v", src.label(), err)
+			sr.publish(Event{Kind: events.Error, Detail: err.Error(), Source: src.name})
+			// Wait a bit before trying again to avoid rapid failures
+			retryAfter(ctx, 2*time.Second)
+		}
+	}
+}
+
+// bufferScreen captures a source into the pre-roll buffer until recording is
+// paused or ctx is cancelled
+func (sr *ScreenRecorder) bufferScreen(ctx context.Context, src *source) error {
+	log.Printf("Buffering the last %d seconds in memory", sr.config.PrerollSeconds)
+	sr.preroll.reset()
+
+	// Like a segment, a recording being saved is finished by interrupting the
+	// capture rather than killing it
+	captureCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	name := src.backend.Name()
+	cmd := src.backend.Command(captureCtx, capture.Stdout, capture.Options{
+		Codec:    src.config.Codec,
+		Filter:   mask.Filter(src.config.MaskRegions),
+		Format:   prerollFormat,
+		Audio:    src.config.RecordAudio,
+		Adaptive: src.config.AdaptiveEncoding,
+		Flush:    src.config.syncInterval(),
+	})
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %v", name, err)
+	}
+
+	// The stream has to be read to the end before the program can be waited for
+	done := make(chan error, 1)
+	go func() {
+		dropped := time.Now()
+		for {
+			if time.Since(dropped) > prerollDropInterval {
+				sr.dropContext()
+				dropped = time.Now()
+			}
+
+			chunk := make([]byte, prerollChunkSize)
+			n, err := io.ReadFull(stdout, chunk)
+			if n > 0 {
+				recording, err := sr.preroll.write(chunk[:n])
+				if recording != nil {
+					sr.finishPreroll(src, recording, err)
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		done <- cmd.Wait()
+	}()
+
+	pauseChanged := sr.pauseChanges()
+	for {
+		select {
+		case <-ctx.Done():
+			stopRecorder(cmd, done)
+		case <-pauseChanged:
+			pauseChanged = sr.pauseChanges()
+			if !sr.isPaused() {
+				continue
+			}
+			log.Printf("Recording paused, emptying the pre-roll buffer...")
+			stopRecorder(cmd, done)
+		case err = <-done:
+			if err != nil {
+				err = fmt.Errorf("%s failed: %v", name, err)
+			}
+		}
+
+		// Whatever was being saved ends with the capture
+		if recording, closeErr := sr.preroll.close(); recording != nil {
+			sr.finishPreroll(src, recording, closeErr)
+		}
+		sr.preroll.reset()
+		return err
+	}
+}
+
+// savePreroll starts saving the pre-roll buffer, and the recording_length seconds
+// after it, into an emergency recording of the main source
+func (sr *ScreenRecorder) savePreroll() {
+	if sr.preroll == nil {
+		return
+	}
+	src := sr.sources[0]
+
+	name := func(start time.Time) string { return sr.generateFilename(src, start) }
+	recording, ok, err := sr.preroll.save(name, time.Duration(src.config.RecordingLength)*time.Second, sr.config.FilePermissions())
+	if err != nil {
+		log.Printf("Warning: Could not save pre-roll: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	log.Printf("Saving the pre-roll from %s into %s", recording.start.Format(time.TimeOnly), recording.filename)
+	sr.setCurrentSegment(src, recording.filename, recording.start)
+}
+
+// finishPreroll turns a saved pre-roll stream into a recording in the configured
+// container and post-processes it like a segment
+func (sr *ScreenRecorder) finishPreroll(src *source, recording *prerollRecording, err error) {
+	sr.setCurrentSegment(src, "", time.Time{})
+	end := time.Now()
+	stream := recording.file.Name()
+	if err != nil {
+		log.Printf("Warning: Pre-roll recording %s is incomplete: %v", stream, err)
+	}
+
+	// Converting runs in the background so the capture isn't held up
+	sr.workers.Add(1)
+	go func() {
+		defer sr.workers.Done()
+
+		if err := ffmpeg.Remux(stream, recording.filename, ffmpeg.Embed{}); err != nil {
+			// The stream plays as it is, which beats losing the footage
+			log.Printf("Warning: Could not convert %s, keeping the stream: %v", stream, err)
+			os.Remove(recording.filename)
+			if err := os.Rename(stream, recording.filename); err != nil {
+				log.Printf("Warning: Could not rename %s: %v", stream, err)
+			}
+		} else {
+			os.Remove(stream)
+		}
+		log.Printf("Recording completed: %s", recording.filename)
+		sr.finishSegment(src, recording.filename, recording.start, end)
+	}()
+}
+
+// dropContext forgets the context (windows, mute spans, ...) from before the
+// pre-roll buffer, which no recording will need
+func (sr *ScreenRecorder) dropContext() {
+	oldest := sr.preroll.oldest()
+	if oldest.IsZero() {
+		return
+	}
+	cutoff := sr.contextCutoff(oldest)
+	sr.takeMuteIntervals(cutoff, cutoff, cutoff)
+	sr.takeWindowTimeline(cutoff, cutoff, cutoff)
+	sr.takeSystemStats(cutoff, cutoff, cutoff)
+	sr.takeAnnotations(cutoff, cutoff, cutoff)
+	sr.takeLocations(cutoff, cutoff, cutoff)
+}
@@ -0,0 +1,209 @@
+package recorder
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/crypt"
+	"dashcam/internal/events"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/jobs"
+	"dashcam/internal/metadata"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Kinds of jobs in the post-processing queue. Segment jobs target the file name
+// of the (unencrypted) segment, timelapse jobs a day (YYYY-MM-DD).
+const (
+	jobOCR        = "ocr"
+	jobTranscribe = "transcribe"
+	jobThumbnails = "thumbnails"
+	jobTimelapse  = "timelapse"
+	jobReencode   = "reencode"
+)
+
+// queueJob adds a job to the post-processing queue
+func (sr *ScreenRecorder) queueJob(kind string, target string) {
+	if err := sr.jobs.Add(kind, target); err != nil {
+		log.Printf("Warning: Could not queue %s of %s: %v", kind, target, err)
+		return
+	}
+	sr.emit(events.JobQueued, kind+" "+target)
+}
+
+// runJob runs a job from the post-processing queue
+func (sr *ScreenRecorder) runJob(job jobs.Job) error {
+	defer sr.emit(events.JobDone, job.Kind+" "+job.Target)
+
+	// The recordings are being wiped
+	if sr.wipe.Load() {
+		return nil
+	}
+	if job.Kind == jobTimelapse {
+		return sr.renderTimelapse(job.Target)
+	}
+
+	filename := filepath.Join(sr.config.RecordingsDir, job.Target)
+	path := filename
+	if !FileExists(path) {
+		path = filename + crypt.Extension
+		if !FileExists(path) {
+			return fmt.Errorf("recording no longer exists")
+		}
+	}
+	meta, err := metadata.Load(filename)
+	if err != nil {
+		return err
+	}
+
+	switch job.Kind {
+	case jobOCR:
+		if crypt.IsEncrypted(path) {
+			return nil
+		}
+		sr.indexText(path, meta.Start)
+		return nil
+	case jobTranscribe:
+		if crypt.IsEncrypted(path) {
+			return nil
+		}
+		sr.transcribeSegment(path, meta.Start)
+		return nil
+	case jobThumbnails:
+		if crypt.IsEncrypted(path) {
+			return nil
+		}
+		sr.createThumbnails(path, SegmentDuration(sr.config, meta))
+		return nil
+	case jobReencode:
+		return sr.reencodeSegment(filename, path, meta)
+	}
+	return fmt.Errorf("unknown job")
+}
+
+// queueReencodes queues the re-encoding of the recordings that are older than
+// archive_after_days and haven't been re-encoded yet
+func (sr *ScreenRecorder) queueReencodes() {
+	segments, err := ListSegments(sr.config)
+	if err != nil {
+		log.Printf("Warning: Could not list recordings to re-encode: %v", err)
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -sr.config.ArchiveAfter)
+	for _, segment := range segments {
+		if segment.Meta.Reencoded == "" && segment.Meta.Start.Before(cutoff) {
+			sr.queueJob(jobReencode, filepath.Base(crypt.PlainName(segment.Path)))
+		}
+	}
+}
+
+// reencodeSegment re-encodes a recording with archive_codec to save space and
+// replaces it, unless that doesn't make it smaller. Encrypted recordings are
+// decrypted next to the recordings and encrypted again.
+func (sr *ScreenRecorder) reencodeSegment(filename string, path string, meta metadata.Segment) error {
+	if meta.Reencoded != "" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(sr.config.RecordingsDir, ".reencode-*")
+	if err != nil {
+		return fmt.Errorf("failed to create re-encoding directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := path
+	encrypted := crypt.IsEncrypted(path)
+	var secret []byte
+	if encrypted {
+		if secret, err = crypt.LoadSecret(sr.config.EncryptionKey); err != nil {
+			return err
+		}
+		input = filepath.Join(tmpDir, "input"+filepath.Ext(filename))
+		if err := crypt.DecryptFile(path, input, secret); err != nil {
+			return fmt.Errorf("failed to decrypt: %v", err)
+		}
+	}
+	output := filepath.Join(tmpDir, "reencoded"+filepath.Ext(filename))
+	if err := ffmpeg.Reencode(input, output, sr.config.ArchiveCodec, sr.config.ArchiveCRF); err != nil {
+		return err
+	}
+	if encrypted {
+		if err := crypt.EncryptFile(output, output+crypt.Extension, secret); err != nil {
+			return fmt.Errorf("failed to encrypt: %v", err)
+		}
+		output += crypt.Extension
+	}
+	checksum, err := fileChecksum(output)
+	if err != nil {
+		return err
+	}
+
+	// Cleanup, merges and wipes replace recordings under the lock
+	sr.filesMutex.Lock()
+	defer sr.filesMutex.Unlock()
+	if current, err := os.Stat(path); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		return fmt.Errorf("recording changed while it was re-encoded")
+	}
+
+	meta.Reencoded = sr.config.ArchiveCodec
+	if reencoded, err := os.Stat(output); err == nil && reencoded.Size() < info.Size() {
+		marker, err := attributes.GetMarker(path, MarkerName)
+		if err != nil || marker == "" {
+			return fmt.Errorf("failed to read marker: %v", err)
+		}
+		// Keep the recording's place in the retention order and its markers
+		os.Chtimes(output, info.ModTime(), info.ModTime())
+		if err := os.Chmod(output, sr.config.FilePermissions()); err != nil {
+			log.Printf("Warning: Could not set permissions on '%s': %v", output, err)
+		}
+		if err := attributes.SetMarker(output, MarkerName, marker); err != nil {
+			return fmt.Errorf("failed to set marker: %v", err)
+		}
+		if remote, err := attributes.GetMarker(path, uploadMarkerName); err == nil && remote != "" {
+			attributes.SetMarker(output, uploadMarkerName, remote)
+		}
+		if err := os.Rename(output, path); err != nil {
+			return fmt.Errorf("failed to replace recording: %v", err)
+		}
+		meta.SHA256 = checksum
+		log.Printf("Re-encoded %s with %s: %s instead of %s", filepath.Base(path), sr.config.ArchiveCodec,
+			FormatSize(reencoded.Size()), FormatSize(info.Size()))
+	}
+	// Either way it isn't tried again
+	return metadata.Save(filename, meta)
+}
+
+// renderTimelapse renders the timelapse of a day unless it already exists
+func (sr *ScreenRecorder) renderTimelapse(value string) error {
+	day, err := ParseDay(value)
+	if err != nil {
+		return err
+	}
+	if timelapseExists(sr.config, day) {
+		return nil
+	}
+
+	// Only the list of recordings is taken under the lock: merges leave a day
+	// alone while its timelapse is pending, and recordings that cleanup removes
+	// in the meantime are skipped
+	sr.filesMutex.Lock()
+	parts, err := timelapseParts(sr.config, day)
+	sr.filesMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	length := time.Duration(sr.config.TimelapseLength) * time.Second
+	file, err := makeTimelapse(sr.config, day, parts, length)
+	if err != nil {
+		return err
+	}
+	log.Printf("Rendered timelapse of %s: %s", value, filepath.Base(file))
+	return nil
+}
@@ -0,0 +1,2117 @@
+// Package recorder is the rolling recording engine behind dashcam: it records
+// segments from the configured sources, enriches and post-processes them and
+// keeps the archive within its limits. Other programs can embed it:
+//
+//	config, err := recorder.LoadConfig()
+//	...
+//	sr, err := recorder.New(config)
+//	...
+//	go sr.Start(ctx)
+//	sr.MarkEmergency("crash sensor")
+package recorder
+
+import (
+	"context"
+	"dashcam/internal/attributes"
+	"dashcam/internal/calendar"
+	"dashcam/internal/capture"
+	"dashcam/internal/control"
+	"dashcam/internal/crypt"
+	"dashcam/internal/events"
+	"dashcam/internal/ffmpeg"
+	"dashcam/internal/geo"
+	"dashcam/internal/jobs"
+	"dashcam/internal/journal"
+	"dashcam/internal/mask"
+	"dashcam/internal/metadata"
+	"dashcam/internal/ocr"
+	"dashcam/internal/screenshare"
+	"dashcam/internal/session"
+	"dashcam/internal/shred"
+	"dashcam/internal/subtitle"
+	"dashcam/internal/sysstat"
+	"dashcam/internal/thumbnail"
+	"dashcam/internal/transcribe"
+	"dashcam/internal/window"
+	"dashcam/pkg/catalog"
+	"dashcam/pkg/retention"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Version is set at build time with -ldflags "-X dashcam/pkg/recorder.Version=..."
+var Version = "dev"
+
+// Default const config filename
+const ConfigFilename = "dashcam.json"
+const journalFilename = "dashcam-journal.jsonl"
+const statusFilename = "dashcam-status.json"
+const CatalogFilename = "dashcam-catalog.jsonl"
+const jobsFilename = "dashcam-jobs.json"
+
+// annotationSeconds is how long annotations are shown in the subtitle track
+const annotationSeconds = 5
+
+// focusResync is how often the focused window is polled while the compositor
+// reports focus changes anyway, in case an event was missed
+const focusResync = 10 * time.Second
+
+// MarkerName is the extended attribute (user.dashcam) marking recordings; its
+// value tells standard recordings from protected ones
+const MarkerName = "dashcam"
+const MarkerStandard = "standard_recording" // Indicates a normal, continuous recording segment
+const MarkerEmergency = "emergency_recording"
+
+// ScreenRecorder handles the screen recording functionality
+type ScreenRecorder struct {
+	config       Config
+	sources      []*source // The main source first
+	journal      *journal.Journal
+	events       *events.Bus
+	preroll      *preroll // Buffers the main source instead of recording segments; nil when off
+	catalog      *catalog.Catalog
+	jobs         *jobs.Queue
+	pauseMutex   sync.Mutex
+	pauseReasons map[string]bool
+	pauseChange  chan struct{} // Closed and replaced whenever pausing changes
+	segmentCount atomic.Int64
+	secret       []byte
+	workers      sync.WaitGroup
+	wipe         atomic.Bool
+	muteMutex    sync.Mutex
+	muteReasons  map[string]bool
+	mutedSince   time.Time
+	mutedReason  string
+	muteSpans    []muteSpan
+
+	stateMutex    sync.Mutex // Guards the run state, the active segments and what goes with them
+	state         runState
+	startedAt     time.Time
+	stopReason    string
+	cancel        context.CancelCauseFunc  // Cancels the context of the run; nil unless running
+	active        map[string]activeSegment // Segments being recorded, by source name
+	statusChanged chan struct{}
+	uploadNeeded  chan struct{}
+
+	sharing atomic.Bool
+
+	windowMutex    sync.Mutex
+	windowTimeline []timedWindow
+
+	geoMutex sync.Mutex
+	geoFixes []geo.Fix
+
+	statsMutex   sync.Mutex
+	statsSamples []sysstat.Sample
+
+	annotationMutex sync.Mutex
+	annotations     []timedAnnotation
+
+	filesMutex sync.Mutex // Serializes retention cleanup and merging
+
+	markerMutex  sync.Mutex
+	emergencies  map[string]bool   // Segments to mark as emergency recordings when finished
+	unmarked     map[string]bool   // Finished segments being post-processed, not marked yet
+	lastSegments map[string]string // The most recently finished segment of each source
+}
+
+// timedAnnotation is a label for a point in time of the recording
+type timedAnnotation struct {
+	at   time.Time
+	text string
+}
+
+// AnnotateRequest is sent over the control socket by `dashcam annotate`
+type AnnotateRequest struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// MergeRequest is sent over the control socket by `dashcam merge`
+type MergeRequest struct {
+	Day    string `json:"day"`              // YYYY-MM-DD
+	Source string `json:"source,omitempty"` // Additional source to merge; empty for the main one
+}
+
+// MergeResult tells what a merge produced
+type MergeResult struct {
+	File  string `json:"file,omitempty"`
+	Parts int    `json:"parts"`
+}
+
+// AnnotateResult tells where an annotation ended up
+type AnnotateResult struct {
+	Segment string  `json:"segment"`
+	Offset  float64 `json:"offset"`
+}
+
+// Status describes what the recorder is doing, e.g. for status bars
+type Status struct {
+	State          string    `json:"state"` // recording, paused or stopped
+	Segment        string    `json:"segment,omitempty"`
+	SegmentStarted time.Time `json:"segment_started,omitzero"`
+	PauseReasons   []string  `json:"pause_reasons,omitempty"`
+	Muted          bool      `json:"muted"`
+	Segments       int64     `json:"segments"`
+	Jobs           int       `json:"jobs"` // Pending post-processing jobs
+	StartedAt      time.Time `json:"started_at,omitzero"`
+	PID            int       `json:"pid,omitempty"`
+}
+
+// muteSpan is a period during which the audio must be silenced
+type muteSpan struct {
+	start  time.Time
+	end    time.Time
+	reason string
+}
+
+// New creates a screen recorder for the configuration, after validating it and
+// checking that every source can record
+func New(config Config) (*ScreenRecorder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config = config.withoutUnavailable()
+	sources, err := config.recordingSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range sources {
+		if err := src.backend.Check(); err != nil {
+			return nil, fmt.Errorf("cannot record %s source with %s: %w", src.label(), src.backend.Name(), err)
+		}
+	}
+	return newScreenRecorder(config, sources), nil
+}
+
+// newScreenRecorder creates a new screen recorder instance
+func newScreenRecorder(config Config, sources []*source) *ScreenRecorder {
+	sr := &ScreenRecorder{
+		config:        config,
+		sources:       sources,
+		active:        make(map[string]activeSegment),
+		lastSegments:  make(map[string]string),
+		journal:       journal.New(filepath.Join(config.RecordingsDir, journalFilename)),
+		events:        events.NewBus(),
+		catalog:       catalog.Open(filepath.Join(config.RecordingsDir, CatalogFilename)),
+		jobs:          jobs.Open(filepath.Join(config.RecordingsDir, jobsFilename)),
+		pauseReasons:  make(map[string]bool),
+		muteReasons:   make(map[string]bool),
+		statusChanged: make(chan struct{}, 1),
+		emergencies:   make(map[string]bool),
+		unmarked:      make(map[string]bool),
+		uploadNeeded:  make(chan struct{}, 1),
+		pauseChange:   make(chan struct{}),
+	}
+	if config.PrerollSeconds > 0 {
+		sr.preroll = newPreroll(config.PrerollSeconds, config.syncInterval())
+	}
+	sr.subscribeIntegrations()
+	return sr
+}
+
+// Pause suspends recording until every pause reason has been resumed
+func (sr *ScreenRecorder) Pause(reason string) {
+	sr.pauseMutex.Lock()
+	defer sr.pauseMutex.Unlock()
+
+	if sr.pauseReasons[reason] {
+		return
+	}
+	sr.pauseReasons[reason] = true
+	log.Printf("Recording paused: %s", reason)
+	sr.emit(events.Pause, reason)
+	sr.notifyPauseChanged()
+}
+
+// Resume removes a pause reason; recording continues once none are left
+func (sr *ScreenRecorder) Resume(reason string) {
+	sr.pauseMutex.Lock()
+	defer sr.pauseMutex.Unlock()
+
+	if !sr.pauseReasons[reason] {
+		return
+	}
+	delete(sr.pauseReasons, reason)
+	log.Printf("Recording resumed: %s", reason)
+	sr.emit(events.Resume, reason)
+	sr.notifyPauseChanged()
+}
+
+// isPaused reports whether any pause reason is active
+func (sr *ScreenRecorder) isPaused() bool {
+	sr.pauseMutex.Lock()
+	defer sr.pauseMutex.Unlock()
+	return len(sr.pauseReasons) > 0
+}
+
+// notifyPauseChanged wakes up the recording loops; the caller holds pauseMutex
+func (sr *ScreenRecorder) notifyPauseChanged() {
+	close(sr.pauseChange)
+	sr.pauseChange = make(chan struct{})
+}
+
+// pauseChanges returns a channel that is closed on the next pause or resume
+func (sr *ScreenRecorder) pauseChanges() <-chan struct{} {
+	sr.pauseMutex.Lock()
+	defer sr.pauseMutex.Unlock()
+	return sr.pauseChange
+}
+
+// Mute silences the audio track (video keeps recording) until every mute reason is removed
+func (sr *ScreenRecorder) Mute(reason string) {
+	sr.muteMutex.Lock()
+	defer sr.muteMutex.Unlock()
+
+	if sr.muteReasons[reason] {
+		return
+	}
+	if len(sr.muteReasons) == 0 {
+		sr.mutedSince = time.Now()
+		sr.mutedReason = reason
+	}
+	sr.muteReasons[reason] = true
+	log.Printf("Audio muted: %s", reason)
+	sr.emit(events.Mute, reason)
+}
+
+// Unmute removes a mute reason; audio is recorded again once none are left
+func (sr *ScreenRecorder) Unmute(reason string) {
+	sr.muteMutex.Lock()
+	defer sr.muteMutex.Unlock()
+
+	if !sr.muteReasons[reason] {
+		return
+	}
+	delete(sr.muteReasons, reason)
+	if len(sr.muteReasons) == 0 {
+		sr.muteSpans = append(sr.muteSpans, muteSpan{start: sr.mutedSince, end: time.Now(), reason: sr.mutedReason})
+		sr.mutedSince = time.Time{}
+	}
+	log.Printf("Audio unmuted: %s", reason)
+	sr.emit(events.Unmute, reason)
+}
+
+// ToggleMute mutes or unmutes for the given reason
+func (sr *ScreenRecorder) ToggleMute(reason string) {
+	sr.muteMutex.Lock()
+	muted := sr.muteReasons[reason]
+	sr.muteMutex.Unlock()
+
+	if muted {
+		sr.Unmute(reason)
+	} else {
+		sr.Mute(reason)
+	}
+}
+
+// takeMuteIntervals returns the muted parts of a segment relative to its start
+// and forgets mute spans that ended before the cutoff
+func (sr *ScreenRecorder) takeMuteIntervals(start time.Time, end time.Time, cutoff time.Time) []metadata.Interval {
+	sr.muteMutex.Lock()
+	defer sr.muteMutex.Unlock()
+
+	spans := sr.muteSpans
+	if !sr.mutedSince.IsZero() {
+		spans = append(spans, muteSpan{start: sr.mutedSince, end: end, reason: sr.mutedReason})
+	}
+
+	var intervals []metadata.Interval
+	for _, span := range spans {
+		if !span.end.After(start) || !span.start.Before(end) {
+			continue
+		}
+		from := max(span.start.Sub(start).Seconds(), 0)
+		to := min(span.end.Sub(start).Seconds(), end.Sub(start).Seconds())
+		intervals = append(intervals, metadata.Interval{Start: from, End: to, Reason: span.reason})
+	}
+
+	var remaining []muteSpan
+	for _, span := range sr.muteSpans {
+		if span.end.After(cutoff) {
+			remaining = append(remaining, span)
+		}
+	}
+	sr.muteSpans = remaining
+	return intervals
+}
+
+// Status returns a snapshot of the recorder state
+func (sr *ScreenRecorder) Status() Status {
+	status := Status{
+		State:    "recording",
+		Segments: sr.segmentCount.Load(),
+		Jobs:     sr.jobs.Len(),
+		PID:      os.Getpid(),
+	}
+
+	sr.pauseMutex.Lock()
+	for reason := range sr.pauseReasons {
+		status.PauseReasons = append(status.PauseReasons, reason)
+	}
+	sr.pauseMutex.Unlock()
+	sort.Strings(status.PauseReasons)
+	if len(status.PauseReasons) > 0 {
+		status.State = "paused"
+	}
+
+	sr.muteMutex.Lock()
+	status.Muted = len(sr.muteReasons) > 0
+	sr.muteMutex.Unlock()
+
+	sr.stateMutex.Lock()
+	current := sr.active[sr.sources[0].name]
+	status.Segment = current.filename
+	status.SegmentStarted = current.started
+	status.StartedAt = sr.startedAt
+	if sr.state == stateStopped {
+		status.State = "stopped"
+	}
+	sr.stateMutex.Unlock()
+	return status
+}
+
+// setCurrentSegment records which segment a source is writing (empty when none)
+func (sr *ScreenRecorder) setCurrentSegment(src *source, filename string, started time.Time) {
+	sr.stateMutex.Lock()
+	if filename != "" {
+		sr.active[src.name] = activeSegment{filename: filename, started: started}
+	} else {
+		delete(sr.active, src.name)
+	}
+	sr.stateMutex.Unlock()
+
+	if filename != "" {
+		sr.publish(Event{Time: started, Kind: events.SegmentStart, Segment: filename, Source: src.name})
+	} else {
+		sr.notifyStatusChanged()
+	}
+}
+
+// notifyStatusChanged asks the status writer to refresh the status file without blocking
+func (sr *ScreenRecorder) notifyStatusChanged() {
+	select {
+	case sr.statusChanged <- struct{}{}:
+	default:
+	}
+}
+
+// requestUpload wakes the uploader to look for recordings to upload
+func (sr *ScreenRecorder) requestUpload() {
+	select {
+	case sr.uploadNeeded <- struct{}{}:
+	default:
+	}
+}
+
+// watchUploads uploads recordings to the configured remote when asked to and
+// every few minutes, so failed uploads are picked up again
+func (sr *ScreenRecorder) watchUploads(ctx context.Context) {
+	if sr.config.UploadRemote == "" {
+		return
+	}
+
+	which := "protected"
+	if sr.config.UploadAll {
+		which = "all"
+	}
+	log.Printf("Uploading %s recordings to %s", which, sr.config.UploadRemote)
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		files, err := UploadCandidates(sr.config)
+		if err != nil {
+			log.Printf("Warning: Could not list recordings to upload: %v", err)
+		}
+		for _, file := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := UploadFile(ctx, sr.config, file); err != nil {
+				log.Printf("Warning: %v", err)
+				continue
+			}
+			log.Printf("Uploaded %s to %s", filepath.Base(file), sr.config.UploadRemote)
+			marker, _ := attributes.GetMarker(file, MarkerName)
+			sr.publish(Event{Kind: events.Upload, Detail: filepath.Base(file), Segment: file, Marker: marker})
+		}
+
+		select {
+		case <-ticker.C:
+		case <-sr.uploadNeeded:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// statusFilePath returns where the status file for status bars is written
+func statusFilePath() string {
+	return filepath.Join(control.RuntimeDir(), statusFilename)
+}
+
+// writeStatus writes the current status to the status file
+func (sr *ScreenRecorder) writeStatus() {
+	data, err := json.Marshal(sr.Status())
+	if err != nil {
+		return
+	}
+
+	path := statusFilePath()
+	if err := control.EnsureDir(filepath.Dir(path)); err != nil {
+		log.Printf("Warning: Could not write status file: %v", err)
+		return
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0600); err != nil {
+		log.Printf("Warning: Could not write status file: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("Warning: Could not write status file: %v", err)
+	}
+}
+
+// watchStatus keeps the status file up to date
+func (sr *ScreenRecorder) watchStatus(ctx context.Context) {
+	for {
+		select {
+		case <-sr.statusChanged:
+			sr.writeStatus()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startControlServer answers status queries on the control socket
+func (sr *ScreenRecorder) startControlServer() *control.Server {
+	server, err := control.NewServer(control.DefaultSocketPath())
+	if err != nil {
+		log.Printf("Warning: Could not start control socket: %v", err)
+		return nil
+	}
+
+	server.Handle("status", func(json.RawMessage) (any, error) {
+		return sr.Status(), nil
+	})
+	server.Handle("annotate", func(args json.RawMessage) (any, error) {
+		var request AnnotateRequest
+		if err := json.Unmarshal(args, &request); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+		return sr.Annotate(request.Time, request.Text)
+	})
+	server.Handle("emergency", func(json.RawMessage) (any, error) {
+		sr.MarkEmergency("command")
+		return nil, nil
+	})
+	server.Handle("merge", func(args json.RawMessage) (any, error) {
+		var request MergeRequest
+		if err := json.Unmarshal(args, &request); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+		day, err := ParseDay(request.Day)
+		if err != nil {
+			return nil, err
+		}
+		return sr.mergeDay(day, request.Source)
+	})
+	server.Handle("review", func(args json.RawMessage) (any, error) {
+		var request ReviewRequest
+		if err := json.Unmarshal(args, &request); err != nil {
+			return nil, fmt.Errorf("invalid arguments: %v", err)
+		}
+		return nil, sr.setReview(request)
+	})
+	server.HandleStream("events", func(_ json.RawMessage, send func(any) error) error {
+		return sr.streamEvents(send)
+	})
+
+	go server.Serve()
+	return server
+}
+
+// Annotate adds a label at the given time to the segment being recorded
+func (sr *ScreenRecorder) Annotate(at time.Time, text string) (AnnotateResult, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return AnnotateResult{}, fmt.Errorf("empty annotation")
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if at.After(time.Now()) {
+		return AnnotateResult{}, fmt.Errorf("annotation time %s is in the future", at.Format(time.RFC3339))
+	}
+
+	current := sr.currentSegment()
+	segment, started := current.filename, current.started
+	if segment == "" {
+		return AnnotateResult{}, fmt.Errorf("no segment is being recorded")
+	}
+	if at.Before(started) {
+		return AnnotateResult{}, fmt.Errorf("annotation time %s is before the current segment started (%s)",
+			at.Format(time.RFC3339), started.Format(time.RFC3339))
+	}
+
+	// Keep the annotations sorted, labels for a past moment may arrive late
+	sr.annotationMutex.Lock()
+	i := sort.Search(len(sr.annotations), func(i int) bool { return sr.annotations[i].at.After(at) })
+	sr.annotations = slices.Insert(sr.annotations, i, timedAnnotation{at: at, text: text})
+	sr.annotationMutex.Unlock()
+
+	sr.emit(events.Annotate, text)
+	return AnnotateResult{Segment: filepath.Base(segment), Offset: at.Sub(started).Seconds()}, nil
+}
+
+// takeAnnotations returns the annotations of a segment and forgets those before the cutoff
+func (sr *ScreenRecorder) takeAnnotations(start time.Time, end time.Time, cutoff time.Time) []metadata.Annotation {
+	sr.annotationMutex.Lock()
+	defer sr.annotationMutex.Unlock()
+
+	var annotations []metadata.Annotation
+	keep := 0
+	for i, annotation := range sr.annotations {
+		if !annotation.at.Before(end) {
+			break
+		}
+		if annotation.at.Before(cutoff) {
+			keep = i + 1
+		}
+		// Kept for a segment of another source
+		if annotation.at.Before(start) {
+			continue
+		}
+		annotations = append(annotations, metadata.Annotation{
+			Offset: max(annotation.at.Sub(start).Seconds(), 0),
+			Text:   annotation.text,
+		})
+	}
+	sr.annotations = sr.annotations[keep:]
+	return annotations
+}
+
+// watchCalendar pauses recording while a tagged calendar event is running
+func (sr *ScreenRecorder) watchCalendar(ctx context.Context) {
+	if sr.config.CalendarPath == "" {
+		return
+	}
+
+	log.Printf("Watching calendar %s for events tagged '%s'", sr.config.CalendarPath, sr.config.CalendarTag)
+	activeReason := ""
+	warned := make(map[string]bool)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		events, err := calendar.Load(sr.config.CalendarPath)
+		if err != nil {
+			log.Printf("Warning: Could not load calendar: %v", err)
+		}
+		for _, event := range events {
+			if event.Unsupported == "" || !event.HasTag(sr.config.CalendarTag) || warned[event.Summary] {
+				continue
+			}
+			warned[event.Summary] = true
+			log.Printf("Warning: Calendar event '%s' repeats in a way that can't be expanded (%s), only its first occurrence pauses recording",
+				strings.TrimSpace(event.Summary), event.Unsupported)
+		}
+
+		reason := ""
+		if event, ok := calendar.ActiveTagged(events, sr.config.CalendarTag, time.Now()); ok {
+			reason = "calendar: " + strings.TrimSpace(event.Summary)
+		}
+
+		if reason != activeReason {
+			if activeReason != "" {
+				sr.Resume(activeReason)
+			}
+			if reason != "" {
+				sr.Pause(reason)
+			}
+			activeReason = reason
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchFocusedWindow follows the focused window: it pauses recording (or mutes
+// audio) while a blacklisted application is focused and keeps the window timeline.
+// It reacts to the compositor's focus events and polls only as a fallback.
+func (sr *ScreenRecorder) watchFocusedWindow(ctx context.Context) {
+	blacklists := len(sr.config.PauseOnApps) > 0 || len(sr.config.MuteOnApps) > 0
+	if !blacklists && sr.config.WindowSampleSecs <= 0 {
+		return
+	}
+
+	// With focus events, polling only catches what they missed. Without them
+	// blacklists must react quickly; the timeline alone can be sampled less often.
+	resync := focusResync
+	if sr.config.WindowSampleSecs > 0 {
+		resync = min(resync, time.Duration(sr.config.WindowSampleSecs)*time.Second)
+	}
+	poll := 1 * time.Second
+	if !blacklists {
+		poll = time.Duration(sr.config.WindowSampleSecs) * time.Second
+	}
+
+	changed := make(chan struct{}, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- window.Watch(ctx, func() {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	if len(sr.config.PauseOnApps) > 0 {
+		log.Printf("Pausing while one of these apps is focused: %s", strings.Join(sr.config.PauseOnApps, ", "))
+	}
+	if len(sr.config.MuteOnApps) > 0 {
+		log.Printf("Muting audio while one of these apps is focused: %s", strings.Join(sr.config.MuteOnApps, ", "))
+	}
+	pauseReason := ""
+	muteReason := ""
+	lastErr := ""
+	ticker := time.NewTicker(resync)
+	defer ticker.Stop()
+
+	for {
+		// Until the focused window is known again, a blacklisted app may still
+		// have focus, so the current pause and mute stay in place
+		focused, err := window.Focused()
+		if err != nil {
+			// Log each distinct error once instead of every second
+			if err.Error() != lastErr {
+				log.Printf("Warning: Could not query focused window: %v", err)
+				lastErr = err.Error()
+			}
+		} else {
+			lastErr = ""
+			sr.applyFocus(focused, &pauseReason, &muteReason)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-changed:
+		case err := <-watchErr:
+			if err != nil {
+				log.Printf("Warning: Could not follow focus changes, polling every %v: %v", poll, err)
+				ticker.Reset(poll)
+			}
+			watchErr = nil
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// applyFocus pauses and mutes for the focused window, lifting the pause and
+// mute of the previously focused one (kept in pauseReason and muteReason)
+func (sr *ScreenRecorder) applyFocus(focused window.Window, pauseReason *string, muteReason *string) {
+	newPauseReason := ""
+	newMuteReason := ""
+	if pattern, ok := focused.MatchesAny(sr.config.PauseOnApps); ok {
+		newPauseReason = "app: " + pattern
+	}
+	if pattern, ok := focused.MatchesAny(sr.config.MuteOnApps); ok {
+		newMuteReason = "app: " + pattern
+	}
+	if sr.config.WindowSampleSecs > 0 {
+		sr.recordWindow(focused)
+	}
+
+	if newPauseReason != *pauseReason {
+		if *pauseReason != "" {
+			sr.Resume(*pauseReason)
+		}
+		if newPauseReason != "" {
+			sr.Pause(newPauseReason)
+		}
+		*pauseReason = newPauseReason
+	}
+
+	if newMuteReason != *muteReason {
+		if *muteReason != "" {
+			sr.Unmute(*muteReason)
+		}
+		if newMuteReason != "" {
+			sr.Mute(newMuteReason)
+		}
+		*muteReason = newMuteReason
+	}
+}
+
+// timedWindow is a focus change on the window timeline
+type timedWindow struct {
+	at     time.Time
+	window window.Window
+}
+
+// recordWindow adds the focused window to the timeline if it changed
+func (sr *ScreenRecorder) recordWindow(focused window.Window) {
+	sr.windowMutex.Lock()
+	defer sr.windowMutex.Unlock()
+
+	if n := len(sr.windowTimeline); n > 0 && sr.windowTimeline[n-1].window == focused {
+		return
+	}
+	sr.windowTimeline = append(sr.windowTimeline, timedWindow{at: time.Now(), window: focused})
+}
+
+// takeWindowTimeline returns the focused windows during a segment relative to its
+// start and forgets everything before the cutoff but the window focused then
+func (sr *ScreenRecorder) takeWindowTimeline(start time.Time, end time.Time, cutoff time.Time) []metadata.WindowSample {
+	sr.windowMutex.Lock()
+	defer sr.windowMutex.Unlock()
+
+	var samples []metadata.WindowSample
+	for i, entry := range sr.windowTimeline {
+		if !entry.at.Before(end) {
+			break
+		}
+		// The window focused before the segment started is still focused at its start
+		if next := i + 1; next < len(sr.windowTimeline) && !sr.windowTimeline[next].at.After(start) {
+			continue
+		}
+		samples = append(samples, metadata.WindowSample{
+			Offset: max(entry.at.Sub(start).Seconds(), 0),
+			AppID:  entry.window.AppID,
+			Title:  entry.window.Title,
+		})
+	}
+
+	// Keep the last focus change before the cutoff, it carries over into the next segment
+	keep := 0
+	for i, entry := range sr.windowTimeline {
+		if entry.at.Before(cutoff) {
+			keep = i
+		}
+	}
+	if len(sr.windowTimeline) > 0 {
+		sr.windowTimeline = sr.windowTimeline[keep:]
+	}
+	return samples
+}
+
+// watchLocation periodically asks GeoClue for the current position
+func (sr *ScreenRecorder) watchLocation(ctx context.Context) {
+	if !sr.config.Geolocation {
+		return
+	}
+
+	interval := time.Duration(max(sr.config.GeoInterval, 1)) * time.Second
+	log.Printf("Recording location every %s via %s", interval, sr.config.GeoCommand)
+	lastErr := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fix, err := geo.Query(ctx, sr.config.GeoCommand, min(interval, 10*time.Second))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// Log each distinct error once instead of on every query
+			if err.Error() != lastErr {
+				log.Printf("Warning: Could not get location: %v", err)
+				lastErr = err.Error()
+			}
+		} else {
+			lastErr = ""
+			sr.geoMutex.Lock()
+			sr.geoFixes = append(sr.geoFixes, fix)
+			sr.geoMutex.Unlock()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// takeLocations returns the position fixes of a segment, including the last known
+// position at its start, and forgets everything before the cutoff but the fix valid then
+func (sr *ScreenRecorder) takeLocations(start time.Time, end time.Time, cutoff time.Time) []geo.Fix {
+	sr.geoMutex.Lock()
+	defer sr.geoMutex.Unlock()
+
+	var fixes []geo.Fix
+	for i, fix := range sr.geoFixes {
+		if !fix.Time.Before(end) {
+			break
+		}
+		if next := i + 1; next < len(sr.geoFixes) && !sr.geoFixes[next].Time.After(start) {
+			continue
+		}
+		fixes = append(fixes, fix)
+	}
+
+	keep := 0
+	for i, fix := range sr.geoFixes {
+		if fix.Time.Before(cutoff) {
+			keep = i
+		}
+	}
+	if len(sr.geoFixes) > 0 {
+		sr.geoFixes = sr.geoFixes[keep:]
+	}
+	return fixes
+}
+
+// watchSystemStats periodically samples CPU, memory and network load
+func (sr *ScreenRecorder) watchSystemStats(ctx context.Context) {
+	if !sr.config.SystemStats {
+		return
+	}
+
+	interval := time.Duration(max(sr.config.StatsInterval, 1)) * time.Second
+	var sampler sysstat.Sampler
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sample, ok, err := sampler.Read()
+		if err != nil {
+			log.Printf("Warning: Could not sample system load, disabling system stats: %v", err)
+			return
+		}
+		if ok {
+			sr.statsMutex.Lock()
+			sr.statsSamples = append(sr.statsSamples, sample)
+			sr.statsMutex.Unlock()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// takeSystemStats returns the load samples taken during a segment and forgets those before the cutoff
+func (sr *ScreenRecorder) takeSystemStats(start time.Time, end time.Time, cutoff time.Time) []metadata.SystemSample {
+	sr.statsMutex.Lock()
+	defer sr.statsMutex.Unlock()
+
+	var samples []metadata.SystemSample
+	keep := 0
+	for i, sample := range sr.statsSamples {
+		if !sample.Time.Before(end) {
+			break
+		}
+		if sample.Time.Before(cutoff) {
+			keep = i + 1
+		}
+		if sample.Time.Before(start) {
+			continue
+		}
+		samples = append(samples, metadata.SystemSample{
+			Offset:  sample.Time.Sub(start).Seconds(),
+			CPU:     sample.CPU,
+			Memory:  sample.Memory,
+			RxBytes: sample.RxBytes,
+			TxBytes: sample.TxBytes,
+		})
+	}
+	sr.statsSamples = sr.statsSamples[keep:]
+	return samples
+}
+
+// mergeDay merges the standard recordings of a source of a finished day into one file
+func (sr *ScreenRecorder) mergeDay(day time.Time, source string) (MergeResult, error) {
+	// Segments of the running day may still be post-processed
+	if y, m, d := day.Date(); time.Date(y, m, d, 0, 0, 0, 0, time.Local).AddDate(0, 0, 1).After(time.Now()) {
+		return MergeResult{}, fmt.Errorf("cannot merge %s while it is being recorded", day.Format("2006-01-02"))
+	}
+
+	sr.filesMutex.Lock()
+	defer sr.filesMutex.Unlock()
+
+	// MarkEmergency sets markers under markerMutex
+	file, parts, err := merge(sr.config, sr.catalog, day, source, &sr.markerMutex)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	if file != "" {
+		log.Printf("Merged %d recordings of %s into %s", parts, day.Format("2006-01-02"), filepath.Base(file))
+		sr.emit(events.Merge, fmt.Sprintf("%s: %d recordings into %s", day.Format("2006-01-02"), parts, filepath.Base(file)))
+	}
+	return MergeResult{File: file, Parts: parts}, nil
+}
+
+// watchDailyJobs renders the timelapse of and merges the recordings of every
+// finished day and queues the re-encoding of old ones, at startup and then hourly
+func (sr *ScreenRecorder) watchDailyJobs(ctx context.Context) {
+	if !sr.config.DailyMerge && !sr.config.DailyTimelapse && sr.config.ArchiveCodec == "" {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		segments, err := ListSegments(sr.config)
+		if err != nil {
+			log.Printf("Warning: Could not list recordings for daily jobs: %v", err)
+		}
+
+		today := time.Now().Format("2006-01-02")
+		done := make(map[string]bool)
+		for _, segment := range segments {
+			day := segment.Meta.Start.Format("2006-01-02")
+			if day >= today || done[day] {
+				continue
+			}
+			done[day] = true
+
+			if sr.config.DailyTimelapse && !timelapseExists(sr.config, segment.Meta.Start) {
+				sr.queueJob(jobTimelapse, day)
+			}
+			// The day is merged once its timelapse is rendered
+			if sr.config.DailyMerge && !sr.jobs.Has(day) {
+				for _, src := range sr.sources {
+					if ctx.Err() != nil {
+						return
+					}
+					if _, err := sr.mergeDay(segment.Meta.Start, src.name); err != nil {
+						log.Printf("Warning: Could not merge %s recordings of %s: %v", src.label(), day, err)
+					}
+				}
+			}
+		}
+		if sr.config.ArchiveCodec != "" {
+			sr.queueReencodes()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchScreenShare pauses or marks recording while the screen is shared with others
+func (sr *ScreenRecorder) watchScreenShare(ctx context.Context) {
+	if sr.config.ScreenShare == "" {
+		return
+	}
+
+	log.Printf("Watching for screen sharing (action: %s)", sr.config.ScreenShare)
+	activeShare := ""
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		share, sharing := screenshare.Detect(sr.config.ShareProcesses)
+		if share != activeShare {
+			if activeShare != "" {
+				log.Printf("Screen sharing ended: %s", activeShare)
+				sr.emit(events.ScreenShareEnd, activeShare)
+				if sr.config.ScreenShare == "pause" {
+					sr.Resume(activeShare)
+				}
+			}
+			if sharing {
+				log.Printf("Screen sharing detected: %s", share)
+				sr.emit(events.ScreenShareStart, share)
+				if sr.config.ScreenShare == "pause" {
+					sr.Pause(share)
+				}
+			}
+			activeShare = share
+		}
+
+		sr.sharing.Store(sharing)
+		if sharing {
+			for _, src := range sr.sources {
+				src.sharedInSegment.Store(true)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ensureRecordingsDir creates the recordings directory if it doesn't exist
+// and makes sure only the configured users can get at the recordings
+func (sr *ScreenRecorder) ensureRecordingsDir() error {
+	dirMode := sr.config.DirPermissions()
+	if err := os.MkdirAll(sr.config.RecordingsDir, dirMode); err != nil {
+		return err
+	}
+
+	return applyDirMode(sr.config.RecordingsDir, dirMode)
+}
+
+// generateFilename creates a filename based on the recording's start and the source
+func (sr *ScreenRecorder) generateFilename(src *source, start time.Time) string {
+	name := start.Format("2006-01-02_15-04-05")
+	if src.name != "" {
+		name += "_" + src.name
+	}
+	return filepath.Join(sr.config.RecordingsDir, name+src.config.Extension)
+}
+
+// recordScreen records a source for the specified duration, or until ctx is
+// cancelled, which finishes the segment early
+func (sr *ScreenRecorder) recordScreen(ctx context.Context, src *source, filename string, duration int) error {
+	log.Printf("Starting recording: %s (duration: %d seconds)", filename, duration)
+
+	// Cancelling ctx mustn't kill the capture program, it's interrupted so it
+	// can finalize the file
+	captureCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	// Masked regions are blacked out or blurred by the backend's ffmpeg filter
+	name := src.backend.Name()
+	cmd := src.backend.Command(captureCtx, filename, capture.Options{
+		Codec:    src.config.Codec,
+		Filter:   mask.Filter(src.config.MaskRegions),
+		Audio:    src.config.RecordAudio,
+		Adaptive: src.config.AdaptiveEncoding,
+		Flush:    src.config.syncInterval(),
+	})
+
+	// Start the recording
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %v", name, err)
+	}
+	stopSyncing := syncWhileRecording(filename, src.config.syncInterval())
+	defer stopSyncing()
+
+	// Create a timer to stop recording after specified duration
+	timer := time.NewTimer(time.Duration(duration) * time.Second)
+	defer timer.Stop()
+
+	// Wait for either the timer or process to finish
+	pauseChanged := sr.pauseChanges()
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	for {
+		select {
+		case <-timer.C:
+			// Time's up - send SIGINT (Ctrl+C) to the recorder for clean shutdown
+			log.Printf("Recording duration %d seconds reached, sending Ctrl+C to %s...", duration, name)
+			stopRecorder(cmd, done)
+			log.Printf("Recording completed: %s", filename)
+			return nil
+		case <-ctx.Done():
+			// Shutting down - finalize the segment before exiting
+			log.Printf("Stopping recorder, finishing segment...")
+			stopRecorder(cmd, done)
+			log.Printf("Recording completed: %s", filename)
+			return nil
+		case <-pauseChanged:
+			pauseChanged = sr.pauseChanges()
+			if !sr.isPaused() {
+				continue
+			}
+			// Paused mid-segment - finish the file so nothing more is captured
+			log.Printf("Recording paused, finishing segment early...")
+			stopRecorder(cmd, done)
+			log.Printf("Recording completed: %s", filename)
+			return nil
+		case err := <-done:
+			// Process finished on its own
+			if err != nil {
+				return fmt.Errorf("%s failed: %v", name, err)
+			}
+			log.Printf("Recording completed: %s", filename)
+			return nil
+		}
+	}
+}
+
+// syncWhileRecording flushes what the capture program has written of a segment
+// to disk every interval, so a power loss costs at most that much footage. The
+// returned function stops syncing, once the capture program has finished the
+// file, and syncs it one last time.
+func syncWhileRecording(filename string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastErr := ""
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			// The capture program may not have created the file yet
+			if err := syncFile(filename); err != nil && !os.IsNotExist(err) && err.Error() != lastErr {
+				log.Printf("Warning: Could not sync %s: %v", filepath.Base(filename), err)
+				lastErr = err.Error()
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := syncFile(filename); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Could not sync %s: %v", filepath.Base(filename), err)
+		}
+	}
+}
+
+// syncFile flushes a file another program is writing to disk
+func syncFile(filename string) error {
+	// Windows only flushes files opened for writing; nothing is written
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// stopRecorder sends Ctrl+C to the recording program and waits for it to finalize the file
+func stopRecorder(cmd *exec.Cmd, done chan error) {
+	name := filepath.Base(cmd.Path)
+	if err := capture.Interrupt(cmd.Process); err != nil {
+		log.Printf("Warning: Could not send Ctrl+C to %s: %v", name, err)
+		// Fallback to killing the process
+		cmd.Process.Kill()
+	}
+
+	// Wait a bit for graceful shutdown
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("%s finished with: %v", name, err)
+		}
+	case <-time.After(5 * time.Second):
+		log.Printf("%s didn't respond to Ctrl+C, killing process...", name)
+		cmd.Process.Kill()
+		<-done // Wait for it to actually die
+	}
+}
+
+// cleanupOldFiles removes old video files to maintain the max file limit. It
+// stops removing once ctx is cancelled; the next round catches up.
+func (sr *ScreenRecorder) cleanupOldFiles(ctx context.Context) error {
+	// Runs between segments, so don't wait for a merge; the next round catches up
+	if !sr.filesMutex.TryLock() {
+		log.Printf("Skipping cleanup while recordings are being merged")
+		return nil
+	}
+	defer sr.filesMutex.Unlock()
+
+	recordings, err := retention.Candidates(sr.config.RecordingsDir, MarkerName, MarkerStandard)
+	if err != nil {
+		return err
+	}
+
+	// Remove excess files
+	expired := retention.Expired(recordings, sr.config.MaxFiles)
+	if len(expired) == 0 {
+		return nil
+	}
+	removed := make(map[string]bool)
+	for _, recording := range expired {
+		if ctx.Err() != nil {
+			break
+		}
+		file := recording.Path
+		log.Printf("Removing old recording: %s", filepath.Base(file))
+		if err := os.Remove(file); err != nil {
+			log.Printf("Warning: Could not remove file %s: %v", file, err)
+			continue
+		}
+		removed[filepath.Base(crypt.PlainName(file))] = true
+		for _, sidecar := range sidecarFiles(file) {
+			if err := os.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: Could not remove %s: %v", sidecar, err)
+			}
+		}
+	}
+
+	// Forget the text index of removed recordings
+	if err := sr.catalog.RemoveSegments(removed); err != nil {
+		log.Printf("Warning: Could not update catalog: %v", err)
+	}
+	if len(removed) > 0 {
+		sr.emit(events.Cleanup, fmt.Sprintf("removed %d recordings", len(removed)))
+	}
+
+	return nil
+}
+
+// WipeRecordings securely deletes all non-protected recordings, the journal, the catalog,
+// the job queue and timelapses.
+// Recordings whose marker differs from a standard recording (e.g. emergency
+// recordings) are protected and kept.
+func WipeRecordings(config Config) (int, int, error) {
+	files, err := attributes.ScanMarkedFiles(config.RecordingsDir, MarkerName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	wiped, protected := 0, 0
+	for _, marked := range files {
+		if marked.Marker != MarkerStandard {
+			protected++
+			continue
+		}
+
+		file := marked.Path
+
+		if err := shred.File(file); err != nil {
+			log.Printf("Warning: Could not wipe '%s': %v", file, err)
+			continue
+		}
+		for _, sidecar := range sidecarFiles(file) {
+			if err := shred.File(sidecar); err != nil {
+				log.Printf("Warning: Could not wipe '%s': %v", sidecar, err)
+			}
+		}
+		wiped++
+	}
+
+	if err := shred.File(filepath.Join(config.RecordingsDir, journalFilename)); err != nil {
+		log.Printf("Warning: Could not wipe journal: %v", err)
+	}
+	if err := shred.File(filepath.Join(config.RecordingsDir, CatalogFilename)); err != nil {
+		log.Printf("Warning: Could not wipe catalog: %v", err)
+	}
+	if err := shred.File(filepath.Join(config.RecordingsDir, jobsFilename)); err != nil {
+		log.Printf("Warning: Could not wipe job queue: %v", err)
+	}
+	if err := shred.File(filepath.Join(config.RecordingsDir, mergeIntentFilename)); err != nil {
+		log.Printf("Warning: Could not wipe merge record: %v", err)
+	}
+
+	// Timelapses show everything, including what protected recordings don't cover
+	timelapses, _ := filepath.Glob(filepath.Join(config.RecordingsDir, "*"+timelapseSuffix+"*"))
+	for _, timelapse := range timelapses {
+		if err := shred.File(timelapse); err != nil {
+			log.Printf("Warning: Could not wipe '%s': %v", timelapse, err)
+		}
+	}
+
+	return wiped, protected, nil
+}
+
+// panicWipe wipes the archive like WipeRecordings, along with the segments still
+// being post-processed, which aren't marked as recordings yet, and everything
+// written for them. Those marked as emergency recordings meanwhile are kept.
+// It returns the number of removed and kept recordings.
+func (sr *ScreenRecorder) panicWipe() (int, int) {
+	// Nothing may be left behind, not even a summary in the journal; let the
+	// journal catch up before it's wiped
+	sr.events.Close()
+
+	wiped, protected, err := WipeRecordings(sr.config)
+	if err != nil {
+		log.Printf("Warning: Panic wipe failed: %v", err)
+	}
+
+	sr.markerMutex.Lock()
+	var unmarked []string
+	for filename := range sr.unmarked {
+		if sr.emergencies[filename] {
+			protected++
+			continue
+		}
+		unmarked = append(unmarked, filename)
+	}
+	sr.markerMutex.Unlock()
+
+	for _, filename := range unmarked {
+		ext := filepath.Ext(filename)
+		files := append([]string{filename, filename + crypt.Extension, strings.TrimSuffix(filename, ext) + ".rewrite" + ext},
+			sidecarFiles(filename)...)
+		if FileExists(filename) || FileExists(filename+crypt.Extension) {
+			wiped++
+		}
+		for _, file := range files {
+			if err := shred.File(file); err != nil {
+				log.Printf("Warning: Could not wipe '%s': %v", file, err)
+			}
+		}
+	}
+	return wiped, protected
+}
+
+// RequestWipe stops recording and wipes the archive once the current segment is
+// closed, without waiting for its post-processing
+func (sr *ScreenRecorder) RequestWipe() {
+	log.Println("Panic wipe requested!")
+	sr.wipe.Store(true)
+	sr.Stop("panic wipe")
+}
+
+// Start begins the continuous recording process and blocks until the recorder
+// has stopped and finished post-processing. The recorder stops when Stop is
+// called or ctx is cancelled; everything it runs in the background is tied to a
+// context derived from ctx and has returned by the time Start does.
+func (sr *ScreenRecorder) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	startedAt, err := sr.begin(cancel)
+	if err != nil {
+		return err
+	}
+	// Cancelling the parent context stops the recorder like Stop does
+	stopWatching := context.AfterFunc(ctx, func() {
+		sr.Stop(context.Cause(ctx).Error())
+	})
+	defer stopWatching()
+
+	// Everything we (and the capture program) create is private unless configured otherwise
+	setUmask(0777 &^ sr.config.DirPermissions())
+
+	if err := sr.ensureRecordingsDir(); err != nil {
+		sr.abort()
+		return fmt.Errorf("failed to prepare recordings directory: %v", err)
+	}
+	if !attributes.Supported(sr.config.RecordingsDir) {
+		log.Printf("Warning: %s can't store markers (extended attributes, or alternate data streams on Windows); emergency recordings won't be protected from cleanup", sr.config.RecordingsDir)
+	}
+
+	if sr.config.Encrypt {
+		secret, err := crypt.LoadSecret(sr.config.EncryptionKey)
+		if err != nil {
+			sr.abort()
+			return fmt.Errorf("failed to load encryption key: %v", err)
+		}
+		sr.secret = secret
+	}
+	// Before cleanup can count the parts of a half finished merge as recordings
+	if err := recoverMerge(sr.config, sr.catalog); err != nil {
+		log.Printf("Warning: Could not recover the interrupted merge: %v", err)
+	}
+
+	log.Println("Screen recorder started.")
+	sr.emit(events.Start, "")
+
+	// Background workers run until ctx is cancelled and are waited for before
+	// the final cleanup
+	var watchers sync.WaitGroup
+	watch := func(worker func(context.Context)) {
+		watchers.Add(1)
+		go func() {
+			defer watchers.Done()
+			worker(ctx)
+		}()
+	}
+
+	// Status for status bars: a file plus the control socket
+	sr.writeStatus()
+	watch(sr.watchStatus)
+	if server := sr.startControlServer(); server != nil {
+		defer server.Close()
+	}
+
+	// Shut down cleanly when the compositor exits (logout)
+	if sr.Headless() {
+		log.Printf("No source records the desktop session, running headless")
+	} else if sessionEnded, err := session.WatchWayland(ctx); err != nil {
+		log.Printf("Warning: Could not watch Wayland session: %v", err)
+	} else {
+		watch(func(ctx context.Context) {
+			<-sessionEnded
+			if ctx.Err() == nil {
+				log.Println("Wayland session ended. Stopping recorder...")
+				sr.Stop("session ended")
+			}
+		})
+	}
+
+	watch(sr.watchCalendar)
+	if !sr.Headless() {
+		watch(sr.watchFocusedWindow)
+		watch(sr.watchScreenShare)
+	}
+	watch(sr.watchLocation)
+	watch(sr.watchSystemStats)
+	watch(sr.watchDailyJobs)
+	watch(sr.watchUploads)
+	watch(func(ctx context.Context) {
+		sr.jobs.Run(ctx, sr.config.JobWorkers, sr.config.JobNice, sr.runJob)
+	})
+
+	// Additional sources record alongside the main one and share its retention budget
+	var loops sync.WaitGroup
+	for _, src := range sr.sources[1:] {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			sr.recordLoop(ctx, src)
+		}()
+	}
+	if sr.preroll != nil {
+		sr.prerollLoop(ctx, sr.sources[0])
+	} else {
+		sr.recordLoop(ctx, sr.sources[0])
+	}
+	loops.Wait()
+	// Post-processing and running jobs may take minutes, which a panic wipe
+	// doesn't wait for
+	if sr.wipe.Load() {
+		wiped, protected := sr.panicWipe()
+		log.Printf("Panic wipe: removed %d recordings, kept %d protected", wiped, protected)
+	}
+	watchers.Wait()
+	sr.shutdown(ctx, startedAt)
+	return nil
+}
+
+// recordLoop records segments of a source one after the other until ctx is cancelled
+func (sr *ScreenRecorder) recordLoop(ctx context.Context, src *source) {
+	loopcounter := 0
+	for ctx.Err() == nil {
+		loopcounter += 1
+
+		// Wait while recording is paused
+		pauseChanged := sr.pauseChanges()
+		if sr.isPaused() {
+			select {
+			case <-ctx.Done():
+			case <-pauseChanged:
+			}
+			continue
+		}
+
+		segmentStart := time.Now()
+		filename := sr.generateFilename(src, segmentStart)
+		sr.setCurrentSegment(src, filename, segmentStart)
+		src.sharedInSegment.Store(sr.sharing.Load())
+
+		// Record screen
+		err := sr.recordScreen(ctx, src, filename, src.config.RecordingLength)
+		sr.setCurrentSegment(src, "", time.Time{})
+		if err != nil {
+			log.Printf("Recording failed (%s): %v", src.label(), err)
+			sr.publish(Event{Kind: events.Error, Detail: err.Error(), Segment: filename, Source: src.name})
+			if ctx.Err() != nil {
+				// The compositor may have taken the capture program down with it;
+				// keep what was written so retention still manages it
+				sr.finishSegment(src, filename, segmentStart, time.Now())
+				continue
+			}
+			// Wait a bit before trying again to avoid rapid failures
+			retryAfter(ctx, 2*time.Second)
+			continue
+		}
+
+		// Post-process and mark file as dashcam recording
+		sr.finishSegment(src, filename, segmentStart, time.Now())
+
+		// Cleanup old files; one loop is enough since all sources share the budget
+		if src.name == "" && loopcounter%10 == 0 {
+			if err := sr.cleanupOldFiles(ctx); err != nil {
+				log.Printf("Warning: Failed to cleanup old files: %v", err)
+			}
+		}
+	}
+}
+
+// retryAfter waits before the next attempt after a failure, or until ctx is cancelled
+func retryAfter(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// finishSegment post-processes a recorded segment in the background:
+// silencing muted audio, writing its metadata, marking and encrypting it
+func (sr *ScreenRecorder) finishSegment(src *source, filename string, start time.Time, end time.Time) {
+	if info, err := os.Stat(filename); err != nil || info.Size() == 0 {
+		return
+	}
+	sr.markerMutex.Lock()
+	sr.lastSegments[src.name] = filename
+	sr.unmarked[filename] = true
+	sr.markerMutex.Unlock()
+
+	// Context that other sources still record over is kept for their segments
+	cutoff := sr.contextCutoff(end)
+	meta := metadata.Segment{
+		Start:         start,
+		End:           end,
+		Source:        src.name,
+		MuteIntervals: sr.takeMuteIntervals(start, end, cutoff),
+		Windows:       sr.takeWindowTimeline(start, end, cutoff),
+		ScreenShared:  src.sharedInSegment.Load(),
+		System:        sr.takeSystemStats(start, end, cutoff),
+		Annotations:   sr.takeAnnotations(start, end, cutoff),
+	}
+	fixes := sr.takeLocations(start, end, cutoff)
+	for _, fix := range fixes {
+		meta.Locations = append(meta.Locations, metadata.Location{
+			Offset:    max(fix.Time.Sub(start).Seconds(), 0),
+			Latitude:  fix.Latitude,
+			Longitude: fix.Longitude,
+			Accuracy:  fix.Accuracy,
+			Altitude:  fix.Altitude,
+		})
+	}
+
+	sr.workers.Add(1)
+	go func() {
+		defer sr.workers.Done()
+
+		// A panic wipe doesn't wait for post-processing: it stops between steps,
+		// and the wipe takes what was written so far (see panicWipe)
+		if sr.wipe.Load() {
+			return
+		}
+		if len(meta.MuteIntervals) > 0 && src.config.RecordAudio {
+			if err := muteSegmentAudio(filename, meta.MuteIntervals); err != nil {
+				log.Printf("Warning: Could not mute audio of '%s': %v", filename, err)
+			}
+		}
+
+		if sr.config.WindowChapters || sr.config.Subtitles || sr.config.EmbedTags {
+			// The marker is set after the remux, but the tags must already carry it
+			if err := sr.embedContext(filename, meta, sr.pendingMarker(filename)); err != nil {
+				log.Printf("Warning: Could not embed chapters/subtitles/tags into '%s': %v", filename, err)
+			}
+		}
+
+		if sr.wipe.Load() {
+			return
+		}
+		// One read of the finished file serves the checksum, the analysis and the encryption
+		digest, err := sr.digestSegment(filename, end.Sub(start).Seconds())
+		if err != nil {
+			log.Printf("Warning: Could not read '%s' for post-processing: %v", filename, err)
+		}
+		meta.Activity = digest.analysis.Activity
+		meta.Scenes = digest.analysis.Scenes
+		meta.SHA256 = digest.checksum
+		if sr.wipe.Load() {
+			return
+		}
+
+		// The catalog is plain text, so with encryption annotations only go into the sealed metadata
+		if !sr.config.Encrypt {
+			sr.indexAnnotations(filename, meta)
+		}
+
+		if err := os.Chmod(filename, sr.config.FilePermissions()); err != nil {
+			log.Printf("Warning: Could not set permissions on '%s': %v", filename, err)
+		}
+
+		if err := sr.saveMetadata(filename, meta); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+
+		if sr.config.GPXSidecar && len(fixes) > 0 {
+			if err := geo.WriteGPX(gpxPath(filename), filepath.Base(filename), fixes); err != nil {
+				log.Printf("Warning: Could not write GPX track for '%s': %v", filename, err)
+			}
+		}
+
+		marker, err := sr.setSegmentMarker(filename)
+		if err != nil {
+			log.Printf("Warning: Failed to set marker on file '%s': %v", filename, err)
+			if digest.encrypted != "" {
+				os.Remove(digest.encrypted)
+			}
+			return
+		}
+		sr.segmentCount.Add(1)
+
+		path := filename
+		if digest.encrypted != "" {
+			if sr.sealEncrypted(filename, digest.encrypted) {
+				path = digest.encrypted
+			} else if meta.SHA256 != "" {
+				// The checksum is of the encrypted copy that was dropped
+				meta.SHA256 = ""
+				if err := sr.saveMetadata(filename, meta); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			}
+		}
+		sr.publish(Event{Time: end, Kind: events.SegmentEnd, Segment: path, Source: src.name, Marker: marker})
+
+		// The slow part runs in the job queue, after muting, so muted passages
+		// stay out of the transcript
+		// Screen text and speech would end up in the plain catalog (and transcript),
+		// so OCR and transcription are skipped with encryption
+		if sr.config.OCR && !sr.config.Encrypt {
+			sr.queueJob(jobOCR, filepath.Base(filename))
+		}
+		if sr.config.Transcribe && !sr.config.Encrypt {
+			sr.queueJob(jobTranscribe, filepath.Base(filename))
+		}
+		// Previews are cached in plain form, which is why they're skipped with encryption
+		if (sr.config.Thumbnails || sr.config.SpriteSheets) && !sr.config.Encrypt {
+			sr.queueJob(jobThumbnails, filepath.Base(filename))
+		}
+	}()
+}
+
+// saveMetadata writes the sidecar of a finished segment. With encryption on, what
+// was on screen and where is sealed with the encryption key.
+func (sr *ScreenRecorder) saveMetadata(filename string, meta metadata.Segment) error {
+	if sr.secret != nil {
+		sealed, err := meta.Seal(sr.secret)
+		if err != nil {
+			return err
+		}
+		meta = sealed
+	}
+	return metadata.Save(filename, meta)
+}
+
+// pendingMarker returns the marker a segment being finished will get from
+// setSegmentMarker, as far as it's known yet
+func (sr *ScreenRecorder) pendingMarker(filename string) string {
+	sr.markerMutex.Lock()
+	defer sr.markerMutex.Unlock()
+	if sr.emergencies[filename] {
+		return MarkerEmergency
+	}
+	return MarkerStandard
+}
+
+// setSegmentMarker marks a finished segment as a dashcam recording, as an emergency
+// recording if that was requested while it was recorded
+func (sr *ScreenRecorder) setSegmentMarker(filename string) (string, error) {
+	sr.markerMutex.Lock()
+	defer sr.markerMutex.Unlock()
+
+	marker := MarkerStandard
+	if sr.emergencies[filename] {
+		marker = MarkerEmergency
+		delete(sr.emergencies, filename)
+	}
+	if err := attributes.SetMarker(filename, MarkerName, marker); err != nil {
+		return marker, err
+	}
+	delete(sr.unmarked, filename)
+	return marker, nil
+}
+
+// MarkEmergency protects the segments being recorded and the ones before them (of
+// every source) from retention and wipes, and queues them for upload
+func (sr *ScreenRecorder) MarkEmergency(reason string) {
+	sr.savePreroll()
+
+	var candidates []string
+	sr.stateMutex.Lock()
+	for _, segment := range sr.active {
+		candidates = append(candidates, segment.filename)
+	}
+	sr.stateMutex.Unlock()
+
+	sr.markerMutex.Lock()
+	for _, segment := range sr.lastSegments {
+		candidates = append(candidates, segment)
+	}
+	sort.Strings(candidates)
+	var segments []string
+	for _, segment := range candidates {
+		if segment == "" {
+			continue
+		}
+		segments = append(segments, filepath.Base(segment))
+
+		// Segments still being recorded or post-processed get the marker when they're finished
+		marked := false
+		for _, path := range []string{segment, segment + crypt.Extension} {
+			if value, err := attributes.GetMarker(path, MarkerName); err == nil && value != "" {
+				if err := attributes.SetMarker(path, MarkerName, MarkerEmergency); err != nil {
+					log.Printf("Warning: Could not mark '%s' as emergency recording: %v", path, err)
+				}
+				marked = true
+			}
+		}
+		if !marked {
+			sr.emergencies[segment] = true
+		}
+	}
+	sr.markerMutex.Unlock()
+
+	if len(segments) == 0 {
+		log.Printf("Emergency requested (%s), but nothing is being recorded", reason)
+		return
+	}
+	log.Printf("Emergency (%s): protecting %s", reason, strings.Join(segments, ", "))
+	sr.emit(events.Emergency, reason+": "+strings.Join(segments, ", "))
+}
+
+// muteSegmentAudio silences the audio of a segment in place during the intervals
+func muteSegmentAudio(filename string, intervals []metadata.Interval) error {
+	spans := make([]ffmpeg.Span, 0, len(intervals))
+	for _, interval := range intervals {
+		spans = append(spans, ffmpeg.Span{Start: interval.Start, End: interval.End})
+	}
+
+	return RewriteSegment(filename, func(src string, dst string) error {
+		return ffmpeg.MuteAudio(src, dst, spans)
+	})
+}
+
+// embedContext muxes window chapters, a context subtitle track and the identifying
+// tags (with the segment's marker) into a segment
+func (sr *ScreenRecorder) embedContext(filename string, meta metadata.Segment, marker string) error {
+	embed := ffmpeg.Embed{Duration: meta.End.Sub(meta.Start).Seconds()}
+
+	if sr.config.WindowChapters {
+		embed.Chapters = windowChapters(meta)
+	}
+
+	if sr.config.Subtitles {
+		srtFile, err := os.CreateTemp("", "dashcam-*.srt")
+		if err != nil {
+			return err
+		}
+		srtFile.Close()
+		defer os.Remove(srtFile.Name())
+
+		if err := subtitle.WriteSRT(srtFile.Name(), contextCues(meta)); err != nil {
+			return err
+		}
+		embed.SubtitleFile = srtFile.Name()
+	}
+
+	if sr.config.EmbedTags {
+		embed.Tags = segmentTags(meta, marker)
+	}
+
+	if embed.Empty() {
+		return nil
+	}
+	return RewriteSegment(filename, func(src string, dst string) error {
+		return ffmpeg.Remux(src, dst, embed)
+	})
+}
+
+// segmentTags identifies a segment from within the file, so a bare copy without
+// xattrs, sidecars or the catalog still tells where and when it was recorded
+func segmentTags(meta metadata.Segment, marker string) map[string]string {
+	tags := map[string]string{
+		"creation_time":   meta.Start.UTC().Format(time.RFC3339Nano),
+		"DATE_RECORDED":   meta.Start.Format(time.RFC3339),
+		"DASHCAM_END":     meta.End.Format(time.RFC3339),
+		"DASHCAM_MARKER":  marker,
+		"DASHCAM_VERSION": Version,
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		tags["DASHCAM_HOSTNAME"] = hostname
+	}
+	return tags
+}
+
+// windowChapters returns a chapter for every switch to another application
+func windowChapters(meta metadata.Segment) []ffmpeg.Chapter {
+	var chapters []ffmpeg.Chapter
+	for _, sample := range meta.Windows {
+		if n := len(chapters); n > 0 && chapters[n-1].Title == sample.AppID {
+			continue // Same application, only the title changed
+		}
+		chapters = append(chapters, ffmpeg.Chapter{Start: sample.Offset, Title: sample.AppID})
+	}
+	return chapters
+}
+
+// contextCues returns one subtitle per second showing the wall-clock time,
+// the focused window and notes such as muted audio
+func contextCues(meta metadata.Segment) []subtitle.Cue {
+	duration := meta.End.Sub(meta.Start).Seconds()
+	var cues []subtitle.Cue
+
+	for second := 0; float64(second) < duration; second++ {
+		offset := float64(second)
+		lines := []string{meta.Start.Add(time.Duration(second) * time.Second).Format("2006-01-02 15:04:05")}
+
+		// The last window that got focus up to this second
+		for i := len(meta.Windows) - 1; i >= 0; i-- {
+			if meta.Windows[i].Offset <= offset {
+				lines = append(lines, strings.TrimSpace(meta.Windows[i].AppID+" - "+meta.Windows[i].Title))
+				break
+			}
+		}
+
+		// The latest system load sample up to this second
+		for i := len(meta.System) - 1; i >= 0; i-- {
+			if sample := meta.System[i]; sample.Offset <= offset {
+				lines = append(lines, fmt.Sprintf("CPU %.0f%%  Mem %.0f%%  Net down %s/s up %s/s",
+					sample.CPU*100, sample.Memory*100, FormatSize(int64(sample.RxBytes)), FormatSize(int64(sample.TxBytes))))
+				break
+			}
+		}
+
+		// Annotations stay on screen for a few seconds
+		for _, annotation := range meta.Annotations {
+			if offset >= math.Floor(annotation.Offset) && offset < annotation.Offset+annotationSeconds {
+				lines = append(lines, "> "+annotation.Text)
+			}
+		}
+
+		for _, interval := range meta.MuteIntervals {
+			if offset >= interval.Start && offset < interval.End {
+				lines = append(lines, "[audio muted: "+interval.Reason+"]")
+				break
+			}
+		}
+
+		cues = append(cues, subtitle.Cue{Start: offset, End: min(offset+1, duration), Text: strings.Join(lines, "\n")})
+	}
+	return cues
+}
+
+// RewriteSegment replaces a segment with the output of an ffmpeg step
+func RewriteSegment(filename string, step func(src string, dst string) error) error {
+	ext := filepath.Ext(filename)
+	tmpFile := strings.TrimSuffix(filename, ext) + ".rewrite" + ext
+	if err := step(filename, tmpFile); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+// indexAnnotations adds the annotations of a segment to the catalog
+func (sr *ScreenRecorder) indexAnnotations(filename string, meta metadata.Segment) {
+	var entries []catalog.Entry
+	for _, annotation := range meta.Annotations {
+		entries = append(entries, catalog.Entry{
+			Segment: filepath.Base(filename),
+			Time:    meta.Start.Add(time.Duration(annotation.Offset * float64(time.Second))),
+			Offset:  annotation.Offset,
+			Kind:    "note",
+			Text:    annotation.Text,
+		})
+	}
+
+	if err := sr.catalog.Add(entries...); err != nil {
+		log.Printf("Warning: Could not add annotations to catalog: %v", err)
+	}
+}
+
+// indexText runs OCR on frames sampled from an unencrypted segment and adds the
+// text to the catalog
+func (sr *ScreenRecorder) indexText(filename string, start time.Time) {
+	tmpDir, err := os.MkdirTemp("", "dashcam-ocr-*")
+	if err != nil {
+		log.Printf("Warning: Could not create OCR directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	interval := float64(max(sr.config.OCRInterval, 1))
+	frames, err := ffmpeg.ExtractFrames(filename, tmpDir, interval)
+	if err != nil {
+		log.Printf("Warning: Could not extract frames of '%s' for OCR: %v", filename, err)
+		return
+	}
+
+	var entries []catalog.Entry
+	previous := ""
+	for i, frame := range frames {
+		text, err := ocr.Text(frame, sr.config.OCRLanguage)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		// A static screen yields the same text frame after frame; index it once
+		if text == "" || text == previous {
+			continue
+		}
+		previous = text
+
+		offset := float64(i) * interval
+		entries = append(entries, catalog.Entry{
+			Segment: filepath.Base(filename),
+			Time:    start.Add(time.Duration(offset * float64(time.Second))),
+			Offset:  offset,
+			Kind:    "ocr",
+			Text:    text,
+		})
+	}
+
+	if err := sr.catalog.Add(entries...); err != nil {
+		log.Printf("Warning: Could not add OCR text to catalog: %v", err)
+	}
+}
+
+// transcribeSegment writes a VTT transcript of an unencrypted segment's audio and
+// adds it to the catalog
+func (sr *ScreenRecorder) transcribeSegment(filename string, start time.Time) {
+	tmpDir, err := os.MkdirTemp("", "dashcam-transcribe-*")
+	if err != nil {
+		log.Printf("Warning: Could not create transcription directory: %v", err)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wav := filepath.Join(tmpDir, "audio.wav")
+	if err := ffmpeg.ExtractAudio(filename, wav); err != nil {
+		log.Printf("Warning: Could not extract audio of '%s': %v", filename, err)
+		return
+	}
+
+	vtt := transcriptPath(filename)
+	if err := transcribe.VTT(sr.config.WhisperCommand, sr.config.WhisperModel, sr.config.WhisperLanguage, wav, vtt); err != nil {
+		log.Printf("Warning: Could not transcribe '%s': %v", filename, err)
+		return
+	}
+	if err := os.Chmod(vtt, sr.config.FilePermissions()); err != nil {
+		log.Printf("Warning: Could not set permissions on '%s': %v", vtt, err)
+	}
+
+	cues, err := subtitle.ReadVTT(vtt)
+	if err != nil {
+		log.Printf("Warning: Could not read transcript '%s': %v", vtt, err)
+		return
+	}
+
+	var entries []catalog.Entry
+	for _, cue := range cues {
+		// whisper marks silence and noise with bracketed tags such as [BLANK_AUDIO]
+		if cue.Text == "" || (strings.HasPrefix(cue.Text, "[") && strings.HasSuffix(cue.Text, "]")) {
+			continue
+		}
+		entries = append(entries, catalog.Entry{
+			Segment: filepath.Base(filename),
+			Time:    start.Add(time.Duration(cue.Start * float64(time.Second))),
+			Offset:  cue.Start,
+			Kind:    "speech",
+			Text:    cue.Text,
+		})
+	}
+
+	if err := sr.catalog.Add(entries...); err != nil {
+		log.Printf("Warning: Could not add transcript to catalog: %v", err)
+	}
+}
+
+// gpxPath returns the GPX track file of a (possibly encrypted) segment
+func gpxPath(segment string) string {
+	return crypt.PlainName(segment) + ".gpx"
+}
+
+// transcriptPath returns the VTT transcript of a (possibly encrypted) segment
+func transcriptPath(segment string) string {
+	return crypt.PlainName(segment) + transcribe.Extension
+}
+
+// sidecarFiles returns all files that belong to a (possibly encrypted) segment
+func sidecarFiles(segment string) []string {
+	plain := crypt.PlainName(segment)
+	return []string{metadata.Path(plain), gpxPath(segment), transcriptPath(segment), thumbnail.Path(plain), thumbnail.SpritePath(plain)}
+}
+
+// createThumbnails renders the cached preview images of a finished segment
+func (sr *ScreenRecorder) createThumbnails(filename string, duration float64) {
+	if err := os.MkdirAll(thumbnail.CacheDir(), 0700); err != nil {
+		log.Printf("Warning: Could not create thumbnail cache: %v", err)
+		return
+	}
+
+	if sr.config.Thumbnails {
+		if err := ffmpeg.Thumbnail(filename, thumbnail.Path(filename), duration/2, 320); err != nil {
+			log.Printf("Warning: Could not create thumbnail for '%s': %v", filename, err)
+		}
+	}
+	if sr.config.SpriteSheets {
+		if err := ffmpeg.SpriteSheet(filename, thumbnail.SpritePath(filename), duration, 4, 4, 160); err != nil {
+			log.Printf("Warning: Could not create sprite sheet for '%s': %v", filename, err)
+		}
+	}
+}
+
+// sealEncrypted replaces a finished segment with the encrypted copy made while it
+// was digested, reporting whether it did
+func (sr *ScreenRecorder) sealEncrypted(filename string, encrypted string) bool {
+	// Carry the marker over before the plain file goes away
+	value, err := attributes.GetMarker(filename, MarkerName)
+	if err != nil || value == "" {
+		value = MarkerStandard
+	}
+	if err := os.Chmod(encrypted, sr.config.FilePermissions()); err != nil {
+		log.Printf("Warning: Could not set permissions on '%s': %v", encrypted, err)
+	}
+	if err := attributes.SetMarker(encrypted, MarkerName, value); err != nil {
+		log.Printf("Warning: Failed to set marker on file '%s': %v", encrypted, err)
+		os.Remove(encrypted)
+		return false
+	}
+
+	if err := shred.File(filename); err != nil {
+		log.Printf("Warning: Could not wipe unencrypted segment '%s': %v", filename, err)
+	}
+	return true
+}
+
+// shutdown runs the final cleanup and writes a session summary to the journal.
+// ctx is the cancelled context of the run.
+func (sr *ScreenRecorder) shutdown(ctx context.Context, startedAt time.Time) {
+	// Let pending post-processing finish first; queued jobs that haven't
+	// started yet are picked up again on the next start
+	sr.workers.Wait()
+
+	if sr.wipe.Load() {
+		// The archive was wiped when recording stopped; this takes what
+		// post-processing steps that were already running wrote since
+		if wiped, _ := sr.panicWipe(); wiped > 0 {
+			log.Printf("Panic wipe: removed %d recordings again that post-processing was still writing", wiped)
+		}
+		sr.finished()
+		sr.writeStatus()
+		return
+	}
+
+	// The final cleanup runs to the end
+	if err := sr.cleanupOldFiles(context.WithoutCancel(ctx)); err != nil {
+		log.Printf("Warning: Failed to cleanup old files: %v", err)
+	}
+
+	summary := fmt.Sprintf("%s; recorded %d segments in %s",
+		sr.stopReasonText(), sr.segmentCount.Load(), time.Since(startedAt).Round(time.Second))
+	log.Printf("Session summary: %s", summary)
+	sr.emit(events.Stop, summary)
+	sr.events.Close()
+
+	sr.finished()
+	sr.writeStatus()
+	log.Println("Screen recorder stopped.")
+}
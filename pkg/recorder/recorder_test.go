@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"context"
+	"dashcam/internal/attributes"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestTestsrcRecording records a few short segments of the test pattern, marks
+// an emergency in between and checks the markers and the max_files cleanup
+func TestTestsrcRecording(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg is not installed")
+	}
+	dir := t.TempDir()
+	if !attributes.Supported(dir) {
+		t.Skip("the temporary directory can't store markers")
+	}
+	// Keep the status file, control socket and caches away from a real dashcam
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	config := DefaultConfig()
+	config.RecordingsDir = dir
+	config.CaptureBackend = "testsrc"
+	config.V4L2Size = "320x240"
+	config.V4L2Framerate = 10
+	config.Codec = "mpeg4" // Built into every ffmpeg
+	config.RecordAudio = false
+	config.RecordingLength = 1
+	config.MaxFiles = 2
+	config.Thumbnails = false
+	config.SpriteSheets = false
+
+	sr, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := make(chan string, 64)
+	unsubscribe := sr.Subscribe(func(event Event) {
+		if event.Kind == EventSegmentStart {
+			starts <- event.Segment
+		}
+	})
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- sr.Start(ctx)
+	}()
+
+	// Segments 2 and 3 are protected by an emergency during segment 3; segments
+	// 4 and 5 are standard recordings again
+	var segments []string
+	timeout := time.After(time.Minute)
+	for len(segments) < 5 {
+		select {
+		case segment := <-starts:
+			segments = append(segments, segment)
+			if len(segments) == 3 {
+				sr.MarkEmergency("test")
+			}
+		case err := <-done:
+			t.Fatalf("recorder stopped early: %v", err)
+		case <-timeout:
+			t.Fatalf("only %d segments were started", len(segments))
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("recorder didn't stop")
+	}
+
+	markers := make(map[string]string)
+	files, err := attributes.ScanMarkedFiles(dir, MarkerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard := 0
+	for _, file := range files {
+		markers[file.Path] = file.Marker
+		if file.Marker == MarkerStandard {
+			standard++
+		}
+	}
+	for _, segment := range segments[1:3] {
+		if markers[segment] != MarkerEmergency {
+			t.Errorf("%s has marker %q, want %q", segment, markers[segment], MarkerEmergency)
+		}
+	}
+	if standard != config.MaxFiles {
+		t.Errorf("%d standard recordings are left, want max_files (%d)", standard, config.MaxFiles)
+	}
+	if FileExists(segments[0]) {
+		t.Errorf("the oldest standard recording %s wasn't cleaned up", segments[0])
+	}
+}
@@ -0,0 +1,108 @@
+package recorder
+
+import (
+	"dashcam/internal/attributes"
+	"dashcam/internal/crypt"
+	"dashcam/internal/metadata"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// Segment is a recording together with its metadata
+type Segment struct {
+	Path string
+	Meta SegmentMeta
+}
+
+// SegmentMeta is what is known about a recording besides the video (times,
+// windows, locations, annotations, ...), as stored in its sidecar
+type SegmentMeta = metadata.Segment
+
+// Entries of SegmentMeta
+type (
+	Interval     = metadata.Interval
+	WindowSample = metadata.WindowSample
+	Location     = metadata.Location
+	SystemSample = metadata.SystemSample
+	Annotation   = metadata.Annotation
+	Part         = metadata.Part
+)
+
+// Idle reports whether the segment's activity score is below threshold.
+// Segments without a score are never considered idle.
+func (s Segment) Idle(threshold float64) bool {
+	return s.Meta.Activity != nil && *s.Meta.Activity < threshold
+}
+
+// ListSegments returns all recordings, oldest first
+func ListSegments(config Config) ([]Segment, error) {
+	files, err := attributes.ScanMarkedFiles(config.RecordingsDir, MarkerName)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(files))
+	for _, file := range files {
+		meta, err := metadata.Load(crypt.PlainName(file.Path))
+		if err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		// Segments recorded before metadata existed fall back to the modification time
+		if meta.Start.IsZero() {
+			meta.Start = file.ModTime
+		}
+		segments = append(segments, Segment{Path: file.Path, Meta: meta})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Meta.Start.Before(segments[j].Meta.Start)
+	})
+	return segments, nil
+}
+
+// OpenSegment opens a segment for reading, transparently decrypting it
+func OpenSegment(config Config, path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !crypt.IsEncrypted(path) {
+		return file, nil
+	}
+
+	secret, err := crypt.LoadSecret(config.EncryptionKey)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer file.Close()
+		writer.CloseWithError(crypt.Decrypt(file, writer, secret))
+	}()
+	return reader, nil
+}
+
+// FormatSize renders a byte count for humans
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// FileExists reports whether path exists
+func FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
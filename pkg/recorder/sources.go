@@ -0,0 +1,165 @@
+package recorder
+
+import (
+	"dashcam/internal/capture"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// Source is an additional recording source with its own series of segments, e.g. a
+// webcam next to the screen. Settings left out are taken from the main configuration.
+type Source struct {
+	Name            string       `json:"name"` // Appended to segment file names, e.g. 2006-01-02_15-04-05_webcam.mkv
+	CaptureBackend  string       `json:"capture_backend,omitempty"`
+	V4L2Device      string       `json:"v4l2_device,omitempty"`
+	V4L2Size        string       `json:"v4l2_size,omitempty"`
+	V4L2Framerate   int          `json:"v4l2_framerate,omitempty"`
+	LibcameraCamera *int         `json:"libcamera_camera,omitempty"`
+	CaptureDisplay  string       `json:"capture_display,omitempty"`
+	CaptureOutput   string       `json:"capture_output,omitempty"`
+	Codec           string       `json:"codec,omitempty"`
+	RecordAudio     *bool        `json:"record_audio,omitempty"`
+	RecordingLength int          `json:"recording_length_seconds,omitempty"`
+	MaskRegions     []MaskRegion `json:"mask_regions,omitempty"`
+}
+
+// sourceNamePattern keeps source names usable in file names
+var sourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// sourceConfig returns the configuration of a source: the main configuration with
+// the source's settings applied
+func (c Config) sourceConfig(s Source) Config {
+	config := c
+	config.Sources = nil
+	config.PrerollSeconds = 0 // Only the main source is buffered
+	if s.CaptureBackend != "" {
+		config.CaptureBackend = s.CaptureBackend
+	}
+	if s.V4L2Device != "" {
+		config.V4L2Device = s.V4L2Device
+	}
+	if s.V4L2Size != "" {
+		config.V4L2Size = s.V4L2Size
+	}
+	if s.V4L2Framerate > 0 {
+		config.V4L2Framerate = s.V4L2Framerate
+	}
+	if s.LibcameraCamera != nil {
+		config.LibcameraCamera = *s.LibcameraCamera
+	}
+	if s.CaptureDisplay != "" {
+		config.CaptureDisplay = s.CaptureDisplay
+	}
+	if s.CaptureOutput != "" {
+		config.CaptureOutput = s.CaptureOutput
+	}
+	if s.Codec != "" {
+		config.Codec = s.Codec
+	}
+	if s.RecordAudio != nil {
+		config.RecordAudio = *s.RecordAudio
+	}
+	if s.RecordingLength > 0 {
+		config.RecordingLength = s.RecordingLength
+	}
+	if s.MaskRegions != nil {
+		config.MaskRegions = s.MaskRegions
+	}
+	return config
+}
+
+// validateSources checks the additional sources
+func (c Config) validateSources() error {
+	names := make(map[string]bool)
+	for _, s := range c.Sources {
+		if !sourceNamePattern.MatchString(s.Name) {
+			return fmt.Errorf("source name '%s' must be lowercase letters, digits and dashes", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("source name '%s' is used twice", s.Name)
+		}
+		names[s.Name] = true
+
+		config := c.sourceConfig(s)
+		if _, err := config.captureBackend(); err != nil {
+			return fmt.Errorf("source %s: %v", s.Name, err)
+		}
+		if config.LibcameraCamera < 0 {
+			return fmt.Errorf("source %s: libcamera_camera must not be negative", s.Name)
+		}
+		for _, region := range config.MaskRegions {
+			if err := region.Validate(); err != nil {
+				return fmt.Errorf("source %s: mask_regions: %v", s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// source is a running recording source: the main one (without a name) or one of
+// the configured additional sources
+type source struct {
+	name    string
+	config  Config
+	backend capture.Backend
+
+	sharedInSegment atomic.Bool // The screen was shared during the current segment
+}
+
+// label returns how the source is called in log messages
+func (s *source) label() string {
+	if s.name == "" {
+		return "main"
+	}
+	return s.name
+}
+
+// recordingSources returns the main source followed by the additional ones
+func (c Config) recordingSources() ([]*source, error) {
+	configs := []Config{c}
+	names := []string{""}
+	for _, s := range c.Sources {
+		configs = append(configs, c.sourceConfig(s))
+		names = append(names, s.Name)
+	}
+
+	var sources []*source
+	for i, config := range configs {
+		backend, err := config.captureBackend()
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, &source{name: names[i], config: config, backend: backend})
+	}
+	return sources, nil
+}
+
+// Headless reports whether no source records the desktop session, e.g. on a CI
+// machine recording a virtual display. Everything that watches the session
+// (its end, hotkeys, the focused window, screen sharing) is then left out.
+func (sr *ScreenRecorder) Headless() bool {
+	for _, src := range sr.sources {
+		if src.backend.Session() {
+			return false
+		}
+	}
+	return true
+}
+
+// contextCutoff returns up to when the recorded context (windows, mute spans, ...)
+// may be dropped after a segment ending at end was finished: everything other
+// sources still record must stay available for their segments
+func (sr *ScreenRecorder) contextCutoff(end time.Time) time.Time {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+
+	cutoff := end
+	for _, segment := range sr.active {
+		if segment.started.Before(cutoff) {
+			cutoff = segment.started
+		}
+	}
+	return cutoff
+}
@@ -0,0 +1,113 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// runState is where a recorder is in its life: it's started once and stopped once
+type runState int
+
+const (
+	stateIdle     runState = iota // Created, Start not called yet
+	stateRunning                  // Recording (or paused)
+	stateStopping                 // Stop called, finishing segments and post-processing
+	stateStopped                  // Done; the recorder can't be started again
+)
+
+func (s runState) String() string {
+	switch s {
+	case stateIdle:
+		return "idle"
+	case stateRunning:
+		return "running"
+	case stateStopping:
+		return "stopping"
+	default:
+		return "stopped"
+	}
+}
+
+// activeSegment is a segment being recorded
+type activeSegment struct {
+	filename string
+	started  time.Time
+}
+
+// begin moves an idle recorder into the running state and returns when it
+// started. cancel cancels the context of the run, which Stop calls.
+func (sr *ScreenRecorder) begin(cancel context.CancelCauseFunc) (time.Time, error) {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+
+	if sr.state != stateIdle {
+		return time.Time{}, fmt.Errorf("recorder is %s, it can only be started once", sr.state)
+	}
+	sr.state = stateRunning
+	sr.startedAt = time.Now()
+	sr.cancel = cancel
+	return sr.startedAt, nil
+}
+
+// abort undoes begin when the start failed before recording; a recorder that
+// was stopped in the meantime stays stopped
+func (sr *ScreenRecorder) abort() {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+
+	switch sr.state {
+	case stateRunning:
+		sr.state = stateIdle
+		sr.startedAt = time.Time{}
+		sr.cancel = nil
+	case stateStopping:
+		sr.state = stateStopped
+	}
+}
+
+// Stop ends the recording loop, finishing the current segment first, by
+// cancelling the context everything started by Start runs under. It may be
+// called any number of times, from any goroutine; the first reason is kept.
+func (sr *ScreenRecorder) Stop(reason string) {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+
+	switch sr.state {
+	case stateIdle:
+		// Never started, so there is nothing to finish
+		sr.state = stateStopped
+	case stateRunning:
+		sr.state = stateStopping
+	default:
+		return
+	}
+	sr.stopReason = reason
+	if sr.cancel != nil {
+		sr.cancel(errors.New(reason))
+	}
+}
+
+// finished marks the recorder as stopped once everything has been wrapped up
+func (sr *ScreenRecorder) finished() {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+	sr.state = stateStopped
+	clear(sr.active)
+}
+
+// stopReasonText returns why the recorder was stopped
+func (sr *ScreenRecorder) stopReasonText() string {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+	return sr.stopReason
+}
+
+// currentSegment returns the segment the main source is recording; the filename
+// is empty when none is
+func (sr *ScreenRecorder) currentSegment() activeSegment {
+	sr.stateMutex.Lock()
+	defer sr.stateMutex.Unlock()
+	return sr.active[sr.sources[0].name]
+}
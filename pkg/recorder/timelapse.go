@@ -0,0 +1,142 @@
+package recorder
+
+import (
+	"dashcam/internal/crypt"
+	"dashcam/internal/ffmpeg"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// timelapseSuffix is appended to the day (YYYY-MM-DD) to name its timelapse
+const timelapseSuffix = "_timelapse.mp4"
+
+// timelapseWidth is the maximum width of timelapse videos
+const timelapseWidth = 1280
+
+// timelapsePath returns where the timelapse of a day is stored (before encryption)
+func timelapsePath(config Config, day time.Time) string {
+	return filepath.Join(config.RecordingsDir, day.Format("2006-01-02")+timelapseSuffix)
+}
+
+// timelapseExists reports whether a day already has a timelapse, encrypted or not
+func timelapseExists(config Config, day time.Time) bool {
+	path := timelapsePath(config, day)
+	return FileExists(path) || FileExists(path+crypt.Extension)
+}
+
+// MakeTimelapse renders all recordings of a day into a single sped-up video of
+// about the given length, stored next to the recordings. The timelapse is
+// encrypted when encryption is enabled.
+func MakeTimelapse(config Config, day time.Time, length time.Duration) (string, error) {
+	parts, err := timelapseParts(config, day)
+	if err != nil {
+		return "", err
+	}
+	return makeTimelapse(config, day, parts, length)
+}
+
+// timelapseParts returns the recordings of a day that go into its timelapse
+func timelapseParts(config Config, day time.Time) ([]Segment, error) {
+	segments, err := ListSegments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	year, month, date := day.Date()
+	var parts []Segment
+	for _, segment := range segments {
+		// Only the main source; additional sources such as cameras record something else
+		if y, m, d := segment.Meta.Start.Date(); y != year || m != month || d != date || segment.Meta.Source != "" {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no recordings on %s", day.Format("2006-01-02"))
+	}
+	return parts, nil
+}
+
+// makeTimelapse renders the timelapse of a day from its recordings. Recordings
+// that are gone by the time they're rendered are skipped.
+func makeTimelapse(config Config, day time.Time, parts []Segment, length time.Duration) (string, error) {
+	total := 0.0
+	for _, part := range parts {
+		total += SegmentDuration(config, part.Meta)
+	}
+	speed := max(total/length.Seconds(), 1)
+
+	// Pieces of encrypted recordings are plain video, so keep them in the protected directory
+	tmpDir, err := os.MkdirTemp(config.RecordingsDir, ".timelapse-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create timelapse directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Speed up every recording on its own so only one is decrypted at a time
+	var pieces []string
+	for i, part := range parts {
+		piece := filepath.Join(tmpDir, fmt.Sprintf("piece-%04d.mp4", i))
+		reader, err := OpenSegment(config, part.Path)
+		if err != nil {
+			log.Printf("Warning: Skipping %s in timelapse: %v", filepath.Base(part.Path), err)
+			continue
+		}
+		err = ffmpeg.SpeedUp(reader, piece, speed, timelapseWidth)
+		reader.Close()
+		if err != nil {
+			log.Printf("Warning: Skipping %s in timelapse: %v", filepath.Base(part.Path), err)
+			continue
+		}
+		pieces = append(pieces, piece)
+	}
+	if len(pieces) == 0 {
+		return "", fmt.Errorf("none of the recordings of %s could be rendered", day.Format("2006-01-02"))
+	}
+
+	rendered := filepath.Join(tmpDir, "timelapse.mp4")
+	if err := ffmpeg.Concat(pieces, rendered); err != nil {
+		return "", err
+	}
+
+	target := timelapsePath(config, day)
+	if config.Encrypt {
+		secret, err := crypt.LoadSecret(config.EncryptionKey)
+		if err != nil {
+			return "", err
+		}
+		if err := crypt.EncryptFile(rendered, rendered+crypt.Extension, secret); err != nil {
+			return "", fmt.Errorf("failed to encrypt timelapse: %v", err)
+		}
+		rendered += crypt.Extension
+		target += crypt.Extension
+	}
+
+	if err := os.Chmod(rendered, config.FilePermissions()); err != nil {
+		log.Printf("Warning: Could not set permissions on '%s': %v", rendered, err)
+	}
+	if err := os.Rename(rendered, target); err != nil {
+		return "", fmt.Errorf("failed to move timelapse into place: %v", err)
+	}
+	return target, nil
+}
+
+// SegmentDuration returns the recorded length of a segment in seconds, falling
+// back to the configured segment length for recordings without metadata
+func SegmentDuration(config Config, meta SegmentMeta) float64 {
+	// Merged recordings skip the gaps between their parts
+	if len(meta.Parts) > 0 {
+		total := 0.0
+		for _, part := range meta.Parts {
+			total += part.End.Sub(part.Start).Seconds()
+		}
+		return total
+	}
+	if meta.End.After(meta.Start) {
+		return meta.End.Sub(meta.Start).Seconds()
+	}
+	return float64(config.RecordingLength)
+}
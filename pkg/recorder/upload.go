@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"context"
+	"dashcam/internal/attributes"
+	"dashcam/internal/crypt"
+	"dashcam/internal/metadata"
+	"dashcam/internal/upload"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// uploadMarkerName is set to the remote a recording was uploaded to
+const uploadMarkerName = "dashcam_uploaded"
+
+// uploadRetryDelay is the wait before the first retry; it doubles with every attempt
+const uploadRetryDelay = 30 * time.Second
+
+// UploadCandidates returns the recordings that still need uploading: protected
+// recordings (e.g. emergency recordings), or all recordings with upload_all
+func UploadCandidates(config Config) ([]string, error) {
+	segments, err := ListSegments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, segment := range segments {
+		if !config.UploadAll {
+			if value, err := attributes.GetMarker(segment.Path, MarkerName); err != nil || value == MarkerStandard {
+				continue
+			}
+		}
+		// A plain file is about to be replaced by its encrypted version; never upload it
+		if config.Encrypt && !crypt.IsEncrypted(segment.Path) {
+			continue
+		}
+		if uploaded(config, segment.Path) {
+			continue
+		}
+		files = append(files, segment.Path)
+	}
+	return files, nil
+}
+
+// uploaded reports whether a recording was already uploaded to the configured remote
+func uploaded(config Config, path string) bool {
+	value, err := attributes.GetMarker(path, uploadMarkerName)
+	return err == nil && value == config.UploadRemote
+}
+
+// UploadFile uploads a recording and its metadata, retrying with increasing delays,
+// and marks it as uploaded. It gives up early when ctx is cancelled.
+func UploadFile(ctx context.Context, config Config, path string) error {
+	// Remotes don't keep extended attributes, so the marker travels in the metadata sidecar
+	sidecar, err := markedSidecar(config, path)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(filepath.Dir(sidecar))
+	files := []string{path, sidecar}
+
+	delay := uploadRetryDelay
+	attempts := max(config.UploadRetries, 0) + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = nil
+		for _, file := range files {
+			if err = upload.Copy(ctx, file, config.UploadRemote, config.UploadBandwidth); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			break
+		}
+		if attempt == attempts {
+			return fmt.Errorf("failed to upload %s after %d attempts: %v", filepath.Base(path), attempts, err)
+		}
+
+		log.Printf("Warning: Upload of %s failed (attempt %d of %d), retrying in %s: %v",
+			filepath.Base(path), attempt, attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("upload of %s cancelled", filepath.Base(path))
+		}
+		delay *= 2
+	}
+
+	if err := attributes.SetMarker(path, uploadMarkerName, config.UploadRemote); err != nil {
+		return fmt.Errorf("uploaded %s but could not mark it: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// markedSidecar writes a copy of a recording's metadata sidecar that includes its
+// marker into a temporary directory and returns its path
+func markedSidecar(config Config, path string) (string, error) {
+	plain := crypt.PlainName(path)
+	meta, err := metadata.Load(plain)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if meta.Marker, err = attributes.GetMarker(path, MarkerName); err != nil {
+		return "", err
+	}
+
+	tmpDir, err := os.MkdirTemp(config.RecordingsDir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %v", err)
+	}
+	copied := filepath.Join(tmpDir, filepath.Base(plain))
+	if err := metadata.Save(copied, meta); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	return metadata.Path(copied), nil
+}
@@ -0,0 +1,50 @@
+// Package retention decides which recordings to delete to keep an archive of
+// rolling recordings within its limit.
+package retention
+
+import (
+	"dashcam/internal/attributes"
+	"sort"
+	"time"
+)
+
+// Recording is a recording subject to the limit, with the file information read
+// once when the directory was scanned
+type Recording struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Candidates returns the recordings in directory that count towards the limit:
+// those whose markerName attribute is standardValue. Recordings marked with any
+// other value (e.g. emergency recordings) are protected and never returned.
+func Candidates(directory string, markerName string, standardValue string) ([]Recording, error) {
+	marked, err := attributes.ScanMarkedFiles(directory, markerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var recordings []Recording
+	for _, file := range marked {
+		if file.Marker == standardValue {
+			recordings = append(recordings, Recording{Path: file.Path, Size: file.Size, ModTime: file.ModTime})
+		}
+	}
+	return recordings, nil
+}
+
+// Expired returns the recordings to delete so that no more than maxFiles remain:
+// the oldest by modification time, oldest first
+func Expired(recordings []Recording, maxFiles int) []Recording {
+	if len(recordings) <= maxFiles {
+		return nil
+	}
+
+	// Sort by modification time (oldest first)
+	sorted := append([]Recording(nil), recordings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ModTime.Before(sorted[j].ModTime)
+	})
+	return sorted[:len(sorted)-maxFiles]
+}
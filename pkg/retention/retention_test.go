@@ -0,0 +1,102 @@
+package retention
+
+import (
+	"dashcam/internal/attributes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestExpired(t *testing.T) {
+	base := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	recording := func(name string, minutes int) Recording {
+		return Recording{Path: name, ModTime: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+	// Listed in directory order, not by age
+	recordings := []Recording{recording("c", 2), recording("a", 0), recording("d", 3), recording("b", 1)}
+
+	tests := []struct {
+		maxFiles int
+		want     []string
+	}{
+		{5, nil},
+		{4, nil},
+		{3, []string{"a"}},
+		{1, []string{"a", "b", "c"}},
+		{0, []string{"a", "b", "c", "d"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, expired := range Expired(recordings, test.maxFiles) {
+			got = append(got, expired.Path)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expired(max %d) = %q, want %q", test.maxFiles, got, test.want)
+		}
+	}
+	if recordings[0].Path != "c" {
+		t.Errorf("Expired reordered its input")
+	}
+
+	// Recordings finished in the same second keep their order
+	same := []Recording{recording("x", 0), recording("y", 0), recording("z", 0)}
+	if expired := Expired(same, 1); len(expired) != 2 || expired[0].Path != "x" || expired[1].Path != "y" {
+		t.Errorf("Expired of equal times = %v, want x and y", expired)
+	}
+}
+
+func TestCandidatesSkipProtected(t *testing.T) {
+	dir := t.TempDir()
+	if !attributes.Supported(dir) {
+		t.Skip("the temporary directory can't store markers")
+	}
+
+	markers := map[string]string{
+		"1.mkv": "standard",
+		"2.mkv": "emergency",
+		"3.mkv": "standard",
+		"4.mkv": "protected",
+		"5.mkv": "standard",
+		"6.mkv": "",
+	}
+	names := make([]string, 0, len(markers))
+	for name := range markers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Date(2026, 10, 17, 12, i, 0, 0, time.UTC)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		if markers[name] != "" {
+			if err := attributes.SetMarker(path, "user.dashcam", markers[name]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	recordings, err := Candidates(dir, "user.dashcam", "standard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 3 {
+		t.Fatalf("%d candidates, want the 3 standard recordings", len(recordings))
+	}
+
+	// max_files counts only standard recordings; emergency ones stay however old
+	var expired []string
+	for _, recording := range Expired(recordings, 2) {
+		expired = append(expired, filepath.Base(recording.Path))
+	}
+	if want := []string{"1.mkv"}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("expired %q, want %q", expired, want)
+	}
+}